@@ -4,69 +4,121 @@ import (
 	"context"
 	"net/http"
 	"os"
-	"os/signal"
 	"ride-hail/internal/auth/api"
 	"ride-hail/internal/auth/app"
 	"ride-hail/internal/auth/repo"
+	"ride-hail/internal/shared/auth"
 	"ride-hail/internal/shared/config"
 	"ride-hail/internal/shared/db"
+	"ride-hail/internal/shared/health"
+	"ride-hail/internal/shared/lifecycle"
+	"ride-hail/internal/shared/mail"
+	"ride-hail/internal/shared/metrics"
+	"ride-hail/internal/shared/migrate"
+	"ride-hail/internal/shared/mq"
+	"ride-hail/internal/shared/revocation"
+	"ride-hail/internal/shared/sms"
 	"ride-hail/internal/shared/util"
-	"syscall"
-	"time"
 )
 
 func main() {
-	log := util.New()
+	log := util.InitLogger("auth-service")
 
 	log.Info("AuthService", "Starting service initialization...")
 
-	cfg, err := config.LoadConfig("config.yaml")
+	cfg, err := config.Load(os.Args[1:])
 	if err != nil {
 		log.Fatal("Config", err)
 	}
+	if err := config.ValidateIssuer(cfg); err != nil {
+		log.Fatal("Config", err)
+	}
 	log.OK("Config", "Configuration loaded successfully")
 
+	issuer, err := auth.NewIssuer(cfg.JWT)
+	if err != nil {
+		log.Fatal("JWT", err)
+	}
+	verifier := issuer.Verifier()
+	auth.SetDefault(verifier)
+
 	dbConn := db.ConnectToDB(&cfg.Database)
 	if dbConn == nil {
 		log.Fatal("Database", err)
 	}
-	defer dbConn.Close()
+	metrics.RegisterPgxPool(dbConn)
 	log.OK("Database", "Connected successfully")
 
+	if err := migrate.OnStart(context.Background(), dbConn, cfg.Database, log); err != nil {
+		log.Fatal("Migrations", err)
+	}
+
+	rmqConn, err := mq.Dial(&cfg.RabbitMQ)
+	if err != nil {
+		log.Fatal("RabbitMQ", err)
+	}
+	log.OK("RabbitMQ", "Connected successfully")
+
+	// revocations reach the other services through the outbox
+	stopRelay := lifecycle.Background(mq.NewOutboxRelay(dbConn, rmqConn).Run)
+
+	revoked := revocation.NewList(dbConn, log)
+	if err := revoked.Load(context.Background()); err != nil {
+		log.Fatal("Revocations", err)
+	}
+	verifier.UseDenyList(revoked)
+	stopRevocations := lifecycle.Background(func(ctx context.Context) { revoked.Run(ctx, rmqConn) })
+	log.OK("Revocations", "Loaded, following "+revocation.Exchange)
+
+	mailer, err := mail.New(cfg.Mail, log)
+	if err != nil {
+		log.Fatal("Mail", err)
+	}
+
+	smsSender, err := sms.New(cfg.SMS, log)
+	if err != nil {
+		log.Fatal("SMS", err)
+	}
+
 	repository := repo.NewAuthRepo(dbConn)
-	service := app.NewAuthService(repository, log)
+	service := app.NewAuthService(repository, issuer, mailer, smsSender, cfg, log)
 	handler := api.NewHandler(service)
 
-	go repository.StartTokenCleaner()
+	stopCleaner := lifecycle.Background(repository.StartTokenCleaner)
 
 	mux := handler.RegisterRoutes()
 
+	checker := health.NewChecker()
+	checker.Add("postgres", health.PgxPool(dbConn))
+	checker.Add("rabbitmq", rmqConn.Check)
+	checker.Register(mux)
+	mux.Handle("GET "+auth.JWKSPath, issuer.JWKSHandler())
+
+	httpCfg := cfg.Services.AuthService
 	server := &http.Server{
-		Addr:    ":4000",
-		Handler: mux,
+		Addr:         httpCfg.Addr(),
+		Handler:      util.RequestIDMiddleware(metrics.InstrumentHandler(mux)),
+		ReadTimeout:  httpCfg.ReadTimeout,
+		WriteTimeout: httpCfg.WriteTimeout,
+		IdleTimeout:  httpCfg.IdleTimeout,
 	}
 
 	go func() {
-		log.OK("HTTP", "auth-service running on :4000")
+		log.OK("HTTP", "auth-service running on "+httpCfg.Addr())
 		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			log.Error("HTTP", err)
 		}
 	}()
 
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
-
-	log.Warn("AuthService", "Shutting down auth-service...")
-
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	if err := server.Shutdown(ctx); err != nil {
-		log.Error("HTTP", err)
-	} else {
-		log.OK("HTTP", "Server stopped gracefully")
-	}
+	shutdown := lifecycle.New(cfg.Shutdown, checker, log)
+	shutdown.Add("HTTP server", server.Shutdown)
+	shutdown.Add("emails and texts", service.StopBackground)
+	shutdown.Add("token cleaner", stopCleaner)
+	shutdown.Add("outbox relay", stopRelay)
+	shutdown.Add("revocation list", stopRevocations)
+	shutdown.Add("RabbitMQ buffer", rmqConn.Flush)
+	shutdown.AddCloser("Postgres", dbConn.Close)
+	shutdown.Add("RabbitMQ", func(context.Context) error { return rmqConn.Close() })
 
-	log.Info("AuthService", "Shutdown complete")
+	shutdown.Wait()
 }
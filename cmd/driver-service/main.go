@@ -4,77 +4,103 @@ import (
 	"context"
 	"net/http"
 	"os"
-	"os/signal"
 	"ride-hail/internal/driver/adapter/handlers"
 	"ride-hail/internal/driver/adapter/psql"
 	"ride-hail/internal/driver/app/usecase"
+	"ride-hail/internal/shared/auth"
 	"ride-hail/internal/shared/config"
 	"ride-hail/internal/shared/db"
+	"ride-hail/internal/shared/health"
+	"ride-hail/internal/shared/lifecycle"
+	"ride-hail/internal/shared/metrics"
+	"ride-hail/internal/shared/migrate"
+	"ride-hail/internal/shared/mq"
+	"ride-hail/internal/shared/revocation"
 	"ride-hail/internal/shared/util"
-	"syscall"
-	"time"
-
-	"github.com/rabbitmq/amqp091-go"
+	"ride-hail/internal/shared/waittime"
 )
 
 func main() {
-	log := util.New()
+	log := util.InitLogger("driver-service")
 
 	log.Info("DriverService", "Starting service initialization...")
 
-	cfg, err := config.LoadConfig("config.yaml")
+	cfg, err := config.Load(os.Args[1:])
 	if err != nil {
 		log.Fatal("Config", err)
 	}
 	log.OK("Config", "Configuration loaded successfully")
 
-	var ch *amqp091.Channel
-	// conn, ch, err := mq.ConnectToRMQ(&cfg.RabbitMQ)
-	// if err != nil {
-	// 	panic(err)
-	// }
+	verifier, err := auth.NewVerifier(cfg.JWT, log)
+	if err != nil {
+		log.Fatal("JWT", err)
+	}
+	auth.SetDefault(verifier)
 
-	// defer conn.Close()
-	// defer ch.Close()
+	rmqConn, err := mq.Dial(&cfg.RabbitMQ)
+	if err != nil {
+		log.Fatal("RabbitMQ", err)
+	}
+	log.OK("RabbitMQ", "Connected successfully")
 
 	database := db.ConnectToDB(&cfg.Database)
 	if database == nil {
 		log.Fatal("Database", err)
 	}
-	defer database.Close()
+	metrics.RegisterPgxPool(database)
 	log.OK("Database", "Connected successfully")
 
+	if err := migrate.OnStart(context.Background(), database, cfg.Database, log); err != nil {
+		log.Fatal("Migrations", err)
+	}
+
+	revoked := revocation.NewList(database, log)
+	if err := revoked.Load(context.Background()); err != nil {
+		log.Fatal("Revocations", err)
+	}
+	verifier.UseDenyList(revoked)
+	stopRevocations := lifecycle.Background(func(ctx context.Context) { revoked.Run(ctx, rmqConn) })
+	log.OK("Revocations", "Loaded, following "+revocation.Exchange)
+
 	repo := psql.NewRepo(database)
-	service := usecase.NewService(repo, ch)
+	service := usecase.NewService(repo, waittime.NewTariffs(cfg.WaitTariffs))
 	handler := handlers.NewHandler(service)
 
 	mux := handler.Router()
 
+	stopWaitTimes := lifecycle.Background(handler.StartWaitTimeBroadcaster)
+	stopRelay := lifecycle.Background(mq.NewOutboxRelay(database, rmqConn).Run)
+
+	checker := health.NewChecker()
+	checker.Add("postgres", health.PgxPool(database))
+	checker.Add("rabbitmq", rmqConn.Check)
+	checker.Register(mux)
+
+	httpCfg := cfg.Services.DriverLocationService
 	server := &http.Server{
-		Addr:    ":" + "3001",
-		Handler: mux,
+		Addr:         httpCfg.Addr(),
+		Handler:      util.RequestIDMiddleware(metrics.InstrumentHandler(mux)),
+		ReadTimeout:  httpCfg.ReadTimeout,
+		WriteTimeout: httpCfg.WriteTimeout,
+		IdleTimeout:  httpCfg.IdleTimeout,
 	}
 
 	go func() {
-		log.OK("HTTP", "ride-service running on :3001")
+		log.OK("HTTP", "driver-service running on "+httpCfg.Addr())
 		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			log.Error("HTTP", err)
 		}
 	}()
 
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
-
-	log.Warn("RideService", "Shutting down ride-service...")
-
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	if err := server.Shutdown(ctx); err != nil {
-		log.Error("HTTP", err)
-	} else {
-		log.OK("HTTP", "Server stopped gracefully")
-	}
-	log.Info("RideService", "Shutdown complete")
+	shutdown := lifecycle.New(cfg.Shutdown, checker, log)
+	shutdown.Add("HTTP server", server.Shutdown)
+	shutdown.Add("driver WebSockets", handler.CloseWebSockets)
+	shutdown.Add("wait time broadcaster", stopWaitTimes)
+	shutdown.Add("outbox relay", stopRelay)
+	shutdown.Add("revocation list", stopRevocations)
+	shutdown.Add("RabbitMQ buffer", rmqConn.Flush)
+	shutdown.AddCloser("Postgres", database.Close)
+	shutdown.Add("RabbitMQ", func(context.Context) error { return rmqConn.Close() })
+
+	shutdown.Wait()
 }
@@ -4,52 +4,88 @@ import (
 	"context"
 	"net/http"
 	"os"
-	"os/signal"
 	"ride-hail/internal/ride/api"
 	"ride-hail/internal/ride/app"
 	"ride-hail/internal/ride/consumer"
 	"ride-hail/internal/ride/repo"
+	"ride-hail/internal/shared/auth"
 	"ride-hail/internal/shared/config"
 	"ride-hail/internal/shared/db"
+	"ride-hail/internal/shared/health"
+	"ride-hail/internal/shared/lifecycle"
+	"ride-hail/internal/shared/metrics"
+	"ride-hail/internal/shared/migrate"
 	"ride-hail/internal/shared/mq"
+	"ride-hail/internal/shared/revocation"
+	"ride-hail/internal/shared/settings"
 	"ride-hail/internal/shared/util"
-	"syscall"
-	"time"
+	"ride-hail/internal/shared/waittime"
 )
 
 func main() {
-	log := util.New()
+	log := util.InitLogger("ride-service")
 
 	log.Info("RideService", "Starting service initialization...")
 
-	cfg, err := config.LoadConfig("config.yaml")
+	cfg, err := config.Load(os.Args[1:])
 	if err != nil {
 		log.Fatal("Config", err)
 	}
 	log.OK("Config", "Configuration loaded successfully")
 
+	verifier, err := auth.NewVerifier(cfg.JWT, log)
+	if err != nil {
+		log.Fatal("JWT", err)
+	}
+	auth.SetDefault(verifier)
+
 	db := db.ConnectToDB(&cfg.Database)
 	if db == nil {
 		log.Fatal("Database", err)
 	}
-	defer db.Close()
+	metrics.RegisterPgxPool(db)
 	log.OK("Database", "Connected successfully")
 
-	rmqConn, rmqCh, err := mq.ConnectToRMQ(&cfg.RabbitMQ)
+	if err := migrate.OnStart(context.Background(), db, cfg.Database, log); err != nil {
+		log.Fatal("Migrations", err)
+	}
+
+	store := settings.NewStore(db, settings.Defaults(cfg), log)
+	if err := store.Load(context.Background()); err != nil {
+		log.Fatal("Settings", err)
+	}
+	stopSettings := lifecycle.Background(store.Run)
+	log.OK("Settings", "Loaded, listening for changes")
+
+	rmqConn, err := mq.Dial(&cfg.RabbitMQ)
 	if err != nil {
 		log.Fatal("RabbitMQ", err)
 	}
-	defer rmqConn.Close()
-	defer rmqCh.Close()
 	log.OK("RabbitMQ", "Connected successfully")
 
-	publisher := mq.NewPublisher(rmqCh)
+	revoked := revocation.NewList(db, log)
+	if err := revoked.Load(context.Background()); err != nil {
+		log.Fatal("Revocations", err)
+	}
+	verifier.UseDenyList(revoked)
+	stopRevocations := lifecycle.Background(func(ctx context.Context) { revoked.Run(ctx, rmqConn) })
+	log.OK("Revocations", "Loaded, following "+revocation.Exchange)
+
 	repository := repo.NewRideRepo(db)
 
-	service := app.NewRideService(repository, publisher, log)
+	stopKeyCleaner := lifecycle.Background(repository.StartIdempotencyKeyCleaner)
+
+	service := app.NewRideService(repository, cfg.Services.RideService, waittime.NewTariffs(cfg.WaitTariffs), store, log)
 	handler := api.NewHandler(service)
 
-	consumer := consumer.NewDriverResponseConsumer(service, rmqCh)
+	if err := service.ResumeMatchTimers(context.Background()); err != nil {
+		log.Error("RideService", err)
+	}
+
+	stopRelay := lifecycle.Background(mq.NewOutboxRelay(db, rmqConn).Run)
+	log.OK("OutboxRelay", "Started successfully")
+
+	consumer := consumer.NewDriverResponseConsumer(service, rmqConn)
 	if err := consumer.Start(context.Background()); err != nil {
 		log.Fatal("DriverResponseConsumer", err)
 	}
@@ -58,31 +94,47 @@ func main() {
 
 	mux := handler.RegisterRoutes(repository)
 
+	stopWaitTimes := lifecycle.Background(handler.StartWaitTimeBroadcaster)
+
+	checker := health.NewChecker()
+	checker.Add("postgres", health.PgxPool(db))
+	checker.Add("rabbitmq", rmqConn.Check)
+	checker.Add("driver_responses_consumer", consumer.Check)
+	checker.Register(mux)
+
+	settingsAPI := auth.RequirePermission(auth.PermSettingsManage, store.Handler(auth.Subject))
+	mux.Handle("/admin/settings", settingsAPI)
+	mux.Handle("/admin/settings/", settingsAPI)
+
+	httpCfg := cfg.Services.RideService
 	server := &http.Server{
-		Addr:    ":" + "3000",
-		Handler: mux,
+		Addr:         httpCfg.Addr(),
+		Handler:      util.RequestIDMiddleware(metrics.InstrumentHandler(mux)),
+		ReadTimeout:  httpCfg.ReadTimeout,
+		WriteTimeout: httpCfg.WriteTimeout,
+		IdleTimeout:  httpCfg.IdleTimeout,
 	}
 
 	go func() {
-		log.OK("HTTP", "ride-service running on :3000")
+		log.OK("HTTP", "ride-service running on "+httpCfg.Addr())
 		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			log.Error("HTTP", err)
 		}
 	}()
 
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
-
-	log.Warn("RideService", "Shutting down ride-service...")
-
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	if err := server.Shutdown(ctx); err != nil {
-		log.Error("HTTP", err)
-	} else {
-		log.OK("HTTP", "Server stopped gracefully")
-	}
-	log.Info("RideService", "Shutdown complete")
+	shutdown := lifecycle.New(cfg.Shutdown, checker, log)
+	shutdown.Add("HTTP server", server.Shutdown)
+	shutdown.Add("driver_responses consumer", consumer.Stop)
+	shutdown.Add("passenger WebSockets", handler.CloseWebSockets)
+	shutdown.Add("match timers", service.StopMatchTimers)
+	shutdown.Add("wait time broadcaster", stopWaitTimes)
+	shutdown.Add("outbox relay", stopRelay)
+	shutdown.Add("idempotency key cleaner", stopKeyCleaner)
+	shutdown.Add("settings listener", stopSettings)
+	shutdown.Add("revocation list", stopRevocations)
+	shutdown.Add("RabbitMQ buffer", rmqConn.Flush)
+	shutdown.AddCloser("Postgres", db.Close)
+	shutdown.Add("RabbitMQ", func(context.Context) error { return rmqConn.Close() })
+
+	shutdown.Wait()
 }
@@ -0,0 +1,358 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"ride-hail/internal/auth/repo"
+	"ride-hail/internal/shared/auth"
+	"ride-hail/internal/shared/config"
+	"ride-hail/internal/shared/db"
+	"ride-hail/internal/shared/events"
+	"ride-hail/internal/shared/migrate"
+	"ride-hail/internal/shared/mq"
+	"ride-hail/internal/shared/privacy"
+	"ride-hail/internal/shared/revocation"
+	"ride-hail/internal/shared/util"
+	"ride-hail/migrations"
+	"text/tabwriter"
+)
+
+const usage = `usage: ridehail <command> [arguments]
+
+commands:
+  dlq list <queue> [-n N]      show dead-lettered messages of a queue
+  dlq replay <queue> [-n N]    move dead-lettered messages back to the queue
+  events export [-out DIR]     write the JSON schemas of all event contracts
+  events check                 fail if the contracts differ from the committed schemas
+  migrate up                   apply every pending migration
+  migrate down [-n N]          revert the last N migrations (default 1)
+  migrate status               list migrations and whether they are applied
+  migrate redo                 revert the latest migration and apply it again
+  migrate seed                 load the development data from migrations/seeds
+  keys generate -kid ID        write a new JWT signing key pair [-alg EdDSA|RS256] [-out DIR]
+  users set-role USER ROLE     assign a role, e.g. to create the first admin
+  users export USER [-out F]   write everything stored about a user to a ZIP file
+  users erase USER -yes        anonymize a user, keeping financial records
+                               (USER is an email address or a user id)
+
+dlq, migrate and users read config.yaml like the services: -config FILE
+selects another file and -set path=value overrides one value.
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "dlq":
+		err = runDLQ(os.Args[2:])
+	case "events":
+		err = runEvents(os.Args[2:])
+	case "migrate":
+		err = runMigrate(os.Args[2:])
+	case "keys":
+		err = runKeys(os.Args[2:])
+	case "users":
+		err = runUsers(os.Args[2:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+func runDLQ(args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("dlq needs a subcommand and a queue name\n%s", usage)
+	}
+	action, queue := args[0], args[1]
+
+	fs := flag.NewFlagSet("dlq", flag.ExitOnError)
+	limit := fs.Int("n", 100, "maximum number of messages")
+	loadConfig := config.Flags(fs)
+	fs.Parse(args[2:])
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	conn, err := mq.Dial(&cfg.RabbitMQ)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	switch action {
+	case "list":
+		letters, err := conn.InspectDeadLetters(queue, *limit)
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(letters)
+	case "replay":
+		n, err := conn.ReplayDeadLetters(context.Background(), queue, *limit)
+		fmt.Printf("replayed %d messages to %s\n", n, queue)
+		return err
+	default:
+		return fmt.Errorf("unknown dlq subcommand %q\n%s", action, usage)
+	}
+}
+
+func runEvents(args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("events needs a subcommand\n%s", usage)
+	}
+
+	fs := flag.NewFlagSet("events", flag.ExitOnError)
+	out := fs.String("out", "internal/shared/events/schemas", "directory for the schema files")
+	fs.Parse(args[1:])
+
+	switch args[0] {
+	case "export":
+		if err := os.MkdirAll(*out, 0o755); err != nil {
+			return err
+		}
+		for _, c := range events.Contracts {
+			schema, err := events.Schema(c)
+			if err != nil {
+				return err
+			}
+			path := filepath.Join(*out, events.SchemaFileName(c))
+			if err := os.WriteFile(path, schema, 0o644); err != nil {
+				return err
+			}
+			fmt.Println("wrote", path)
+		}
+		return nil
+	case "check":
+		if err := events.CheckGolden(); err != nil {
+			return err
+		}
+		fmt.Println("event contracts match the committed schemas")
+		return nil
+	default:
+		return fmt.Errorf("unknown events subcommand %q\n%s", args[0], usage)
+	}
+}
+
+func runMigrate(args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("migrate needs a subcommand\n%s", usage)
+	}
+
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	steps := fs.Int("n", 1, "number of migrations to revert")
+	loadConfig := config.Flags(fs)
+	fs.Parse(args[1:])
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	pool := db.ConnectToDB(&cfg.Database)
+	defer pool.Close()
+
+	runner, err := migrate.New(pool, migrations.FS, util.New())
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		applied, err := runner.Up(ctx)
+		fmt.Printf("applied %d migrations\n", len(applied))
+		return err
+	case "down":
+		if *steps < 1 {
+			return fmt.Errorf("-n must be at least 1")
+		}
+		reverted, err := runner.Down(ctx, *steps)
+		fmt.Printf("reverted %d migrations\n", len(reverted))
+		return err
+	case "redo":
+		m, err := runner.Redo(ctx)
+		if err != nil {
+			return err
+		}
+		if m == nil {
+			fmt.Println("no migration to redo")
+			return nil
+		}
+		fmt.Printf("redid %03d_%s\n", m.Version, m.Name)
+		return nil
+	case "status":
+		statuses, err := runner.Status(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT\tNOTE")
+		for _, s := range statuses {
+			appliedAt := "pending"
+			if s.Applied() {
+				appliedAt = s.AppliedAt.Local().Format("2006-01-02 15:04:05")
+			}
+			note := ""
+			switch {
+			case s.Missing:
+				note = "no file in this build"
+			case s.Modified:
+				note = "file changed after it was applied"
+			}
+			fmt.Fprintf(w, "%03d\t%s\t%s\t%s\n", s.Version, s.Name, appliedAt, note)
+		}
+		return w.Flush()
+	case "seed":
+		names, err := runner.Seed(ctx, migrations.Seeds)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("ran %d seed files\n", len(names))
+		return nil
+	default:
+		return fmt.Errorf("unknown migrate subcommand %q\n%s", args[0], usage)
+	}
+}
+
+func runKeys(args []string) error {
+	if len(args) < 1 || args[0] != "generate" {
+		return fmt.Errorf("keys needs the generate subcommand\n%s", usage)
+	}
+
+	fs := flag.NewFlagSet("keys", flag.ExitOnError)
+	kid := fs.String("kid", "", "key id, e.g. 2026-10")
+	alg := fs.String("alg", auth.AlgEdDSA, "signing algorithm: EdDSA or RS256")
+	out := fs.String("out", "keys", "directory for the key files")
+	fs.Parse(args[1:])
+
+	if *kid == "" {
+		return fmt.Errorf("-kid is required")
+	}
+
+	key, err := auth.GenerateKey(*alg)
+	if err != nil {
+		return err
+	}
+	private, err := auth.EncodePrivateKey(key)
+	if err != nil {
+		return err
+	}
+	public, err := auth.EncodePublicKey(key.Public())
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(*out, 0o755); err != nil {
+		return err
+	}
+	privatePath := filepath.Join(*out, *kid+".pem")
+	publicPath := filepath.Join(*out, *kid+".pub.pem")
+	if err := os.WriteFile(privatePath, private, 0o600); err != nil {
+		return err
+	}
+	if err := os.WriteFile(publicPath, public, 0o644); err != nil {
+		return err
+	}
+
+	fmt.Printf("wrote %s and %s\n\nadd to jwt.keys in config.yaml:\n", privatePath, publicPath)
+	fmt.Printf("    - id: %s\n      algorithm: %s\n      private_key_file: %s\n      public_key_file: %s\n", *kid, *alg, privatePath, publicPath)
+	return nil
+}
+
+// runUsers works on users directly in the database. Admins normally use the
+// admin API; set-role is for the first admin, who has no one to ask, and
+// export and erase answer data subject requests from the command line.
+func runUsers(args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("users needs a subcommand and a user\n%s", usage)
+	}
+	action, ref, rest := args[0], args[1], args[2:]
+
+	var role string
+	switch action {
+	case "set-role":
+		if len(rest) < 1 || !auth.ValidRole(rest[0]) {
+			return fmt.Errorf("set-role needs a role, one of %v", auth.Roles())
+		}
+		role, rest = rest[0], rest[1:]
+	case "export", "erase":
+	default:
+		return fmt.Errorf("unknown users subcommand %q\n%s", action, usage)
+	}
+
+	fs := flag.NewFlagSet("users", flag.ExitOnError)
+	loadConfig := config.Flags(fs)
+	out := fs.String("out", "", "export file (default user-ID.zip)")
+	yes := fs.Bool("yes", false, "confirm the erasure")
+	fs.Parse(rest)
+
+	if action == "erase" && !*yes {
+		return fmt.Errorf("erasure cannot be undone; run again with -yes")
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	pool := db.ConnectToDB(&cfg.Database)
+	defer pool.Close()
+
+	ctx := context.Background()
+	userID, err := privacy.ResolveUser(ctx, pool, ref)
+	if err != nil {
+		return fmt.Errorf("user %s: %w", ref, err)
+	}
+
+	switch action {
+	case "set-role":
+		rev := revocation.User(userID, cfg.JWT.AccessTokenTTL, revocation.ReasonRoleChanged)
+		previous, err := repo.NewAuthRepo(pool).SetUserRole(ctx, userID, role, rev)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s: %s -> %s\n", ref, previous, role)
+	case "export":
+		path := *out
+		if path == "" {
+			path = "user-" + userID + ".zip"
+		}
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if err != nil {
+			return err
+		}
+		if err := privacy.Export(ctx, pool, userID, f); err != nil {
+			f.Close()
+			os.Remove(path)
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+		fmt.Printf("wrote %s\n", path)
+	case "erase":
+		report, err := privacy.Erase(ctx, pool, userID, cfg.JWT.AccessTokenTTL)
+		if err != nil {
+			return err
+		}
+		data, _ := json.MarshalIndent(report, "", "  ")
+		fmt.Println(string(data))
+	}
+	return nil
+}
@@ -3,14 +3,26 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"math"
+	"net"
 	"net/http"
+	"ride-hail/internal/auth/app"
 	"ride-hail/internal/ride/domain"
+	"ride-hail/internal/shared/auth"
+	"ride-hail/internal/shared/models"
 	"ride-hail/internal/shared/util"
+	"strconv"
 	"time"
 )
 
+const (
+	defaultLockoutLimit = 50
+	maxLockoutLimit     = 500
+)
+
 func (h *Handler) Register(w http.ResponseWriter, r *http.Request) {
-	logger := util.New()
+	logger := util.New().WithContext(r.Context())
 	start := time.Now()
 
 	logger.Info("RegisterHandler", "incoming register request")
@@ -35,8 +47,12 @@ func (h *Handler) Register(w http.ResponseWriter, r *http.Request) {
 	user, err := h.service.Register(ctx, req.Email, req.Password, req.Role, req.Name, req.Phone)
 	if err != nil {
 		logger.Error("RegisterHandler", err)
-		util.WriteJSONError(w, err.Error(), http.StatusConflict)
-		logger.HTTP(http.StatusConflict, time.Since(start), r.RemoteAddr, r.Method, r.URL.Path)
+		status := http.StatusConflict
+		if errors.Is(err, app.ErrInvalidPhone) || errors.Is(err, app.ErrRoleNotAllowed) {
+			status = http.StatusBadRequest
+		}
+		util.WriteJSONError(w, err.Error(), status)
+		logger.HTTP(status, time.Since(start), r.RemoteAddr, r.Method, r.URL.Path)
 		return
 	}
 
@@ -55,7 +71,7 @@ func (h *Handler) Register(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
-	logger := util.New()
+	logger := util.New().WithContext(r.Context())
 	start := time.Now()
 
 	logger.Info("LoginHandler", "incoming login request")
@@ -70,28 +86,466 @@ func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ctx := context.Background()
-	token, user, err := h.service.Login(ctx, req.Email, req.Password)
+	device := req.Device
+	if device == "" {
+		device = r.UserAgent()
+	}
+
+	tokens, user, err := h.service.Login(r.Context(), req.Email, req.Password, device, clientIP(r))
 	if err != nil {
-		logger.Error("LoginHandler", err)
-		util.WriteJSONError(w, err.Error(), http.StatusUnauthorized)
-		logger.HTTP(http.StatusUnauthorized, time.Since(start), r.RemoteAddr, r.Method, r.URL.Path)
+		status := http.StatusUnauthorized
+		var blocked *app.LoginBlockedError
+		switch {
+		case errors.As(err, &blocked):
+			status = http.StatusTooManyRequests
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(blocked.RetryAfter.Seconds()))))
+			util.WriteJSONError(w, err.Error(), status)
+		case errors.Is(err, app.ErrInvalidCredentials):
+			util.WriteJSONError(w, err.Error(), status)
+		case errors.Is(err, app.ErrAccountInactive), errors.Is(err, app.ErrEmailNotVerified):
+			status = http.StatusForbidden
+			util.WriteJSONError(w, err.Error(), status)
+		default:
+			logger.Error("LoginHandler", err)
+			status = http.StatusInternalServerError
+			util.WriteJSONError(w, "failed to log in", status)
+		}
+		logger.HTTP(status, time.Since(start), r.RemoteAddr, r.Method, r.URL.Path)
 		return
 	}
 
-	resp := map[string]interface{}{
-		"access_token": token,
-		"token_type":   "Bearer",
-		"expires_in":   3600,
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	_ = json.NewEncoder(w).Encode(tokenResponse(tokens, user))
+
+	logger.OK("LoginHandler", "user logged in successfully: "+user.ID)
+	logger.HTTP(http.StatusOK, time.Since(start), r.RemoteAddr, r.Method, r.URL.Path)
+}
+
+// clientIP is the address failed logins are counted by. X-Forwarded-For is
+// not trusted, as clients could rotate it freely.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func tokenResponse(tokens *app.Tokens, user *models.User) map[string]interface{} {
+	return map[string]interface{}{
+		"access_token":       tokens.AccessToken,
+		"token_type":         "Bearer",
+		"expires_in":         int(time.Until(tokens.AccessExpiresAt).Seconds()),
+		"refresh_token":      tokens.RefreshToken,
+		"refresh_expires_in": int(time.Until(tokens.RefreshExpiresAt).Seconds()),
 		"user": map[string]interface{}{
 			"user_id": user.ID,
 			"email":   user.Email,
+			"phone":   user.Phone,
 			"role":    user.Role,
 		},
 	}
+}
+
+func decodeRefreshRequest(r *http.Request) (string, bool) {
+	var req domain.RefreshRequest
+	if !decodeStrict(r, &req) || req.RefreshToken == "" {
+		return "", false
+	}
+	return req.RefreshToken, true
+}
+
+func (h *Handler) Refresh(w http.ResponseWriter, r *http.Request) {
+	logger := util.New().WithContext(r.Context())
+	start := time.Now()
+
+	refreshToken, ok := decodeRefreshRequest(r)
+	if !ok {
+		util.WriteJSONError(w, "refresh_token is required", http.StatusBadRequest)
+		logger.HTTP(http.StatusBadRequest, time.Since(start), r.RemoteAddr, r.Method, r.URL.Path)
+		return
+	}
+
+	tokens, user, err := h.service.Refresh(r.Context(), refreshToken)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, app.ErrInvalidRefreshToken) {
+			status = http.StatusUnauthorized
+		}
+		util.WriteJSONError(w, errorMessage(err, "failed to refresh token"), status)
+		logger.HTTP(status, time.Since(start), r.RemoteAddr, r.Method, r.URL.Path)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(resp)
+	w.Header().Set("Cache-Control", "no-store")
+	_ = json.NewEncoder(w).Encode(tokenResponse(tokens, user))
+	logger.HTTP(http.StatusOK, time.Since(start), r.RemoteAddr, r.Method, r.URL.Path)
+}
 
-	logger.OK("LoginHandler", "user logged in successfully: "+user.ID)
+func (h *Handler) Logout(w http.ResponseWriter, r *http.Request) {
+	logger := util.New().WithContext(r.Context())
+	start := time.Now()
+
+	refreshToken, ok := decodeRefreshRequest(r)
+	if !ok {
+		util.WriteJSONError(w, "refresh_token is required", http.StatusBadRequest)
+		logger.HTTP(http.StatusBadRequest, time.Since(start), r.RemoteAddr, r.Method, r.URL.Path)
+		return
+	}
+
+	// an access token is optional; a valid one is revoked along with the session
+	claims, _ := auth.BearerClaims(r)
+
+	if err := h.service.Logout(r.Context(), refreshToken, claims); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, app.ErrInvalidRefreshToken) {
+			status = http.StatusUnauthorized
+		}
+		util.WriteJSONError(w, errorMessage(err, "failed to log out"), status)
+		logger.HTTP(status, time.Since(start), r.RemoteAddr, r.Method, r.URL.Path)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	logger.HTTP(http.StatusNoContent, time.Since(start), r.RemoteAddr, r.Method, r.URL.Path)
+}
+
+// LogoutAll needs an access token rather than a refresh token, so it also
+// works from a device whose own session was already revoked.
+func (h *Handler) LogoutAll(w http.ResponseWriter, r *http.Request) {
+	logger := util.New().WithContext(r.Context())
+	start := time.Now()
+
+	claims, err := auth.BearerClaims(r)
+	if err != nil {
+		auth.WriteAuthError(w, err)
+		logger.HTTP(http.StatusUnauthorized, time.Since(start), r.RemoteAddr, r.Method, r.URL.Path)
+		return
+	}
+
+	n, err := h.service.LogoutAll(r.Context(), claims.UserID)
+	if err != nil {
+		util.WriteJSONError(w, "failed to log out", http.StatusInternalServerError)
+		logger.HTTP(http.StatusInternalServerError, time.Since(start), r.RemoteAddr, r.Method, r.URL.Path)
+		return
+	}
+
+	util.ResponseInJson(w, http.StatusOK, map[string]interface{}{"revoked_tokens": n})
 	logger.HTTP(http.StatusOK, time.Since(start), r.RemoteAddr, r.Method, r.URL.Path)
 }
+
+func (h *Handler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	logger := util.New().WithContext(r.Context())
+	start := time.Now()
+
+	var req domain.VerifyEmailRequest
+	if !decodeStrict(r, &req) || req.Token == "" {
+		util.WriteJSONError(w, "token is required", http.StatusBadRequest)
+		logger.HTTP(http.StatusBadRequest, time.Since(start), r.RemoteAddr, r.Method, r.URL.Path)
+		return
+	}
+
+	status := http.StatusOK
+	err := h.service.VerifyEmail(r.Context(), req.Token)
+	switch {
+	case errors.Is(err, app.ErrInvalidEmailToken):
+		status = http.StatusBadRequest
+		util.WriteJSONError(w, err.Error(), status)
+	case err != nil:
+		status = http.StatusInternalServerError
+		util.WriteJSONError(w, "failed to verify email", status)
+	default:
+		util.ResponseInJson(w, status, map[string]interface{}{"message": "email verified, you can log in now"})
+	}
+	logger.HTTP(status, time.Since(start), r.RemoteAddr, r.Method, r.URL.Path)
+}
+
+// ResendVerification always answers 202, whether or not the account exists
+// or is already verified.
+func (h *Handler) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	logger := util.New().WithContext(r.Context())
+	start := time.Now()
+
+	var req domain.ResendVerificationRequest
+	if !decodeStrict(r, &req) || req.Email == "" {
+		util.WriteJSONError(w, "email is required", http.StatusBadRequest)
+		logger.HTTP(http.StatusBadRequest, time.Since(start), r.RemoteAddr, r.Method, r.URL.Path)
+		return
+	}
+
+	h.service.ResendVerification(r.Context(), req.Email)
+
+	util.ResponseInJson(w, http.StatusAccepted, map[string]interface{}{
+		"message": "if the account exists and is not verified, a verification email is on its way",
+	})
+	logger.HTTP(http.StatusAccepted, time.Since(start), r.RemoteAddr, r.Method, r.URL.Path)
+}
+
+// ForgotPassword always answers 202, whether or not the account exists.
+func (h *Handler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	logger := util.New().WithContext(r.Context())
+	start := time.Now()
+
+	var req domain.ForgotPasswordRequest
+	if !decodeStrict(r, &req) || req.Email == "" {
+		util.WriteJSONError(w, "email is required", http.StatusBadRequest)
+		logger.HTTP(http.StatusBadRequest, time.Since(start), r.RemoteAddr, r.Method, r.URL.Path)
+		return
+	}
+
+	h.service.ForgotPassword(r.Context(), req.Email)
+
+	util.ResponseInJson(w, http.StatusAccepted, map[string]interface{}{
+		"message": "if the account exists, a password reset email is on its way",
+	})
+	logger.HTTP(http.StatusAccepted, time.Since(start), r.RemoteAddr, r.Method, r.URL.Path)
+}
+
+func (h *Handler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	logger := util.New().WithContext(r.Context())
+	start := time.Now()
+
+	var req domain.ResetPasswordRequest
+	if !decodeStrict(r, &req) || req.Token == "" || req.Password == "" {
+		util.WriteJSONError(w, "token and password are required", http.StatusBadRequest)
+		logger.HTTP(http.StatusBadRequest, time.Since(start), r.RemoteAddr, r.Method, r.URL.Path)
+		return
+	}
+
+	status := http.StatusOK
+	err := h.service.ResetPassword(r.Context(), req.Token, req.Password)
+	switch {
+	case errors.Is(err, app.ErrInvalidEmailToken), errors.Is(err, app.ErrWeakPassword):
+		status = http.StatusBadRequest
+		util.WriteJSONError(w, err.Error(), status)
+	case err != nil:
+		status = http.StatusInternalServerError
+		util.WriteJSONError(w, "failed to reset password", status)
+	default:
+		util.ResponseInJson(w, status, map[string]interface{}{"message": "password changed, log in with the new password"})
+	}
+	logger.HTTP(status, time.Since(start), r.RemoteAddr, r.Method, r.URL.Path)
+}
+
+// RequestPhoneCode answers 202 for every well-formed number that is not
+// throttled, whether or not it is registered.
+func (h *Handler) RequestPhoneCode(w http.ResponseWriter, r *http.Request) {
+	logger := util.New().WithContext(r.Context())
+	start := time.Now()
+
+	var req domain.PhoneCodeRequest
+	if !decodeStrict(r, &req) || req.Phone == "" {
+		util.WriteJSONError(w, "phone is required", http.StatusBadRequest)
+		logger.HTTP(http.StatusBadRequest, time.Since(start), r.RemoteAddr, r.Method, r.URL.Path)
+		return
+	}
+
+	status := http.StatusAccepted
+	err := h.service.RequestPhoneCode(r.Context(), req.Phone, clientIP(r))
+	var throttled *app.PhoneCodeThrottledError
+	switch {
+	case errors.As(err, &throttled):
+		status = http.StatusTooManyRequests
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+		util.WriteJSONError(w, err.Error(), status)
+	case errors.Is(err, app.ErrInvalidPhone):
+		status = http.StatusBadRequest
+		util.WriteJSONError(w, err.Error(), status)
+	case err != nil:
+		status = http.StatusInternalServerError
+		util.WriteJSONError(w, "failed to send code", status)
+	default:
+		util.ResponseInJson(w, status, map[string]interface{}{
+			"message": "if the number is registered, a code is on its way",
+		})
+	}
+	logger.HTTP(status, time.Since(start), r.RemoteAddr, r.Method, r.URL.Path)
+}
+
+func (h *Handler) LoginWithPhoneCode(w http.ResponseWriter, r *http.Request) {
+	logger := util.New().WithContext(r.Context())
+	start := time.Now()
+
+	var req domain.PhoneLoginRequest
+	if !decodeStrict(r, &req) || req.Phone == "" || req.Code == "" {
+		util.WriteJSONError(w, "phone and code are required", http.StatusBadRequest)
+		logger.HTTP(http.StatusBadRequest, time.Since(start), r.RemoteAddr, r.Method, r.URL.Path)
+		return
+	}
+
+	device := req.Device
+	if device == "" {
+		device = r.UserAgent()
+	}
+
+	tokens, user, err := h.service.LoginWithPhoneCode(r.Context(), req.Phone, req.Code, device, clientIP(r))
+	if err != nil {
+		status := http.StatusUnauthorized
+		var blocked *app.LoginBlockedError
+		switch {
+		case errors.As(err, &blocked):
+			status = http.StatusTooManyRequests
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(blocked.RetryAfter.Seconds()))))
+			util.WriteJSONError(w, err.Error(), status)
+		case errors.Is(err, app.ErrInvalidPhone):
+			status = http.StatusBadRequest
+			util.WriteJSONError(w, err.Error(), status)
+		case errors.Is(err, app.ErrInvalidPhoneCode):
+			util.WriteJSONError(w, err.Error(), status)
+		case errors.Is(err, app.ErrAccountInactive), errors.Is(err, app.ErrEmailNotVerified):
+			status = http.StatusForbidden
+			util.WriteJSONError(w, err.Error(), status)
+		default:
+			logger.Error("PhoneLoginHandler", err)
+			status = http.StatusInternalServerError
+			util.WriteJSONError(w, "failed to log in", status)
+		}
+		logger.HTTP(status, time.Since(start), r.RemoteAddr, r.Method, r.URL.Path)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	_ = json.NewEncoder(w).Encode(tokenResponse(tokens, user))
+
+	logger.OK("PhoneLoginHandler", "user logged in with phone code: "+user.ID)
+	logger.HTTP(http.StatusOK, time.Since(start), r.RemoteAddr, r.Method, r.URL.Path)
+}
+
+func decodeStrict(r *http.Request, v interface{}) bool {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(v) == nil
+}
+
+// SetUserStatus lets admins ban, deactivate or reactivate a user.
+func (h *Handler) SetUserStatus(w http.ResponseWriter, r *http.Request) {
+	logger := util.New().WithContext(r.Context())
+	start := time.Now()
+
+	var req struct {
+		Status string `json:"status"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		util.WriteJSONError(w, "invalid JSON body", http.StatusBadRequest)
+		logger.HTTP(http.StatusBadRequest, time.Since(start), r.RemoteAddr, r.Method, r.URL.Path)
+		return
+	}
+
+	userID := r.PathValue("user_id")
+	status := http.StatusOK
+	err := h.service.SetUserStatus(r.Context(), userID, req.Status, auth.Subject(r))
+	switch {
+	case errors.Is(err, app.ErrInvalidStatus):
+		status = http.StatusBadRequest
+		util.WriteJSONError(w, err.Error(), status)
+	case errors.Is(err, app.ErrUserNotFound):
+		status = http.StatusNotFound
+		util.WriteJSONError(w, err.Error(), status)
+	case err != nil:
+		status = http.StatusInternalServerError
+		util.WriteJSONError(w, "failed to update user status", status)
+	default:
+		util.ResponseInJson(w, status, map[string]interface{}{"user_id": userID, "status": req.Status})
+	}
+	logger.HTTP(status, time.Since(start), r.RemoteAddr, r.Method, r.URL.Path)
+}
+
+// SetUserRole lets admins change a user's role. Admins get 403 for their own
+// account.
+func (h *Handler) SetUserRole(w http.ResponseWriter, r *http.Request) {
+	logger := util.New().WithContext(r.Context())
+	start := time.Now()
+
+	var req struct {
+		Role string `json:"role"`
+	}
+	if !decodeStrict(r, &req) {
+		util.WriteJSONError(w, "invalid JSON body", http.StatusBadRequest)
+		logger.HTTP(http.StatusBadRequest, time.Since(start), r.RemoteAddr, r.Method, r.URL.Path)
+		return
+	}
+
+	userID := r.PathValue("user_id")
+	status := http.StatusOK
+	err := h.service.SetUserRole(r.Context(), userID, req.Role, auth.Subject(r))
+	switch {
+	case errors.Is(err, app.ErrInvalidRole):
+		status = http.StatusBadRequest
+		util.WriteJSONError(w, err.Error(), status)
+	case errors.Is(err, app.ErrOwnRole):
+		status = http.StatusForbidden
+		util.WriteJSONError(w, err.Error(), status)
+	case errors.Is(err, app.ErrUserNotFound):
+		status = http.StatusNotFound
+		util.WriteJSONError(w, err.Error(), status)
+	case err != nil:
+		status = http.StatusInternalServerError
+		util.WriteJSONError(w, "failed to update user role", status)
+	default:
+		util.ResponseInJson(w, status, map[string]interface{}{"user_id": userID, "role": req.Role})
+	}
+	logger.HTTP(status, time.Since(start), r.RemoteAddr, r.Method, r.URL.Path)
+}
+
+// ListLockouts serves the lockout audit trail. ?active=true leaves out
+// lockouts that expired or were cleared.
+func (h *Handler) ListLockouts(w http.ResponseWriter, r *http.Request) {
+	logger := util.New().WithContext(r.Context())
+	start := time.Now()
+
+	limit := defaultLockoutLimit
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxLockoutLimit {
+			util.WriteJSONError(w, "limit must be between 1 and "+strconv.Itoa(maxLockoutLimit), http.StatusBadRequest)
+			logger.HTTP(http.StatusBadRequest, time.Since(start), r.RemoteAddr, r.Method, r.URL.Path)
+			return
+		}
+		limit = n
+	}
+
+	lockouts, err := h.service.ListLockouts(r.Context(), r.URL.Query().Get("active") == "true", limit)
+	if err != nil {
+		logger.Error("ListLockoutsHandler", err)
+		util.WriteJSONError(w, "failed to list lockouts", http.StatusInternalServerError)
+		logger.HTTP(http.StatusInternalServerError, time.Since(start), r.RemoteAddr, r.Method, r.URL.Path)
+		return
+	}
+
+	util.ResponseInJson(w, http.StatusOK, map[string]interface{}{"lockouts": lockouts})
+	logger.HTTP(http.StatusOK, time.Since(start), r.RemoteAddr, r.Method, r.URL.Path)
+}
+
+// ClearLockout lifts the backoff or lockout of an account or client IP.
+func (h *Handler) ClearLockout(w http.ResponseWriter, r *http.Request) {
+	logger := util.New().WithContext(r.Context())
+	start := time.Now()
+
+	status := http.StatusNoContent
+	err := h.service.ClearLockout(r.Context(), r.PathValue("kind"), r.PathValue("subject"), auth.Subject(r))
+	switch {
+	case errors.Is(err, app.ErrInvalidLockoutKind):
+		status = http.StatusBadRequest
+		util.WriteJSONError(w, err.Error(), status)
+	case errors.Is(err, app.ErrLockoutNotFound):
+		status = http.StatusNotFound
+		util.WriteJSONError(w, err.Error(), status)
+	case err != nil:
+		status = http.StatusInternalServerError
+		util.WriteJSONError(w, "failed to clear lockout", status)
+	default:
+		w.WriteHeader(status)
+	}
+	logger.HTTP(status, time.Since(start), r.RemoteAddr, r.Method, r.URL.Path)
+}
+
+// errorMessage hides internal errors from clients.
+func errorMessage(err error, internal string) string {
+	if errors.Is(err, app.ErrInvalidRefreshToken) {
+		return err.Error()
+	}
+	return internal
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"ride-hail/internal/auth/app"
+	"ride-hail/internal/shared/auth"
+	"ride-hail/internal/shared/util"
+	"time"
+)
+
+// ExportUser streams the ZIP archive of a user's data.
+func (h *Handler) ExportUser(w http.ResponseWriter, r *http.Request) {
+	logger := util.New().WithContext(r.Context())
+	start := time.Now()
+
+	userID := r.PathValue("user_id")
+	zw := &zipResponse{w: w, name: "user-" + userID + ".zip"}
+	err := h.service.ExportUser(r.Context(), userID, auth.Subject(r), zw)
+	status := http.StatusOK
+	switch {
+	case err != nil && zw.started:
+		// the status is sent; abort so the client does not keep a cut-off archive
+		logger.HTTP(status, time.Since(start), r.RemoteAddr, r.Method, r.URL.Path)
+		panic(http.ErrAbortHandler)
+	case errors.Is(err, app.ErrUserNotFound):
+		status = http.StatusNotFound
+		util.WriteJSONError(w, err.Error(), status)
+	case err != nil:
+		status = http.StatusInternalServerError
+		util.WriteJSONError(w, "failed to export user data", status)
+	}
+	logger.HTTP(status, time.Since(start), r.RemoteAddr, r.Method, r.URL.Path)
+}
+
+// zipResponse sends the archive headers with the first bytes written, so an
+// export that fails before writing anything can still answer with an error.
+type zipResponse struct {
+	w       http.ResponseWriter
+	name    string
+	started bool
+}
+
+func (z *zipResponse) Write(p []byte) (int, error) {
+	if !z.started {
+		z.started = true
+		z.w.Header().Set("Content-Type", "application/zip")
+		z.w.Header().Set("Content-Disposition", `attachment; filename="`+z.name+`"`)
+		z.w.Header().Set("Cache-Control", "no-store")
+		z.w.WriteHeader(http.StatusOK)
+	}
+	return z.w.Write(p)
+}
+
+func (h *Handler) EraseUser(w http.ResponseWriter, r *http.Request) {
+	logger := util.New().WithContext(r.Context())
+	start := time.Now()
+
+	report, err := h.service.EraseUser(r.Context(), r.PathValue("user_id"), auth.Subject(r))
+	status := http.StatusOK
+	switch {
+	case errors.Is(err, app.ErrUserNotFound):
+		status = http.StatusNotFound
+		util.WriteJSONError(w, err.Error(), status)
+	case errors.Is(err, app.ErrEraseOwnAdmin):
+		status = http.StatusForbidden
+		util.WriteJSONError(w, err.Error(), status)
+	case errors.Is(err, app.ErrUserErased), errors.Is(err, app.ErrUserRideOpen):
+		status = http.StatusConflict
+		util.WriteJSONError(w, err.Error(), status)
+	case err != nil:
+		status = http.StatusInternalServerError
+		util.WriteJSONError(w, "failed to erase user", status)
+	default:
+		util.ResponseInJson(w, status, report)
+	}
+	logger.HTTP(status, time.Since(start), r.RemoteAddr, r.Method, r.URL.Path)
+}
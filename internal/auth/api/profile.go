@@ -0,0 +1,222 @@
+package api
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"ride-hail/internal/auth/app"
+	"ride-hail/internal/ride/domain"
+	"ride-hail/internal/shared/auth"
+	"ride-hail/internal/shared/util"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func (h *Handler) GetProfile(w http.ResponseWriter, r *http.Request) {
+	logger := util.New().WithContext(r.Context())
+	start := time.Now()
+
+	status := http.StatusOK
+	profile, err := h.service.GetProfile(r.Context(), auth.Subject(r))
+	switch {
+	case errors.Is(err, app.ErrUserNotFound):
+		status = http.StatusNotFound
+		util.WriteJSONError(w, err.Error(), status)
+	case err != nil:
+		status = http.StatusInternalServerError
+		util.WriteJSONError(w, "failed to get profile", status)
+	default:
+		util.ResponseInJson(w, status, profile)
+	}
+	logger.HTTP(status, time.Since(start), r.RemoteAddr, r.Method, r.URL.Path)
+}
+
+func (h *Handler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
+	logger := util.New().WithContext(r.Context())
+	start := time.Now()
+
+	var req domain.UpdateProfileRequest
+	if !decodeStrict(r, &req) {
+		util.WriteJSONError(w, "invalid JSON body", http.StatusBadRequest)
+		logger.HTTP(http.StatusBadRequest, time.Since(start), r.RemoteAddr, r.Method, r.URL.Path)
+		return
+	}
+
+	status := http.StatusOK
+	profile, err := h.service.UpdateProfile(r.Context(), auth.Subject(r), app.ProfileChanges{
+		Name:             req.Name,
+		Phone:            req.Phone,
+		Locale:           req.Locale,
+		AvatarURL:        req.AvatarURL,
+		EmergencyContact: req.EmergencyContact,
+	})
+	switch {
+	case errors.Is(err, app.ErrInvalidProfile), errors.Is(err, app.ErrInvalidPhone):
+		status = http.StatusBadRequest
+		util.WriteJSONError(w, err.Error(), status)
+	case errors.Is(err, app.ErrUserNotFound):
+		status = http.StatusNotFound
+		util.WriteJSONError(w, err.Error(), status)
+	case err != nil:
+		status = http.StatusInternalServerError
+		util.WriteJSONError(w, "failed to update profile", status)
+	default:
+		util.ResponseInJson(w, status, profile)
+	}
+	logger.HTTP(status, time.Since(start), r.RemoteAddr, r.Method, r.URL.Path)
+}
+
+// DeactivateAccount sets the caller's account INACTIVE and ends all of its
+// sessions.
+func (h *Handler) DeactivateAccount(w http.ResponseWriter, r *http.Request) {
+	logger := util.New().WithContext(r.Context())
+	start := time.Now()
+
+	status := http.StatusOK
+	err := h.service.DeactivateAccount(r.Context(), auth.Subject(r))
+	switch {
+	case errors.Is(err, app.ErrUserNotFound):
+		status = http.StatusNotFound
+		util.WriteJSONError(w, err.Error(), status)
+	case err != nil:
+		status = http.StatusInternalServerError
+		util.WriteJSONError(w, "failed to deactivate account", status)
+	default:
+		util.ResponseInJson(w, status, map[string]interface{}{"message": "account deactivated, all sessions ended"})
+	}
+	logger.HTTP(status, time.Since(start), r.RemoteAddr, r.Method, r.URL.Path)
+}
+
+// RequestPhoneVerification texts a code to the caller's unverified number.
+func (h *Handler) RequestPhoneVerification(w http.ResponseWriter, r *http.Request) {
+	logger := util.New().WithContext(r.Context())
+	start := time.Now()
+
+	status := http.StatusAccepted
+	err := h.service.RequestPhoneVerification(r.Context(), auth.Subject(r), clientIP(r))
+	if err == nil {
+		util.ResponseInJson(w, status, map[string]interface{}{"message": "a code was sent to your phone"})
+	} else {
+		status = writePhoneVerifyError(w, err)
+	}
+	logger.HTTP(status, time.Since(start), r.RemoteAddr, r.Method, r.URL.Path)
+}
+
+// VerifyPhone marks the caller's number verified, which allows logging in
+// with it.
+func (h *Handler) VerifyPhone(w http.ResponseWriter, r *http.Request) {
+	logger := util.New().WithContext(r.Context())
+	start := time.Now()
+
+	var req domain.VerifyPhoneRequest
+	if !decodeStrict(r, &req) || req.Code == "" {
+		util.WriteJSONError(w, "code is required", http.StatusBadRequest)
+		logger.HTTP(http.StatusBadRequest, time.Since(start), r.RemoteAddr, r.Method, r.URL.Path)
+		return
+	}
+
+	status := http.StatusOK
+	profile, err := h.service.VerifyPhone(r.Context(), auth.Subject(r), req.Code)
+	if err == nil {
+		util.ResponseInJson(w, status, profile)
+	} else {
+		status = writePhoneVerifyError(w, err)
+	}
+	logger.HTTP(status, time.Since(start), r.RemoteAddr, r.Method, r.URL.Path)
+}
+
+func writePhoneVerifyError(w http.ResponseWriter, err error) int {
+	var throttled *app.PhoneCodeThrottledError
+	status := http.StatusBadRequest
+	switch {
+	case errors.As(err, &throttled):
+		status = http.StatusTooManyRequests
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+		util.WriteJSONError(w, err.Error(), status)
+	case errors.Is(err, app.ErrNoPhoneToVerify), errors.Is(err, app.ErrInvalidPhoneCode):
+		util.WriteJSONError(w, err.Error(), status)
+	case errors.Is(err, app.ErrPhoneTaken):
+		status = http.StatusConflict
+		util.WriteJSONError(w, err.Error(), status)
+	case errors.Is(err, app.ErrUserNotFound):
+		status = http.StatusNotFound
+		util.WriteJSONError(w, err.Error(), status)
+	default:
+		status = http.StatusInternalServerError
+		util.WriteJSONError(w, "failed to verify phone", status)
+	}
+	return status
+}
+
+func (h *Handler) ChangeEmail(w http.ResponseWriter, r *http.Request) {
+	logger := util.New().WithContext(r.Context())
+	start := time.Now()
+
+	var req domain.ChangeEmailRequest
+	if !decodeStrict(r, &req) || req.Email == "" || req.CurrentPassword == "" {
+		util.WriteJSONError(w, "email and current_password are required", http.StatusBadRequest)
+		logger.HTTP(http.StatusBadRequest, time.Since(start), r.RemoteAddr, r.Method, r.URL.Path)
+		return
+	}
+
+	err := h.service.ChangeEmail(r.Context(), auth.Subject(r), req.Email, req.CurrentPassword, clientIP(r))
+	status := writeReauthError(w, err, "failed to change email")
+	if status == http.StatusOK {
+		util.ResponseInJson(w, status, map[string]interface{}{
+			"email":   strings.TrimSpace(req.Email),
+			"message": "a verification link was sent to the new address",
+		})
+	}
+	logger.HTTP(status, time.Since(start), r.RemoteAddr, r.Method, r.URL.Path)
+}
+
+func (h *Handler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	logger := util.New().WithContext(r.Context())
+	start := time.Now()
+
+	var req domain.ChangePasswordRequest
+	if !decodeStrict(r, &req) || req.CurrentPassword == "" || req.NewPassword == "" {
+		util.WriteJSONError(w, "current_password and new_password are required", http.StatusBadRequest)
+		logger.HTTP(http.StatusBadRequest, time.Since(start), r.RemoteAddr, r.Method, r.URL.Path)
+		return
+	}
+
+	err := h.service.ChangePassword(r.Context(), auth.Subject(r), req.CurrentPassword, req.NewPassword, clientIP(r))
+	status := writeReauthError(w, err, "failed to change password")
+	if status == http.StatusOK {
+		util.ResponseInJson(w, status, map[string]interface{}{"message": "password changed, log in with the new password"})
+	}
+	logger.HTTP(status, time.Since(start), r.RemoteAddr, r.Method, r.URL.Path)
+}
+
+// writeReauthError answers for changes that need the current password, and
+// returns 200 without writing when err is nil.
+func writeReauthError(w http.ResponseWriter, err error, internal string) int {
+	var blocked *app.LoginBlockedError
+	status := http.StatusOK
+	switch {
+	case err == nil:
+		return status
+	case errors.As(err, &blocked):
+		status = http.StatusTooManyRequests
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(blocked.RetryAfter.Seconds()))))
+		util.WriteJSONError(w, err.Error(), status)
+	case errors.Is(err, app.ErrWrongPassword):
+		status = http.StatusForbidden
+		util.WriteJSONError(w, err.Error(), status)
+	case errors.Is(err, app.ErrInvalidEmail), errors.Is(err, app.ErrEmailUnchanged), errors.Is(err, app.ErrWeakPassword):
+		status = http.StatusBadRequest
+		util.WriteJSONError(w, err.Error(), status)
+	case errors.Is(err, app.ErrEmailTaken):
+		status = http.StatusConflict
+		util.WriteJSONError(w, err.Error(), status)
+	case errors.Is(err, app.ErrUserNotFound):
+		status = http.StatusNotFound
+		util.WriteJSONError(w, err.Error(), status)
+	default:
+		status = http.StatusInternalServerError
+		util.WriteJSONError(w, internal, status)
+	}
+	return status
+}
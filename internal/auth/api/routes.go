@@ -3,6 +3,9 @@ package api
 import (
 	"net/http"
 	"ride-hail/internal/auth/app"
+	"ride-hail/internal/shared/auth"
+	"ride-hail/internal/shared/metrics"
+	"ride-hail/internal/shared/util"
 )
 
 type Handler struct {
@@ -17,5 +20,29 @@ func (h *Handler) RegisterRoutes() *http.ServeMux {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/auth/register", h.Register)
 	mux.HandleFunc("/auth/login", h.Login)
+	mux.HandleFunc("POST /auth/refresh", h.Refresh)
+	mux.HandleFunc("POST /auth/logout", h.Logout)
+	mux.HandleFunc("POST /auth/logout-all", h.LogoutAll)
+	mux.HandleFunc("POST /auth/verify", h.VerifyEmail)
+	mux.HandleFunc("POST /auth/verify/resend", h.ResendVerification)
+	mux.HandleFunc("POST /auth/password/forgot", h.ForgotPassword)
+	mux.HandleFunc("POST /auth/password/reset", h.ResetPassword)
+	mux.HandleFunc("POST /auth/otp/request", h.RequestPhoneCode)
+	mux.HandleFunc("POST /auth/otp/verify", h.LoginWithPhoneCode)
+	mux.Handle("GET /users/me", auth.RequirePermission(auth.PermProfileManage, http.HandlerFunc(h.GetProfile)))
+	mux.Handle("PATCH /users/me", auth.RequirePermission(auth.PermProfileManage, http.HandlerFunc(h.UpdateProfile)))
+	mux.Handle("DELETE /users/me", auth.RequirePermission(auth.PermProfileManage, http.HandlerFunc(h.DeactivateAccount)))
+	mux.Handle("POST /users/me/phone/code", auth.RequirePermission(auth.PermProfileManage, http.HandlerFunc(h.RequestPhoneVerification)))
+	mux.Handle("POST /users/me/phone/verify", auth.RequirePermission(auth.PermProfileManage, http.HandlerFunc(h.VerifyPhone)))
+	mux.Handle("PUT /users/me/email", auth.RequirePermission(auth.PermProfileManage, http.HandlerFunc(h.ChangeEmail)))
+	mux.Handle("PUT /users/me/password", auth.RequirePermission(auth.PermProfileManage, http.HandlerFunc(h.ChangePassword)))
+	mux.Handle("PUT /admin/users/{user_id}/status", auth.RequirePermission(auth.PermUserStatus, http.HandlerFunc(h.SetUserStatus)))
+	mux.Handle("PUT /admin/users/{user_id}/role", auth.RequirePermission(auth.PermUserRoles, http.HandlerFunc(h.SetUserRole)))
+	mux.Handle("GET /admin/users/{user_id}/export", auth.RequirePermission(auth.PermUserPrivacy, http.HandlerFunc(h.ExportUser)))
+	mux.Handle("POST /admin/users/{user_id}/erase", auth.RequirePermission(auth.PermUserPrivacy, http.HandlerFunc(h.EraseUser)))
+	mux.Handle("GET /admin/lockouts", auth.RequirePermission(auth.PermLockoutsManage, http.HandlerFunc(h.ListLockouts)))
+	mux.Handle("DELETE /admin/lockouts/{kind}/{subject}", auth.RequirePermission(auth.PermLockoutsManage, http.HandlerFunc(h.ClearLockout)))
+	mux.Handle("/admin/log-level", auth.RequirePermission(auth.PermSettingsManage, util.LogLevelHandler()))
+	mux.Handle("GET /metrics", metrics.Handler())
 	return mux
 }
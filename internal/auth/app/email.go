@@ -0,0 +1,218 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"ride-hail/internal/auth/repo"
+	"ride-hail/internal/shared/mail"
+	"ride-hail/internal/shared/models"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	minPasswordLength = 8
+	// emailInterval limits how often verification or reset emails go to one account.
+	emailInterval = time.Minute
+	// mailTimeout bounds emails sent after the request has been answered.
+	mailTimeout = 30 * time.Second
+)
+
+var (
+	ErrInvalidEmailToken = repo.ErrEmailTokenInvalid
+	ErrEmailNotVerified  = errors.New("email address is not verified")
+	ErrWeakPassword      = fmt.Errorf("password must be at least %d characters", minPasswordLength)
+)
+
+const verifyEmailBody = `Welcome to Ride Hail!
+
+Confirm your email address by opening this link:
+
+%s
+
+Or send this token to POST /auth/verify:
+
+%s
+
+The link expires in %s. If you did not sign up, ignore this email.
+`
+
+const resetPasswordBody = `Someone asked to reset the password of your Ride Hail account.
+
+Choose a new password by opening this link:
+
+%s
+
+Or send this token with your new password to POST /auth/password/reset:
+
+%s
+
+The link expires in %s and works once. If you did not ask for this, ignore
+this email; your password stays the same.
+`
+
+// StopBackground waits for the emails and texts that are still being sent.
+// It is a step of the graceful shutdown.
+func (s *AuthService) StopBackground(ctx context.Context) error {
+	return s.background.Stop(ctx)
+}
+
+// sendInBackground emails user a token of purpose after the request has been
+// answered.
+func (s *AuthService) sendInBackground(ctx context.Context, instance string, user *models.User, purpose string) {
+	s.background.Go(ctx, mailTimeout, func(ctx context.Context) {
+		logger := s.logger.WithContext(ctx)
+		if err := s.sendEmailToken(ctx, user, purpose); err != nil {
+			logger.Error(instance, fmt.Errorf("failed to send %s email: %w", purpose, err))
+			return
+		}
+		logger.OK(instance, fmt.Sprintf("%s email sent [user_id=%s]", purpose, user.ID))
+	})
+}
+
+// sendEmailToken creates a token of purpose for user and emails it.
+func (s *AuthService) sendEmailToken(ctx context.Context, user *models.User, purpose string) error {
+	token, hash, err := newSecret()
+	if err != nil {
+		return fmt.Errorf("failed to generate email token: %w", err)
+	}
+
+	ttl, path, subject, body := s.verifyTTL, "/verify-email", "Confirm your email address", verifyEmailBody
+	if purpose == models.TokenPurposeResetPassword {
+		ttl, path, subject, body = s.resetTTL, "/reset-password", "Reset your password", resetPasswordBody
+	}
+
+	now := time.Now()
+	t := models.EmailToken{ID: uuid.NewString(), UserID: user.ID, Purpose: purpose, CreatedAt: now, ExpiresAt: now.Add(ttl)}
+	if err := s.repo.CreateEmailToken(ctx, t, hash); err != nil {
+		return err
+	}
+
+	link := strings.TrimRight(s.publicURL, "/") + path + "?token=" + url.QueryEscape(token)
+	return s.mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: subject,
+		Body:    fmt.Sprintf(body, link, token, ttl),
+	})
+}
+
+// VerifyEmail uses a verification token and activates the account.
+func (s *AuthService) VerifyEmail(ctx context.Context, token string) error {
+	logger := s.logger.WithContext(ctx)
+	instance := "AuthService.VerifyEmail"
+
+	userID, err := s.repo.VerifyEmail(ctx, hashSecret(token))
+	if err != nil {
+		if errors.Is(err, ErrInvalidEmailToken) {
+			logger.Warn(instance, "invalid or expired verification token presented")
+			return err
+		}
+		logger.Error(instance, err)
+		return err
+	}
+
+	logger.OK(instance, fmt.Sprintf("email verified [user_id=%s]", userID))
+	return nil
+}
+
+// ForgotPassword emails a reset link when the account exists and may log in.
+// It returns before anything is looked up or sent, so neither the response
+// nor its timing tells whether the account exists.
+func (s *AuthService) ForgotPassword(ctx context.Context, email string) {
+	s.background.Go(ctx, mailTimeout, func(ctx context.Context) {
+		s.emailAccount(ctx, "AuthService.ForgotPassword", email, models.TokenPurposeResetPassword)
+	})
+}
+
+// ResendVerification emails a new verification link when the account exists
+// and its address is not verified yet. Like ForgotPassword, it returns before
+// anything is looked up.
+func (s *AuthService) ResendVerification(ctx context.Context, email string) {
+	s.background.Go(ctx, mailTimeout, func(ctx context.Context) {
+		s.emailAccount(ctx, "AuthService.ResendVerification", email, models.TokenPurposeVerifyEmail)
+	})
+}
+
+// emailAccount sends a token of purpose to the account with the address,
+// unless it does not exist, may not log in, got one within emailInterval or,
+// for verification, is already verified.
+func (s *AuthService) emailAccount(ctx context.Context, instance, email, purpose string) {
+	logger := s.logger.WithContext(ctx)
+
+	user, err := s.repo.GetUserByEmail(ctx, email)
+	if errors.Is(err, pgx.ErrNoRows) {
+		logger.Info(instance, fmt.Sprintf("no %s email, account does not exist [email=%s]", purpose, email))
+		return
+	}
+	if err != nil {
+		logger.Error(instance, err)
+		return
+	}
+	if user.Status == "BANNED" || user.Status == "INACTIVE" {
+		logger.Warn(instance, fmt.Sprintf("no %s email for %s user [user_id=%s]", purpose, user.Status, user.ID))
+		return
+	}
+
+	if purpose == models.TokenPurposeVerifyEmail {
+		profile, err := s.repo.GetProfile(ctx, user.ID)
+		if err != nil {
+			logger.Error(instance, err)
+			return
+		}
+		if profile.EmailVerified {
+			logger.Info(instance, fmt.Sprintf("no verification email, address already verified [user_id=%s]", user.ID))
+			return
+		}
+	}
+
+	last, err := s.repo.LastEmailTokenAt(ctx, user.ID, purpose)
+	if err != nil {
+		logger.Error(instance, err)
+		return
+	}
+	if time.Since(last) < emailInterval {
+		logger.Warn(instance, fmt.Sprintf("%s email throttled [user_id=%s]", purpose, user.ID))
+		return
+	}
+
+	if err := s.sendEmailToken(ctx, user, purpose); err != nil {
+		logger.Error(instance, fmt.Errorf("failed to send %s email: %w", purpose, err))
+		return
+	}
+	logger.OK(instance, fmt.Sprintf("%s email sent [user_id=%s]", purpose, user.ID))
+}
+
+// ResetPassword uses a reset token to set a new password. All sessions of the
+// user end and their access tokens are revoked.
+func (s *AuthService) ResetPassword(ctx context.Context, token, password string) error {
+	logger := s.logger.WithContext(ctx)
+	instance := "AuthService.ResetPassword"
+
+	if len(password) < minPasswordLength {
+		return ErrWeakPassword
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		logger.Error(instance, fmt.Errorf("failed to hash password: %w", err))
+		return err
+	}
+
+	userID, err := s.repo.ResetPassword(ctx, hashSecret(token), string(hash), s.accessTTL)
+	if err != nil {
+		if errors.Is(err, ErrInvalidEmailToken) {
+			logger.Warn(instance, "invalid or expired reset token presented")
+			return err
+		}
+		logger.Error(instance, err)
+		return err
+	}
+
+	logger.OK(instance, fmt.Sprintf("password reset, all sessions revoked [user_id=%s]", userID))
+	return nil
+}
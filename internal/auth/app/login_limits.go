@@ -0,0 +1,138 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"ride-hail/internal/shared/models"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	// ErrInvalidCredentials is returned for unknown accounts and wrong
+	// passwords alike, so responses do not reveal which accounts exist.
+	ErrInvalidCredentials = errors.New("invalid email or password")
+	ErrAccountInactive    = errors.New("account is not active")
+
+	ErrLockoutNotFound    = errors.New("no failed logins recorded for this key")
+	ErrInvalidLockoutKind = errors.New("kind must be account or ip")
+)
+
+// LoginBlockedError is returned while an account or client IP is backing off
+// or locked out. It looks the same for registered and unknown accounts.
+type LoginBlockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginBlockedError) Error() string {
+	return "too many failed login attempts, try again later"
+}
+
+// maxBackoffShift keeps the doubling from overflowing.
+const maxBackoffShift = 30
+
+// dummyHash is compared against when the account does not exist, so unknown
+// accounts take as long to reject as wrong passwords.
+var dummyHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("not a password"), bcrypt.DefaultCost)
+	return hash
+})
+
+func loginKeys(email, ip string) []models.LoginKey {
+	keys := []models.LoginKey{{Kind: models.LoginKeyAccount, Subject: strings.ToLower(strings.TrimSpace(email))}}
+	if ip != "" {
+		keys = append(keys, models.LoginKey{Kind: models.LoginKeyIP, Subject: ip})
+	}
+	return keys
+}
+
+// blockFor is how long a key is blocked after its failures-th failure, and
+// whether that is a lockout rather than a backoff.
+func (s *AuthService) blockFor(kind string, failures int) (time.Duration, bool) {
+	limits := s.loginLimits
+	maxFailures := limits.AccountMaxFailures
+	if kind == models.LoginKeyIP {
+		maxFailures = limits.IPMaxFailures
+	}
+
+	if failures < maxFailures {
+		return min(doubled(limits.BackoffBase, failures-1), limits.LockoutDuration), false
+	}
+	return min(doubled(limits.LockoutDuration, failures-maxFailures), limits.MaxLockout), true
+}
+
+func doubled(d time.Duration, times int) time.Duration {
+	times = min(times, maxBackoffShift)
+	if float64(d)*math.Exp2(float64(times)) > math.MaxInt64 {
+		return math.MaxInt64
+	}
+	return d << times
+}
+
+func (s *AuthService) checkLoginAllowed(ctx context.Context, keys []models.LoginKey) error {
+	until, err := s.repo.LoginBlockedUntil(ctx, keys...)
+	if err != nil {
+		return err
+	}
+	if wait := time.Until(until); wait > 0 {
+		return &LoginBlockedError{RetryAfter: wait}
+	}
+	return nil
+}
+
+func (s *AuthService) recordLoginFailure(ctx context.Context, keys []models.LoginKey) {
+	logger := s.logger.WithContext(ctx)
+	instance := "AuthService.Login"
+
+	for _, key := range keys {
+		failures, err := s.repo.RecordLoginFailure(ctx, key, s.loginLimits.FailureWindow)
+		if err != nil {
+			logger.Error(instance, err)
+			continue
+		}
+
+		d, lockout := s.blockFor(key.Kind, failures)
+		if d <= 0 {
+			continue
+		}
+		if err := s.repo.BlockLogin(ctx, key, time.Now().Add(d), failures, lockout); err != nil {
+			logger.Error(instance, err)
+			continue
+		}
+		if lockout {
+			logger.Warn(instance, fmt.Sprintf("%s %s locked out for %s after %d failed logins", key.Kind, key.Subject, d, failures))
+		}
+	}
+}
+
+// ListLockouts returns the lockout audit trail, latest first.
+func (s *AuthService) ListLockouts(ctx context.Context, activeOnly bool, limit int) ([]models.LoginLockout, error) {
+	return s.repo.ListLockouts(ctx, activeOnly, limit)
+}
+
+// ClearLockout lets an admin lift the backoff or lockout of an account or IP.
+func (s *AuthService) ClearLockout(ctx context.Context, kind, subject, actor string) error {
+	if kind != models.LoginKeyAccount && kind != models.LoginKeyIP {
+		return ErrInvalidLockoutKind
+	}
+	key := models.LoginKey{Kind: kind, Subject: subject}
+	if kind == models.LoginKeyAccount {
+		key = loginKeys(subject, "")[0]
+	}
+
+	cleared, err := s.repo.ClearLockout(ctx, key, actor)
+	if err != nil {
+		s.logger.WithContext(ctx).Error("AuthService.ClearLockout", err)
+		return err
+	}
+	if !cleared {
+		return ErrLockoutNotFound
+	}
+	s.logger.WithContext(ctx).Warn("AuthService.ClearLockout", fmt.Sprintf("%s %s cleared by %s", key.Kind, key.Subject, actor))
+	return nil
+}
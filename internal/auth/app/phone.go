@@ -0,0 +1,297 @@
+package app
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"ride-hail/internal/shared/auth"
+	"ride-hail/internal/shared/models"
+	"ride-hail/internal/shared/util"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// smsTimeout bounds texts sent after the request has been answered.
+const smsTimeout = 30 * time.Second
+
+var (
+	ErrInvalidPhone = util.ErrInvalidPhone
+	// ErrInvalidPhoneCode covers wrong, used, expired and exhausted codes, and
+	// codes for numbers without an account.
+	ErrInvalidPhoneCode = errors.New("invalid or expired code")
+	ErrNoPhoneToVerify  = errors.New("no phone number waiting for verification")
+)
+
+// PhoneCodeThrottledError is returned when codes for a phone were requested
+// too recently or too often.
+type PhoneCodeThrottledError struct {
+	RetryAfter time.Duration
+}
+
+func (e *PhoneCodeThrottledError) Error() string {
+	return "a code was sent recently, try again later"
+}
+
+const (
+	phoneCodeText       = "Your Ride Hail code is %s. It expires in %s. Do not share it with anyone."
+	phoneVerifyCodeText = "Your Ride Hail code to confirm this number is %s. It expires in %s."
+)
+
+// phoneLoginRoles may log in with a text message code. Admins use passwords.
+var phoneLoginRoles = map[string]bool{auth.RolePassenger: true, auth.RoleDriver: true}
+
+func newPhoneCode(length int) (string, error) {
+	n, err := rand.Int(rand.Reader, new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(length)), nil))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", length, n), nil
+}
+
+// hashPhoneCode binds a code to its phone, so a code hash is only good for
+// the number it was sent to.
+func hashPhoneCode(phone, code string) string {
+	return hashSecret(phone + ":" + code)
+}
+
+// issuePhoneCode stores a new code for phone after checking the resend
+// interval and the hourly limits of the phone and of the client ip.
+func (s *AuthService) issuePhoneCode(ctx context.Context, instance, phone, ip string) (string, error) {
+	logger := s.logger.WithContext(ctx)
+
+	now := time.Now()
+	if ip != "" {
+		requested, first, err := s.repo.PhoneOTPsFromIP(ctx, ip, now.Add(-time.Hour))
+		if err != nil {
+			logger.Error(instance, err)
+			return "", err
+		}
+		if requested >= s.otp.MaxPerIPPerHour {
+			logger.Warn(instance, fmt.Sprintf("hourly code limit reached [ip=%s]", ip))
+			return "", &PhoneCodeThrottledError{RetryAfter: first.Add(time.Hour).Sub(now)}
+		}
+	}
+
+	sent, first, last, err := s.repo.PhoneOTPsSince(ctx, phone, now.Add(-time.Hour))
+	if err != nil {
+		logger.Error(instance, err)
+		return "", err
+	}
+	if wait := last.Add(s.otp.ResendInterval).Sub(now); wait > 0 {
+		logger.Warn(instance, fmt.Sprintf("code requested again too soon [phone=%s]", phone))
+		return "", &PhoneCodeThrottledError{RetryAfter: wait}
+	}
+	if sent >= s.otp.MaxPerHour {
+		logger.Warn(instance, fmt.Sprintf("hourly code limit reached [phone=%s]", phone))
+		return "", &PhoneCodeThrottledError{RetryAfter: first.Add(time.Hour).Sub(now)}
+	}
+
+	code, err := newPhoneCode(s.otp.CodeLength)
+	if err != nil {
+		logger.Error(instance, fmt.Errorf("failed to generate phone code: %w", err))
+		return "", err
+	}
+	otp := models.PhoneOTP{ID: uuid.NewString(), Phone: phone, RequestedIP: ip, CreatedAt: now, ExpiresAt: now.Add(s.otp.TTL)}
+	if err := s.repo.CreatePhoneOTP(ctx, otp, hashPhoneCode(phone, code)); err != nil {
+		logger.Error(instance, err)
+		return "", err
+	}
+	return code, nil
+}
+
+// RequestPhoneCode creates a login code for phone and texts it when the
+// number is verified by a passenger or driver who may log in. Throttling and
+// the stored code do not depend on the account, and the text is sent after
+// returning, so the outcome does not tell whether the number is registered.
+func (s *AuthService) RequestPhoneCode(ctx context.Context, phone, ip string) error {
+	instance := "AuthService.RequestPhoneCode"
+
+	phone, err := util.NormalizePhone(phone)
+	if err != nil {
+		return err
+	}
+
+	code, err := s.issuePhoneCode(ctx, instance, phone, ip)
+	if err != nil {
+		return err
+	}
+
+	s.background.Go(ctx, smsTimeout, func(ctx context.Context) {
+		logger := s.logger.WithContext(ctx)
+
+		user, err := s.repo.GetUserByPhone(ctx, phone)
+		if errors.Is(err, pgx.ErrNoRows) {
+			logger.Info(instance, fmt.Sprintf("no code sent, number not registered [phone=%s]", phone))
+			return
+		}
+		if err != nil {
+			logger.Error(instance, err)
+			return
+		}
+		if !phoneLoginRoles[user.Role] || user.Status == "BANNED" || user.Status == "INACTIVE" {
+			logger.Warn(instance, fmt.Sprintf("no code sent to %s %s user [user_id=%s]", user.Status, user.Role, user.ID))
+			return
+		}
+
+		if err := s.sms.Send(ctx, phone, fmt.Sprintf(phoneCodeText, code, s.otp.TTL)); err != nil {
+			logger.Error(instance, fmt.Errorf("failed to send phone code: %w", err))
+			return
+		}
+		logger.OK(instance, fmt.Sprintf("phone code sent [user_id=%s]", user.ID))
+	})
+	return nil
+}
+
+// LoginWithPhoneCode checks a code sent by RequestPhoneCode and starts a
+// session like Login does. Only verified numbers log in. Wrong codes count as
+// failed logins of the phone and the client ip, on top of the per-code
+// attempt limit.
+func (s *AuthService) LoginWithPhoneCode(ctx context.Context, phone, code, device, ip string) (*Tokens, *models.User, error) {
+	logger := s.logger.WithContext(ctx)
+	instance := "AuthService.LoginWithPhoneCode"
+
+	phone, err := util.NormalizePhone(phone)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keys := loginKeys(phone, ip)
+	if err := s.checkLoginAllowed(ctx, keys); err != nil {
+		logger.Warn(instance, fmt.Sprintf("login blocked [phone=%s, ip=%s]: %v", phone, ip, err))
+		return nil, nil, err
+	}
+
+	ok, err := s.repo.UsePhoneOTP(ctx, phone, hashPhoneCode(phone, code), s.otp.MaxAttempts)
+	if err != nil {
+		logger.Error(instance, err)
+		return nil, nil, err
+	}
+	if !ok {
+		logger.Warn(instance, fmt.Sprintf("invalid phone code [phone=%s, ip=%s]", phone, ip))
+		s.recordLoginFailure(ctx, keys)
+		return nil, nil, ErrInvalidPhoneCode
+	}
+
+	user, err := s.repo.GetUserByPhone(ctx, phone)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && !phoneLoginRoles[user.Role]) {
+		logger.Warn(instance, fmt.Sprintf("phone code login refused, no eligible account [phone=%s]", phone))
+		return nil, nil, ErrInvalidPhoneCode
+	}
+	if err != nil {
+		logger.Error(instance, err)
+		return nil, nil, err
+	}
+
+	if err := s.repo.ResetLoginFailures(ctx, keys[0]); err != nil {
+		logger.Error(instance, err)
+	}
+
+	if err := checkStatus(user); err != nil {
+		logger.Warn(instance, fmt.Sprintf("login refused for %s user [user_id=%s]", user.Status, user.ID))
+		return nil, nil, err
+	}
+
+	tokens, err := s.startSession(ctx, user, device)
+	if err != nil {
+		logger.Error(instance, err)
+		return nil, nil, err
+	}
+
+	logger.OK(instance, fmt.Sprintf("phone code login successful [user_id=%s, role=%s]", user.ID, user.Role))
+	return tokens, user, nil
+}
+
+// RequestPhoneVerification texts a code to the pending phone number of the
+// user, or to their unverified one. The number does not replace the current
+// one, and cannot be used to log in, until the code is entered with
+// VerifyPhone.
+func (s *AuthService) RequestPhoneVerification(ctx context.Context, userID, ip string) error {
+	logger := s.logger.WithContext(ctx)
+	instance := "AuthService.RequestPhoneVerification"
+
+	phone, err := s.unverifiedPhone(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	owner, err := s.repo.GetUserByPhone(ctx, phone)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		logger.Error(instance, err)
+		return err
+	}
+	if owner != nil {
+		logger.Warn(instance, fmt.Sprintf("number verified by another user [user_id=%s]", userID))
+		return ErrPhoneTaken
+	}
+
+	code, err := s.issuePhoneCode(ctx, instance, phone, ip)
+	if err != nil {
+		return err
+	}
+
+	sendCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), smsTimeout)
+	defer cancel()
+	if err := s.sms.Send(sendCtx, phone, fmt.Sprintf(phoneVerifyCodeText, code, s.otp.TTL)); err != nil {
+		logger.Error(instance, fmt.Errorf("failed to send phone code: %w", err))
+		return err
+	}
+	logger.OK(instance, fmt.Sprintf("phone verification code sent [user_id=%s]", userID))
+	return nil
+}
+
+// VerifyPhone checks a code sent by RequestPhoneVerification, makes the
+// number the user's verified phone and returns the new profile. A number verified by someone
+// else in the meantime stays theirs.
+func (s *AuthService) VerifyPhone(ctx context.Context, userID, code string) (*models.UserProfile, error) {
+	logger := s.logger.WithContext(ctx)
+	instance := "AuthService.VerifyPhone"
+
+	phone, err := s.unverifiedPhone(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	ok, err := s.repo.UsePhoneOTP(ctx, phone, hashPhoneCode(phone, code), s.otp.MaxAttempts)
+	if err != nil {
+		logger.Error(instance, err)
+		return nil, err
+	}
+	if !ok {
+		logger.Warn(instance, fmt.Sprintf("invalid phone code [user_id=%s]", userID))
+		return nil, ErrInvalidPhoneCode
+	}
+
+	if err := s.repo.ConfirmPhone(ctx, userID, phone); err != nil {
+		switch {
+		case errors.Is(err, ErrPhoneTaken):
+			logger.Warn(instance, fmt.Sprintf("number verified by another user [user_id=%s]", userID))
+			return nil, err
+		case errors.Is(err, pgx.ErrNoRows):
+			// the number was changed while the code was on its way
+			return nil, ErrInvalidPhoneCode
+		}
+		logger.Error(instance, err)
+		return nil, err
+	}
+
+	logger.OK(instance, fmt.Sprintf("phone verified [user_id=%s]", userID))
+	return s.GetProfile(ctx, userID)
+}
+
+func (s *AuthService) unverifiedPhone(ctx context.Context, userID string) (string, error) {
+	profile, err := s.GetProfile(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case profile.PendingPhone != "":
+		return profile.PendingPhone, nil
+	case profile.Phone != "" && !profile.PhoneVerified:
+		return profile.Phone, nil
+	}
+	return "", ErrNoPhoneToVerify
+}
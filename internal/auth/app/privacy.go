@@ -0,0 +1,69 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"ride-hail/internal/shared/privacy"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrUserErased    = privacy.ErrAlreadyErased
+	ErrUserRideOpen  = privacy.ErrActiveRide
+	ErrEraseOwnAdmin = errors.New("you cannot erase your own account")
+)
+
+// ExportUser writes the ZIP archive of everything stored about a user to w
+// as it is built. Nothing is written when the user does not exist.
+func (s *AuthService) ExportUser(ctx context.Context, userID, actor string, w io.Writer) error {
+	logger := s.logger.WithContext(ctx)
+	instance := "AuthService.ExportUser"
+
+	if uuid.Validate(userID) != nil {
+		return ErrUserNotFound
+	}
+
+	if err := s.repo.ExportUser(ctx, userID, w); err != nil {
+		if errors.Is(err, privacy.ErrUserNotFound) {
+			return ErrUserNotFound
+		}
+		logger.Error(instance, err)
+		return err
+	}
+
+	logger.Warn(instance, fmt.Sprintf("data of user %s exported by %s", userID, actor))
+	return nil
+}
+
+// EraseUser anonymizes a user and ends their sessions everywhere. Financial
+// records are kept; see privacy.Erase.
+func (s *AuthService) EraseUser(ctx context.Context, userID, actor string) (*privacy.Report, error) {
+	logger := s.logger.WithContext(ctx)
+	instance := "AuthService.EraseUser"
+
+	if uuid.Validate(userID) != nil {
+		return nil, ErrUserNotFound
+	}
+	if userID == actor {
+		return nil, ErrEraseOwnAdmin
+	}
+
+	report, err := s.repo.EraseUser(ctx, userID, s.accessTTL)
+	if err != nil {
+		switch {
+		case errors.Is(err, privacy.ErrUserNotFound):
+			return nil, ErrUserNotFound
+		case errors.Is(err, ErrUserErased), errors.Is(err, ErrUserRideOpen):
+			logger.Warn(instance, fmt.Sprintf("erasure of user %s refused: %v", userID, err))
+			return nil, err
+		}
+		logger.Error(instance, err)
+		return nil, err
+	}
+
+	logger.Warn(instance, fmt.Sprintf("user %s erased by %s", userID, actor))
+	return report, nil
+}
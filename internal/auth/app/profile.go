@@ -0,0 +1,258 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	netmail "net/mail"
+	"net/url"
+	"regexp"
+	"ride-hail/internal/auth/repo"
+	"ride-hail/internal/shared/mail"
+	"ride-hail/internal/shared/models"
+	"ride-hail/internal/shared/revocation"
+	"ride-hail/internal/shared/util"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/jackc/pgx/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	maxNameLength      = 100
+	maxEmailLength     = 100
+	maxAvatarURLLength = 2048
+)
+
+var (
+	ErrInvalidProfile = errors.New("invalid profile")
+	ErrInvalidEmail   = errors.New("invalid email address")
+	ErrEmailUnchanged = errors.New("email address is the same as the current one")
+	ErrEmailTaken     = repo.ErrEmailTaken
+	ErrPhoneTaken     = repo.ErrPhoneTaken
+	// ErrWrongPassword is returned when re-authentication fails.
+	ErrWrongPassword = errors.New("current password is incorrect")
+)
+
+// localePattern accepts BCP 47 tags such as "kk", "ru-KZ" or "zh-Hant-TW".
+var localePattern = regexp.MustCompile(`^[A-Za-z]{2,3}(-[A-Za-z0-9]{2,8}){0,3}$`)
+
+const emailChangedBody = `The email address of your Ride Hail account was changed to %s.
+
+If you did not do this, reset your password and contact support.
+`
+
+// ProfileChanges is a PATCH of the profile. Nil fields stay as they are and
+// empty values remove them.
+type ProfileChanges struct {
+	Name             *string
+	Phone            *string
+	Locale           *string
+	AvatarURL        *string
+	EmergencyContact *models.EmergencyContact
+}
+
+func (s *AuthService) GetProfile(ctx context.Context, userID string) (*models.UserProfile, error) {
+	profile, err := s.repo.GetProfile(ctx, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		s.logger.WithContext(ctx).Error("AuthService.GetProfile", err)
+		return nil, err
+	}
+	return profile, nil
+}
+
+// UpdateProfile validates and applies c, and returns the new profile. A new
+// phone number is kept as pending_phone and only replaces the current one
+// once verified with RequestPhoneVerification and VerifyPhone.
+func (s *AuthService) UpdateProfile(ctx context.Context, userID string, c ProfileChanges) (*models.UserProfile, error) {
+	logger := s.logger.WithContext(ctx)
+	instance := "AuthService.UpdateProfile"
+
+	u, err := profileUpdate(c)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.UpdateProfile(ctx, userID, u); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+		logger.Error(instance, err)
+		return nil, err
+	}
+
+	logger.OK(instance, fmt.Sprintf("profile updated [user_id=%s]", userID))
+	return s.GetProfile(ctx, userID)
+}
+
+func profileUpdate(c ProfileChanges) (models.ProfileUpdate, error) {
+	u := models.ProfileUpdate{Set: map[string]interface{}{}}
+	put := func(key string, value *string) {
+		switch {
+		case value == nil:
+		case *value == "":
+			u.Unset = append(u.Unset, key)
+		default:
+			u.Set[key] = *value
+		}
+	}
+
+	if c.Name != nil {
+		name := strings.TrimSpace(*c.Name)
+		if utf8.RuneCountInString(name) > maxNameLength {
+			return u, fmt.Errorf("%w: name must be at most %d characters", ErrInvalidProfile, maxNameLength)
+		}
+		put("name", &name)
+	}
+
+	if c.Locale != nil && *c.Locale != "" && !localePattern.MatchString(*c.Locale) {
+		return u, fmt.Errorf("%w: locale must be a language tag such as en or ru-KZ", ErrInvalidProfile)
+	}
+	put("locale", c.Locale)
+
+	if c.AvatarURL != nil && *c.AvatarURL != "" {
+		if len(*c.AvatarURL) > maxAvatarURLLength {
+			return u, fmt.Errorf("%w: avatar_url must be at most %d characters", ErrInvalidProfile, maxAvatarURLLength)
+		}
+		if parsed, err := url.Parse(*c.AvatarURL); err != nil || parsed.Scheme != "https" || parsed.Host == "" {
+			return u, fmt.Errorf("%w: avatar_url must be an https URL", ErrInvalidProfile)
+		}
+	}
+	put("avatar_url", c.AvatarURL)
+
+	if c.Phone != nil {
+		phone := *c.Phone
+		if phone != "" {
+			normalized, err := util.NormalizePhone(phone)
+			if err != nil {
+				return u, err
+			}
+			phone = normalized
+		}
+		u.Phone = &phone
+	}
+
+	if ec := c.EmergencyContact; ec != nil {
+		name := strings.TrimSpace(ec.Name)
+		switch {
+		case name == "" && ec.Phone == "":
+			u.Unset = append(u.Unset, "emergency_contact")
+		case name == "" || utf8.RuneCountInString(name) > maxNameLength:
+			return u, fmt.Errorf("%w: emergency_contact.name must be 1 to %d characters", ErrInvalidProfile, maxNameLength)
+		default:
+			phone, err := util.NormalizePhone(ec.Phone)
+			if err != nil {
+				return u, fmt.Errorf("%w: emergency_contact.%w", ErrInvalidProfile, err)
+			}
+			u.Set["emergency_contact"] = models.EmergencyContact{Name: name, Phone: phone}
+		}
+	}
+	return u, nil
+}
+
+// reauthenticate checks the current password of a signed-in user before a
+// sensitive change. Wrong passwords count as failed logins of the account and
+// the client ip, so a stolen access token cannot be used to guess it.
+func (s *AuthService) reauthenticate(ctx context.Context, userID, password, ip string) (*models.User, error) {
+	user, err := s.repo.GetUserByID(ctx, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	keys := loginKeys(user.Email, ip)
+	if err := s.checkLoginAllowed(ctx, keys); err != nil {
+		return nil, err
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil {
+		s.logger.WithContext(ctx).Warn("AuthService.reauthenticate", fmt.Sprintf("wrong current password [user_id=%s, ip=%s]", userID, ip))
+		s.recordLoginFailure(ctx, keys)
+		return nil, ErrWrongPassword
+	}
+	return user, nil
+}
+
+// ChangeEmail moves the account to a new address after checking the password.
+// The new address is unverified until the link sent to it is opened, and the
+// old address is told about the change.
+func (s *AuthService) ChangeEmail(ctx context.Context, userID, email, password, ip string) error {
+	logger := s.logger.WithContext(ctx)
+	instance := "AuthService.ChangeEmail"
+
+	email = strings.TrimSpace(email)
+	if addr, err := netmail.ParseAddress(email); err != nil || addr.Address != email || len(email) > maxEmailLength {
+		return ErrInvalidEmail
+	}
+
+	user, err := s.reauthenticate(ctx, userID, password, ip)
+	if err != nil {
+		return err
+	}
+	if strings.EqualFold(user.Email, email) {
+		return ErrEmailUnchanged
+	}
+
+	if err := s.repo.ChangeEmail(ctx, userID, email); err != nil {
+		if errors.Is(err, ErrEmailTaken) {
+			return err
+		}
+		logger.Error(instance, err)
+		return err
+	}
+	logger.OK(instance, fmt.Sprintf("email changed [user_id=%s]", userID))
+
+	oldEmail := user.Email
+	user.Email = email
+	s.sendInBackground(ctx, instance, user, models.TokenPurposeVerifyEmail)
+	s.background.Go(ctx, mailTimeout, func(ctx context.Context) {
+		if err := s.mailer.Send(ctx, mail.Message{
+			To:      oldEmail,
+			Subject: "Your email address was changed",
+			Body:    fmt.Sprintf(emailChangedBody, email),
+		}); err != nil {
+			s.logger.WithContext(ctx).Error(instance, fmt.Errorf("failed to notify old address: %w", err))
+		}
+	})
+	return nil
+}
+
+// ChangePassword sets a new password after checking the current one. Every
+// session ends, this one included, and access tokens are revoked.
+func (s *AuthService) ChangePassword(ctx context.Context, userID, current, password, ip string) error {
+	logger := s.logger.WithContext(ctx)
+	instance := "AuthService.ChangePassword"
+
+	if len(password) < minPasswordLength {
+		return ErrWeakPassword
+	}
+	if _, err := s.reauthenticate(ctx, userID, current, ip); err != nil {
+		return err
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		logger.Error(instance, fmt.Errorf("failed to hash password: %w", err))
+		return err
+	}
+	rev := revocation.User(userID, s.accessTTL, revocation.ReasonPasswordChanged)
+	if err := s.repo.ChangePassword(ctx, userID, string(hash), rev); err != nil {
+		logger.Error(instance, err)
+		return err
+	}
+
+	logger.OK(instance, fmt.Sprintf("password changed, all sessions revoked [user_id=%s]", userID))
+	return nil
+}
+
+// DeactivateAccount sets the user's own account INACTIVE. Like an admin
+// deactivation it ends every session and revokes access tokens everywhere, so
+// no new rides can be requested; only an admin can reactivate the account.
+func (s *AuthService) DeactivateAccount(ctx context.Context, userID string) error {
+	return s.SetUserStatus(ctx, userID, "INACTIVE", userID)
+}
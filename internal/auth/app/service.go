@@ -4,10 +4,14 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"ride-hail/internal/auth/jwt"
 	"ride-hail/internal/auth/repo"
+	"ride-hail/internal/shared/auth"
+	"ride-hail/internal/shared/lifecycle"
+	"ride-hail/internal/shared/mail"
 	"ride-hail/internal/shared/models"
+	"ride-hail/internal/shared/sms"
 	"ride-hail/internal/shared/util"
+	"slices"
 	"time"
 
 	"github.com/google/uuid"
@@ -16,33 +20,75 @@ import (
 )
 
 type AuthService struct {
-	repo   *repo.AuthRepo
-	logger *util.Logger
+	repo        *repo.AuthRepo
+	issuer      *auth.Issuer
+	accessTTL   time.Duration
+	refreshTTL  time.Duration
+	loginLimits models.LoginLimitsConfig
+	mailer      mail.Mailer
+	publicURL   string
+	verifyTTL   time.Duration
+	resetTTL    time.Duration
+	sms         sms.SMSSender
+	otp         models.OTPConfig
+	logger      *util.Logger
+
+	// emails and texts are sent after the response, see StopBackground
+	background lifecycle.Tasks
 }
 
-func NewAuthService(r *repo.AuthRepo, logger *util.Logger) *AuthService {
-	return &AuthService{repo: r, logger: logger}
+func NewAuthService(r *repo.AuthRepo, issuer *auth.Issuer, mailer mail.Mailer, smsSender sms.SMSSender, cfg *models.Config, logger *util.Logger) *AuthService {
+	authCfg := cfg.Services.AuthService
+	return &AuthService{
+		repo:        r,
+		issuer:      issuer,
+		accessTTL:   cfg.JWT.AccessTokenTTL,
+		refreshTTL:  cfg.JWT.RefreshTokenTTL,
+		loginLimits: authCfg.LoginLimits,
+		mailer:      mailer,
+		publicURL:   authCfg.PublicURL,
+		verifyTTL:   authCfg.VerifyTokenTTL,
+		resetTTL:    authCfg.ResetTokenTTL,
+		sms:         smsSender,
+		otp:         authCfg.OTP,
+		logger:      logger,
+	}
 }
 
 func (s *AuthService) Register(ctx context.Context, email, password, role, name, phone string) (*models.User, error) {
+	logger := s.logger.WithContext(ctx)
 	instance := "AuthService.Register"
 	start := time.Now()
 
-	s.logger.Info(instance, fmt.Sprintf("attempting to register new user [email=%s, role=%s]", email, role))
+	logger.Info(instance, fmt.Sprintf("attempting to register new user [email=%s, role=%s]", email, role))
+
+	if !slices.Contains(selfRegistrationRoles, role) {
+		logger.Warn(instance, fmt.Sprintf("registration refused for role %s [email=%s]", role, email))
+		return nil, ErrRoleNotAllowed
+	}
+
+	if phone != "" {
+		normalized, err := util.NormalizePhone(phone)
+		if err != nil {
+			logger.Warn(instance, fmt.Sprintf("invalid phone number [email=%s]", email))
+			return nil, err
+		}
+		phone = normalized
+	}
 
 	existingUser, err := s.repo.GetUserByEmail(ctx, email)
 	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
-		s.logger.Error(instance, fmt.Errorf("failed to check existing user: %w", err))
+		logger.Error(instance, fmt.Errorf("failed to check existing user: %w", err))
 		return nil, fmt.Errorf("failed to check existing user: %w", err)
 	}
 	if existingUser != nil {
-		s.logger.Warn(instance, fmt.Sprintf("user with email %s already exists", email))
+		logger.Warn(instance, fmt.Sprintf("user with email %s already exists", email))
 		return nil, fmt.Errorf("user with email %s already exists", email)
 	}
 
 	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
-		s.logger.Error(instance, fmt.Errorf("failed to hash password: %w", err))
+		logger.Error(instance, fmt.Errorf("failed to hash password: %w", err))
 		return nil, fmt.Errorf("failed to hash password: %w", err)
 	}
 
@@ -51,72 +97,93 @@ func (s *AuthService) Register(ctx context.Context, email, password, role, name,
 	user := &models.User{
 		ID:           id,
 		Email:        email,
+		Phone:        phone,
 		Role:         role,
-		Status:       "ACTIVE",
+		Status:       "PENDING",
 		PasswordHash: string(hash),
 		Attrs: map[string]interface{}{
-			"name":  name,
-			"phone": phone,
+			"name": name,
 		},
 	}
 
-	s.logger.Info(instance, fmt.Sprintf("creating user record in DB [id=%s]", id))
+	logger.Info(instance, fmt.Sprintf("creating user record in DB [id=%s]", id))
 	if err := s.repo.CreateUser(ctx, user); err != nil {
-		s.logger.Error(instance, fmt.Errorf("failed to create user in DB: %w", err))
+		logger.Error(instance, fmt.Errorf("failed to create user in DB: %w", err))
 		return nil, err
 	}
 
-	s.logger.OK(instance, fmt.Sprintf("user registered successfully [user_id=%s, email=%s]", id, email))
-	s.logger.Info(instance, fmt.Sprintf("registration completed in %dms", time.Since(start).Milliseconds()))
+	// registration stands without the email; a password reset verifies too
+	s.sendInBackground(ctx, instance, user, models.TokenPurposeVerifyEmail)
+
+	logger.OK(instance, fmt.Sprintf("user registered successfully [user_id=%s, email=%s]", id, email))
+	logger.Info(instance, fmt.Sprintf("registration completed in %dms", time.Since(start).Milliseconds()))
 
 	return user, nil
 }
 
-func (s *AuthService) Login(ctx context.Context, email, password string) (string, *models.User, error) {
+// Login checks the password and starts a new session for device. Every login
+// gets its own refresh token family, so a user can be logged in on several
+// devices at once. Failed attempts are counted per account and per client ip;
+// unknown accounts and wrong passwords fail the same way.
+func (s *AuthService) Login(ctx context.Context, email, password, device, ip string) (*Tokens, *models.User, error) {
+	logger := s.logger.WithContext(ctx)
 	instance := "AuthService.Login"
 	start := time.Now()
 
-	s.logger.Info(instance, fmt.Sprintf("user attempting login [email=%s]", email))
+	logger.Info(instance, fmt.Sprintf("user attempting login [email=%s]", email))
+
+	keys := loginKeys(email, ip)
+	if err := s.checkLoginAllowed(ctx, keys); err != nil {
+		logger.Warn(instance, fmt.Sprintf("login blocked [email=%s, ip=%s]: %v", email, ip, err))
+		return nil, nil, err
+	}
 
 	user, err := s.repo.GetUserByEmail(ctx, email)
-	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			s.logger.Warn(instance, fmt.Sprintf("login failed: user not registered [email=%s]", email))
-			return "", nil, errors.New("user not registered")
-		}
-		s.logger.Error(instance, fmt.Errorf("failed to query user: %w", err))
-		return "", nil, err
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		logger.Error(instance, fmt.Errorf("failed to query user: %w", err))
+		return nil, nil, err
 	}
 
-	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil {
-		s.logger.Warn(instance, fmt.Sprintf("invalid password for user [email=%s]", email))
-		return "", nil, errors.New("invalid password")
+	hash := dummyHash()
+	if user != nil {
+		hash = []byte(user.PasswordHash)
+	}
+	if bcrypt.CompareHashAndPassword(hash, []byte(password)) != nil || user == nil {
+		logger.Warn(instance, fmt.Sprintf("invalid credentials [email=%s, ip=%s, registered=%t]", email, ip, user != nil))
+		s.recordLoginFailure(ctx, keys)
+		return nil, nil, ErrInvalidCredentials
 	}
 
-	exists, err := s.repo.CheckActiveToken(ctx, user.ID)
-	if err != nil {
-		s.logger.Error(instance, fmt.Errorf("failed to check active token: %w", err))
-		return "", nil, err
+	if err := s.repo.ResetLoginFailures(ctx, keys[0]); err != nil {
+		logger.Error(instance, err)
 	}
 
-	if exists {
-		s.logger.Warn(instance, fmt.Sprintf("user already logged in [user_id=%s]", user.ID))
-		return "", nil, errors.New("user already logged in")
+	if err := checkStatus(user); err != nil {
+		logger.Warn(instance, fmt.Sprintf("login refused for %s user [user_id=%s]", user.Status, user.ID))
+		return nil, nil, err
 	}
 
-	token, err := jwt.GenerateToken(user.ID, user.Email, user.Role)
+	tokens, err := s.startSession(ctx, user, device)
 	if err != nil {
-		s.logger.Error(instance, fmt.Errorf("failed to generate token: %w", err))
-		return "", nil, err
+		logger.Error(instance, err)
+		return nil, nil, err
 	}
 
-	if err := s.repo.SaveActiveToken(ctx, user.ID, token); err != nil {
-		s.logger.Error(instance, fmt.Errorf("failed to save active token: %w", err))
-		return "", nil, err
-	}
+	logger.OK(instance, fmt.Sprintf("user login successful [user_id=%s, role=%s]", user.ID, user.Role))
+	logger.Info(instance, fmt.Sprintf("login completed in %dms", time.Since(start).Milliseconds()))
 
-	s.logger.OK(instance, fmt.Sprintf("user login successful [user_id=%s, role=%s]", user.ID, user.Role))
-	s.logger.Info(instance, fmt.Sprintf("login completed in %dms", time.Since(start).Milliseconds()))
+	return tokens, user, nil
+}
 
-	return token, user, nil
+// checkStatus tells whether the user may start a session once their
+// credentials have been checked.
+func checkStatus(user *models.User) error {
+	switch user.Status {
+	case "ACTIVE":
+		return nil
+	case "PENDING":
+		return ErrEmailNotVerified
+	default:
+		return ErrAccountInactive
+	}
 }
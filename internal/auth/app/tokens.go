@@ -0,0 +1,202 @@
+package app
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"ride-hail/internal/auth/repo"
+	"ride-hail/internal/shared/auth"
+	"ride-hail/internal/shared/models"
+	"ride-hail/internal/shared/revocation"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrInvalidRefreshToken covers unknown, spent, revoked and expired refresh
+// tokens alike, so a client learns nothing about which it was.
+var ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+
+const (
+	secretBytes     = 32
+	maxDeviceLength = 200
+)
+
+// Tokens is what a login or a refresh hands to the client.
+type Tokens struct {
+	AccessToken      string
+	AccessExpiresAt  time.Time
+	RefreshToken     string
+	RefreshExpiresAt time.Time
+}
+
+func newSecret() (string, string, error) {
+	b := make([]byte, secretBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	return token, hashSecret(token), nil
+}
+
+// hashSecret is what is stored for refresh and email tokens; a leaked table
+// cannot be replayed.
+func hashSecret(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *AuthService) startSession(ctx context.Context, user *models.User, device string) (*Tokens, error) {
+	if len(device) > maxDeviceLength {
+		device = device[:maxDeviceLength]
+	}
+
+	refresh, hash, err := newSecret()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+	now := time.Now()
+	t := &models.RefreshToken{
+		ID:        uuid.NewString(),
+		UserID:    user.ID,
+		FamilyID:  uuid.NewString(),
+		Device:    device,
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.refreshTTL),
+	}
+	if err := s.repo.CreateRefreshToken(ctx, t, hash); err != nil {
+		return nil, err
+	}
+
+	return s.issueTokens(user, refresh, t.ExpiresAt)
+}
+
+func (s *AuthService) issueTokens(user *models.User, refresh string, refreshExpiresAt time.Time) (*Tokens, error) {
+	access, claims, err := s.issuer.Issue(user.ID, user.Email, user.Role)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate token: %w", err)
+	}
+	return &Tokens{
+		AccessToken:      access,
+		AccessExpiresAt:  claims.ExpiresAt.Time,
+		RefreshToken:     refresh,
+		RefreshExpiresAt: refreshExpiresAt,
+	}, nil
+}
+
+// Refresh trades a refresh token for a new access token and a new refresh
+// token. A token can be used once: presenting a spent token again means
+// someone else has a copy, so the whole family is revoked and both parties
+// have to log in again.
+func (s *AuthService) Refresh(ctx context.Context, refreshToken string) (*Tokens, *models.User, error) {
+	logger := s.logger.WithContext(ctx)
+	instance := "AuthService.Refresh"
+
+	refresh, hash, err := newSecret()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+	now := time.Now()
+	next := &models.RefreshToken{ID: uuid.NewString(), CreatedAt: now, ExpiresAt: now.Add(s.refreshTTL)}
+
+	current, err := s.repo.RotateRefreshToken(ctx, hashSecret(refreshToken), next, hash)
+	if err != nil {
+		if errors.Is(err, repo.ErrRefreshTokenNotFound) {
+			logger.Warn(instance, "unknown refresh token presented")
+			return nil, nil, ErrInvalidRefreshToken
+		}
+		logger.Error(instance, err)
+		return nil, nil, err
+	}
+
+	switch {
+	case current.RevokedAt != nil:
+		logger.Warn(instance, fmt.Sprintf("revoked refresh token presented [user_id=%s, family_id=%s]", current.UserID, current.FamilyID))
+		return nil, nil, ErrInvalidRefreshToken
+	case current.UsedAt != nil:
+		n, err := s.repo.RevokeRefreshFamily(ctx, current.FamilyID)
+		if err != nil {
+			logger.Error(instance, err)
+			return nil, nil, err
+		}
+		// the access tokens of the family cannot be told apart from the
+		// user's other tokens; those sessions simply refresh again
+		if err := s.repo.RecordRevocation(ctx, revocation.User(current.UserID, s.accessTTL, revocation.ReasonTokenReuse)); err != nil {
+			logger.Error(instance, err)
+			return nil, nil, err
+		}
+		logger.Warn(instance, fmt.Sprintf("refresh token reused, revoked %d tokens of family [user_id=%s, family_id=%s]", n, current.UserID, current.FamilyID))
+		return nil, nil, ErrInvalidRefreshToken
+	case next.UserID == "":
+		logger.Warn(instance, fmt.Sprintf("expired refresh token presented [user_id=%s]", current.UserID))
+		return nil, nil, ErrInvalidRefreshToken
+	}
+
+	user, err := s.repo.GetUserByID(ctx, current.UserID)
+	if err != nil {
+		logger.Error(instance, err)
+		return nil, nil, err
+	}
+	if user.Status != "ACTIVE" {
+		if _, err := s.repo.RevokeRefreshFamily(ctx, current.FamilyID); err != nil {
+			logger.Error(instance, err)
+		}
+		logger.Warn(instance, fmt.Sprintf("refresh refused for %s user [user_id=%s]", user.Status, user.ID))
+		return nil, nil, ErrInvalidRefreshToken
+	}
+
+	tokens, err := s.issueTokens(user, refresh, next.ExpiresAt)
+	if err != nil {
+		logger.Error(instance, err)
+		return nil, nil, err
+	}
+	logger.OK(instance, fmt.Sprintf("tokens refreshed [user_id=%s, family_id=%s]", user.ID, current.FamilyID))
+	return tokens, user, nil
+}
+
+// Logout ends the session the refresh token belongs to. The access token of
+// the request, when there is one of the same user, is revoked as well.
+func (s *AuthService) Logout(ctx context.Context, refreshToken string, claims *auth.Claims) error {
+	logger := s.logger.WithContext(ctx)
+	instance := "AuthService.Logout"
+
+	t, err := s.repo.RevokeRefreshFamilyByToken(ctx, hashSecret(refreshToken))
+	if err != nil {
+		if errors.Is(err, repo.ErrRefreshTokenNotFound) {
+			return ErrInvalidRefreshToken
+		}
+		logger.Error(instance, err)
+		return err
+	}
+
+	if claims != nil && claims.UserID == t.UserID {
+		rev := revocation.Token(claims.ID, claims.ExpiresAt.Time, revocation.ReasonLogout)
+		if err := s.repo.RecordRevocation(ctx, rev); err != nil {
+			logger.Error(instance, err)
+			return err
+		}
+	}
+
+	logger.OK(instance, fmt.Sprintf("user logged out [user_id=%s, family_id=%s]", t.UserID, t.FamilyID))
+	return nil
+}
+
+// LogoutAll ends every session of a user, revoking all refresh tokens and all
+// access tokens issued so far, and returns how many refresh tokens were revoked.
+func (s *AuthService) LogoutAll(ctx context.Context, userID string) (int64, error) {
+	logger := s.logger.WithContext(ctx)
+	instance := "AuthService.LogoutAll"
+
+	n, err := s.repo.RevokeUserSessions(ctx, userID, revocation.User(userID, s.accessTTL, revocation.ReasonLogoutAll))
+	if err != nil {
+		logger.Error(instance, err)
+		return 0, err
+	}
+
+	logger.OK(instance, fmt.Sprintf("user logged out everywhere, %d refresh tokens revoked [user_id=%s]", n, userID))
+	return n, nil
+}
@@ -0,0 +1,99 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"ride-hail/internal/shared/auth"
+	"ride-hail/internal/shared/events"
+	"ride-hail/internal/shared/revocation"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrUserNotFound  = errors.New("user not found")
+	ErrInvalidStatus = errors.New("status must be one of ACTIVE, INACTIVE, BANNED")
+	ErrInvalidRole   = fmt.Errorf("role must be one of %s", strings.Join(auth.Roles(), ", "))
+	ErrOwnRole       = errors.New("you cannot change your own role")
+	// ErrRoleNotAllowed is returned when registering with a role that only an
+	// admin can assign.
+	ErrRoleNotAllowed = fmt.Errorf("role must be one of %s", strings.Join(selfRegistrationRoles, ", "))
+)
+
+// selfRegistrationRoles are the roles anyone may register with.
+var selfRegistrationRoles = []string{auth.RolePassenger, auth.RoleDriver}
+
+var userStatuses = []string{"ACTIVE", "INACTIVE", "BANNED"}
+
+// SetUserStatus bans, deactivates or reactivates a user. Leaving ACTIVE ends
+// every session and revokes the user's access tokens in all services.
+func (s *AuthService) SetUserStatus(ctx context.Context, userID, status, actor string) error {
+	logger := s.logger.WithContext(ctx)
+	instance := "AuthService.SetUserStatus"
+
+	if !slices.Contains(userStatuses, status) {
+		return ErrInvalidStatus
+	}
+	if uuid.Validate(userID) != nil {
+		return ErrUserNotFound
+	}
+
+	var rev *events.TokenRevoked
+	switch status {
+	case "BANNED":
+		r := revocation.User(userID, s.accessTTL, revocation.ReasonBanned)
+		rev = &r
+	case "INACTIVE":
+		r := revocation.User(userID, s.accessTTL, revocation.ReasonDeactivated)
+		rev = &r
+	}
+
+	if err := s.repo.SetUserStatus(ctx, userID, status, rev); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrUserNotFound
+		}
+		logger.Error(instance, err)
+		return err
+	}
+
+	logger.Warn(instance, fmt.Sprintf("user %s set to %s by %s", userID, status, actor))
+	return nil
+}
+
+// SetUserRole assigns a role. Access tokens issued with the old role are
+// revoked in all services; sessions go on and pick the new role up at their
+// next refresh. Admins cannot change their own role, so the last admin cannot
+// lock everyone out.
+func (s *AuthService) SetUserRole(ctx context.Context, userID, role, actor string) error {
+	logger := s.logger.WithContext(ctx)
+	instance := "AuthService.SetUserRole"
+
+	if !auth.ValidRole(role) {
+		return ErrInvalidRole
+	}
+	if uuid.Validate(userID) != nil {
+		return ErrUserNotFound
+	}
+	if userID == actor {
+		return ErrOwnRole
+	}
+
+	rev := revocation.User(userID, s.accessTTL, revocation.ReasonRoleChanged)
+	previous, err := s.repo.SetUserRole(ctx, userID, role, rev)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrUserNotFound
+		}
+		logger.Error(instance, err)
+		return err
+	}
+
+	if previous != role {
+		logger.Warn(instance, fmt.Sprintf("user %s changed from %s to %s by %s", userID, previous, role, actor))
+	}
+	return nil
+}
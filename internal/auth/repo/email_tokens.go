@@ -0,0 +1,126 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"ride-hail/internal/shared/models"
+	"ride-hail/internal/shared/revocation"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrEmailTokenInvalid covers unknown, used and expired email tokens.
+var ErrEmailTokenInvalid = errors.New("invalid or expired token")
+
+// CreateEmailToken stores a new token. Unused tokens of the same user and
+// purpose stop working, so only the latest email counts.
+func (r *AuthRepo) CreateEmailToken(ctx context.Context, t models.EmailToken, hash string) error {
+	return r.inTx(ctx, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `
+			UPDATE email_tokens SET used_at = NOW()
+			WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL
+		`, t.UserID, t.Purpose); err != nil {
+			return fmt.Errorf("failed to supersede email tokens: %w", err)
+		}
+		if _, err := tx.Exec(ctx, `
+			INSERT INTO email_tokens (id, user_id, purpose, token_hash, created_at, expires_at)
+			VALUES ($1, $2, $3, $4, $5, $6)
+		`, t.ID, t.UserID, t.Purpose, hash, t.CreatedAt, t.ExpiresAt); err != nil {
+			return fmt.Errorf("failed to save email token: %w", err)
+		}
+		return nil
+	})
+}
+
+// LastEmailTokenAt returns when the latest token of a purpose was created, or
+// the zero time.
+func (r *AuthRepo) LastEmailTokenAt(ctx context.Context, userID, purpose string) (time.Time, error) {
+	var at *time.Time
+	err := r.db.QueryRow(ctx,
+		`SELECT max(created_at) FROM email_tokens WHERE user_id = $1 AND purpose = $2`, userID, purpose).Scan(&at)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to query email tokens: %w", err)
+	}
+	if at == nil {
+		return time.Time{}, nil
+	}
+	return *at, nil
+}
+
+func consumeEmailToken(ctx context.Context, tx pgx.Tx, hash, purpose string) (string, error) {
+	var userID string
+	err := tx.QueryRow(ctx, `
+		UPDATE email_tokens SET used_at = NOW()
+		WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING user_id
+	`, hash, purpose).Scan(&userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", ErrEmailTokenInvalid
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to use email token: %w", err)
+	}
+	return userID, nil
+}
+
+// VerifyEmail uses a verification token and activates a PENDING user.
+func (r *AuthRepo) VerifyEmail(ctx context.Context, hash string) (string, error) {
+	var userID string
+	err := r.inTx(ctx, func(tx pgx.Tx) error {
+		var err error
+		if userID, err = consumeEmailToken(ctx, tx, hash, models.TokenPurposeVerifyEmail); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, `
+			UPDATE users SET
+				email_verified_at = coalesce(email_verified_at, NOW()),
+				status = CASE WHEN status = 'PENDING' THEN 'ACTIVE' ELSE status END,
+				updated_at = NOW()
+			WHERE id = $1
+		`, userID); err != nil {
+			return fmt.Errorf("failed to verify email: %w", err)
+		}
+		return nil
+	})
+	return userID, err
+}
+
+// ResetPassword uses a reset token and sets the new password hash. Receiving
+// the email proves the address, so a PENDING user is activated as well. Every
+// session ends, access tokens issued so far are revoked (they live at most
+// accessTTL) and failed login counters of the account are cleared.
+func (r *AuthRepo) ResetPassword(ctx context.Context, hash, passwordHash string, accessTTL time.Duration) (string, error) {
+	var userID string
+	err := r.inTx(ctx, func(tx pgx.Tx) error {
+		var err error
+		if userID, err = consumeEmailToken(ctx, tx, hash, models.TokenPurposeResetPassword); err != nil {
+			return err
+		}
+
+		var email string
+		if err := tx.QueryRow(ctx, `
+			UPDATE users SET
+				password_hash = $2,
+				email_verified_at = coalesce(email_verified_at, NOW()),
+				status = CASE WHEN status = 'PENDING' THEN 'ACTIVE' ELSE status END,
+				updated_at = NOW()
+			WHERE id = $1
+			RETURNING email
+		`, userID, passwordHash).Scan(&email); err != nil {
+			return fmt.Errorf("failed to update password: %w", err)
+		}
+
+		if _, err := tx.Exec(ctx,
+			`UPDATE refresh_tokens SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`, userID); err != nil {
+			return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+		}
+		if _, err := tx.Exec(ctx,
+			`DELETE FROM login_failures WHERE kind = $1 AND subject = lower($2)`, models.LoginKeyAccount, email); err != nil {
+			return fmt.Errorf("failed to reset login failures: %w", err)
+		}
+		return revocation.Record(ctx, tx, revocation.User(userID, accessTTL, revocation.ReasonPasswordChanged))
+	})
+	return userID, err
+}
@@ -0,0 +1,136 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"ride-hail/internal/shared/models"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// LoginBlockedUntil returns the latest blocked_until of the keys, or the zero
+// time when none of them is blocked.
+func (r *AuthRepo) LoginBlockedUntil(ctx context.Context, keys ...models.LoginKey) (time.Time, error) {
+	var until time.Time
+	for _, k := range keys {
+		var t *time.Time
+		err := r.db.QueryRow(ctx,
+			`SELECT blocked_until FROM login_failures WHERE kind = $1 AND subject = $2 AND blocked_until > NOW()`,
+			k.Kind, k.Subject).Scan(&t)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return time.Time{}, fmt.Errorf("failed to check login failures: %w", err)
+		}
+		if t != nil && t.After(until) {
+			until = *t
+		}
+	}
+	return until, nil
+}
+
+// RecordLoginFailure counts a failure of key and returns the new count. The
+// count starts over when the last failure is older than window and the key is
+// not blocked.
+func (r *AuthRepo) RecordLoginFailure(ctx context.Context, key models.LoginKey, window time.Duration) (int, error) {
+	var failures int
+	err := r.db.QueryRow(ctx, `
+		INSERT INTO login_failures (kind, subject, failures, last_failed_at)
+		VALUES ($1, $2, 1, NOW())
+		ON CONFLICT (kind, subject) DO UPDATE SET
+			failures = CASE
+				WHEN login_failures.last_failed_at < NOW() - make_interval(secs => $3)
+				 AND coalesce(login_failures.blocked_until, '-infinity') < NOW()
+				THEN 1
+				ELSE login_failures.failures + 1
+			END,
+			last_failed_at = NOW()
+		RETURNING failures
+	`, key.Kind, key.Subject, window.Seconds()).Scan(&failures)
+	if err != nil {
+		return 0, fmt.Errorf("failed to record login failure: %w", err)
+	}
+	return failures, nil
+}
+
+// BlockLogin blocks key until the given time. A lockout is also written to
+// the audit table.
+func (r *AuthRepo) BlockLogin(ctx context.Context, key models.LoginKey, until time.Time, failures int, lockout bool) error {
+	return r.inTx(ctx, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx,
+			`UPDATE login_failures SET blocked_until = $3 WHERE kind = $1 AND subject = $2`,
+			key.Kind, key.Subject, until); err != nil {
+			return fmt.Errorf("failed to block login: %w", err)
+		}
+		if !lockout {
+			return nil
+		}
+		if _, err := tx.Exec(ctx, `
+			INSERT INTO login_lockouts (kind, subject, failures, locked_until)
+			VALUES ($1, $2, $3, $4)
+		`, key.Kind, key.Subject, failures, until); err != nil {
+			return fmt.Errorf("failed to record lockout: %w", err)
+		}
+		return nil
+	})
+}
+
+// ResetLoginFailures forgets the failures of key after a successful login.
+func (r *AuthRepo) ResetLoginFailures(ctx context.Context, key models.LoginKey) error {
+	if _, err := r.db.Exec(ctx,
+		`DELETE FROM login_failures WHERE kind = $1 AND subject = $2`, key.Kind, key.Subject); err != nil {
+		return fmt.Errorf("failed to reset login failures: %w", err)
+	}
+	return nil
+}
+
+// ClearLockout lifts the block of key and marks its open lockouts as cleared
+// by actor. It reports whether there was anything to clear.
+func (r *AuthRepo) ClearLockout(ctx context.Context, key models.LoginKey, actor string) (bool, error) {
+	var cleared bool
+	err := r.inTx(ctx, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx,
+			`DELETE FROM login_failures WHERE kind = $1 AND subject = $2`, key.Kind, key.Subject)
+		if err != nil {
+			return fmt.Errorf("failed to clear login failures: %w", err)
+		}
+		cleared = tag.RowsAffected() > 0
+
+		tag, err = tx.Exec(ctx, `
+			UPDATE login_lockouts SET cleared_at = NOW(), cleared_by = $3
+			WHERE kind = $1 AND subject = $2 AND cleared_at IS NULL AND locked_until > NOW()
+		`, key.Kind, key.Subject, actor)
+		if err != nil {
+			return fmt.Errorf("failed to clear lockouts: %w", err)
+		}
+		cleared = cleared || tag.RowsAffected() > 0
+		return nil
+	})
+	return cleared, err
+}
+
+// ListLockouts returns the latest lockouts, optionally only those still in
+// force.
+func (r *AuthRepo) ListLockouts(ctx context.Context, activeOnly bool, limit int) ([]models.LoginLockout, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT id, kind, subject, failures, locked_at, locked_until, cleared_at, coalesce(cleared_by, '')
+		FROM login_lockouts
+		WHERE NOT $1 OR (cleared_at IS NULL AND locked_until > NOW())
+		ORDER BY locked_at DESC
+		LIMIT $2
+	`, activeOnly, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list lockouts: %w", err)
+	}
+	defer rows.Close()
+
+	lockouts := []models.LoginLockout{}
+	for rows.Next() {
+		var l models.LoginLockout
+		if err := rows.Scan(&l.ID, &l.Kind, &l.Subject, &l.Failures, &l.LockedAt, &l.LockedUntil, &l.ClearedAt, &l.ClearedBy); err != nil {
+			return nil, fmt.Errorf("failed to scan lockout: %w", err)
+		}
+		lockouts = append(lockouts, l)
+	}
+	return lockouts, rows.Err()
+}
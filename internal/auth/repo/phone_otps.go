@@ -0,0 +1,129 @@
+package repo
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"ride-hail/internal/shared/models"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// CreatePhoneOTP stores a new code. Unused codes for the same phone stop
+// working, so only the latest text counts.
+func (r *AuthRepo) CreatePhoneOTP(ctx context.Context, otp models.PhoneOTP, hash string) error {
+	return r.inTx(ctx, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx,
+			`UPDATE phone_otps SET consumed_at = NOW() WHERE phone = $1 AND consumed_at IS NULL`, otp.Phone); err != nil {
+			return fmt.Errorf("failed to supersede phone codes: %w", err)
+		}
+		if _, err := tx.Exec(ctx, `
+			INSERT INTO phone_otps (id, phone, requested_ip, code_hash, created_at, expires_at)
+			VALUES ($1, $2, NULLIF($3, ''), $4, $5, $6)
+		`, otp.ID, otp.Phone, otp.RequestedIP, hash, otp.CreatedAt, otp.ExpiresAt); err != nil {
+			return fmt.Errorf("failed to save phone code: %w", err)
+		}
+		return nil
+	})
+}
+
+// PhoneOTPsSince returns how many codes were created for phone since the given
+// time, and when the first and the latest of them were created (zero times if
+// none).
+func (r *AuthRepo) PhoneOTPsSince(ctx context.Context, phone string, since time.Time) (int, time.Time, time.Time, error) {
+	var (
+		n           int
+		first, last *time.Time
+	)
+	err := r.db.QueryRow(ctx,
+		`SELECT count(*), min(created_at), max(created_at) FROM phone_otps WHERE phone = $1 AND created_at > $2`, phone, since).
+		Scan(&n, &first, &last)
+	if err != nil {
+		return 0, time.Time{}, time.Time{}, fmt.Errorf("failed to query phone codes: %w", err)
+	}
+	if n == 0 {
+		return 0, time.Time{}, time.Time{}, nil
+	}
+	return n, *first, *last, nil
+}
+
+// PhoneOTPsFromIP returns how many codes the client ip requested since the
+// given time, and when the first of them was created.
+func (r *AuthRepo) PhoneOTPsFromIP(ctx context.Context, ip string, since time.Time) (int, time.Time, error) {
+	var (
+		n     int
+		first *time.Time
+	)
+	err := r.db.QueryRow(ctx,
+		`SELECT count(*), min(created_at) FROM phone_otps WHERE requested_ip = $1 AND created_at > $2`, ip, since).
+		Scan(&n, &first)
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf("failed to query phone codes: %w", err)
+	}
+	if n == 0 {
+		return 0, time.Time{}, nil
+	}
+	return n, *first, nil
+}
+
+// UsePhoneOTP checks hash against the live code of phone. A match uses the
+// code up; a miss counts an attempt, and the code stops working after
+// maxAttempts misses. It reports whether the code matched.
+func (r *AuthRepo) UsePhoneOTP(ctx context.Context, phone, hash string, maxAttempts int) (bool, error) {
+	var ok bool
+	err := r.inTx(ctx, func(tx pgx.Tx) error {
+		var id, stored string
+		err := tx.QueryRow(ctx, `
+			SELECT id, code_hash FROM phone_otps
+			WHERE phone = $1 AND consumed_at IS NULL AND expires_at > NOW() AND attempts < $2
+			ORDER BY created_at DESC
+			LIMIT 1
+			FOR UPDATE
+		`, phone, maxAttempts).Scan(&id, &stored)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to query phone code: %w", err)
+		}
+
+		ok = subtle.ConstantTimeCompare([]byte(stored), []byte(hash)) == 1
+		if ok {
+			_, err = tx.Exec(ctx, `UPDATE phone_otps SET consumed_at = NOW() WHERE id = $1`, id)
+		} else {
+			_, err = tx.Exec(ctx, `
+				UPDATE phone_otps SET
+					attempts = attempts + 1,
+					consumed_at = CASE WHEN attempts + 1 >= $2 THEN NOW() END
+				WHERE id = $1
+			`, id, maxAttempts)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to update phone code: %w", err)
+		}
+		return nil
+	})
+	return ok, err
+}
+
+// ConfirmPhone records that the user proved they own phone, which must still
+// be their pending or unverified number, and makes it their verified number.
+// It returns ErrPhoneTaken when another user verified the number first.
+func (r *AuthRepo) ConfirmPhone(ctx context.Context, userID, phone string) error {
+	tag, err := r.db.Exec(ctx, `
+		UPDATE users SET phone = $2, phone_verified_at = NOW(), pending_phone = NULL, updated_at = NOW()
+		WHERE id = $1 AND (pending_phone = $2 OR (pending_phone IS NULL AND phone = $2 AND phone_verified_at IS NULL))
+	`, userID, phone)
+	if err != nil {
+		if isUniqueViolation(err, "users_phone_key") {
+			return ErrPhoneTaken
+		}
+		return fmt.Errorf("failed to mark phone verified: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
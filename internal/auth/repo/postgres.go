@@ -5,14 +5,20 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
+	"io"
+	"ride-hail/internal/shared/events"
 	"ride-hail/internal/shared/models"
+	"ride-hail/internal/shared/privacy"
+	"ride-hail/internal/shared/revocation"
 	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// ErrPhoneTaken is returned when another user has verified the phone number.
+var ErrPhoneTaken = errors.New("phone number is already registered")
+
 type AuthRepo struct {
 	db *pgxpool.Pool
 }
@@ -27,23 +33,33 @@ func (r *AuthRepo) CreateUser(ctx context.Context, user *models.User) error {
 		return fmt.Errorf("failed to marshall attrs: %w", err)
 	}
 	query := `
-		INSERT INTO users (id, email, role, status, password_hash, attrs)
-		VALUES ($1, $2, $3, 'ACTIVE', $4, $5)
+		INSERT INTO users (id, email, phone, role, status, password_hash, attrs)
+		VALUES ($1, $2, NULLIF($3, ''), $4, $5, $6, $7)
 	`
-	if _, err := r.db.Exec(ctx, query, user.ID, user.Email, user.Role, user.PasswordHash, attrsJSON); err != nil {
+	if _, err := r.db.Exec(ctx, query, user.ID, user.Email, user.Phone, user.Role, user.Status, user.PasswordHash, attrsJSON); err != nil {
 		return fmt.Errorf("failed to create user: %w", err)
 	}
 	return nil
 }
 
 func (r *AuthRepo) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
-	query := `SELECT id, email, role, status, password_hash, attrs FROM users WHERE email=$1`
-	row := r.db.QueryRow(ctx, query, email)
+	return r.getUser(ctx, "email = $1", email)
+}
+
+// GetUserByPhone looks a user up by a verified phone number in E.164 form.
+// Unverified numbers are not unique and belong to no one yet.
+func (r *AuthRepo) GetUserByPhone(ctx context.Context, phone string) (*models.User, error) {
+	return r.getUser(ctx, "phone = $1 AND phone_verified_at IS NOT NULL", phone)
+}
+
+func (r *AuthRepo) getUser(ctx context.Context, where, value string) (*models.User, error) {
+	query := `SELECT id, email, coalesce(phone, ''), role, status, password_hash, attrs FROM users WHERE ` + where
+	row := r.db.QueryRow(ctx, query, value)
 
 	user := &models.User{}
 	var attrs []byte
 
-	err := row.Scan(&user.ID, &user.Email, &user.Role, &user.Status, &user.PasswordHash, &attrs)
+	err := row.Scan(&user.ID, &user.Email, &user.Phone, &user.Role, &user.Status, &user.PasswordHash, &attrs)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, pgx.ErrNoRows
@@ -59,34 +75,79 @@ func (r *AuthRepo) GetUserByEmail(ctx context.Context, email string) (*models.Us
 	return user, nil
 }
 
-func (r *AuthRepo) CheckActiveToken(ctx context.Context, userID string) (bool, error) {
-	var count int
-	err := r.db.QueryRow(ctx, `SELECT COUNT(*) FROM active_tokens WHERE user_id=$1`, userID).Scan(&count)
-	if err != nil {
-		return false, err
-	}
-
-	return count > 0, nil
+func (r *AuthRepo) GetUserByID(ctx context.Context, id string) (*models.User, error) {
+	return r.getUser(ctx, "id = $1", id)
 }
 
-func (r *AuthRepo) SaveActiveToken(ctx context.Context, userID, token string) error {
-	_, err := r.db.Exec(ctx, `
-		INSERT INTO active_tokens (user_id, token)
-		VALUES ($1, $2)
-		ON CONFLICT (user_id)
-		DO UPDATE SET token = EXCLUDED.token, created_at = NOW()
-	`, userID, token)
-	return err
-}
+// SetUserStatus changes the status of a user who has not been erased. rev,
+// when given, is recorded in the same transaction and every refresh token of
+// the user is revoked.
+func (r *AuthRepo) SetUserStatus(ctx context.Context, userID, status string, rev *events.TokenRevoked) error {
+	return r.inTx(ctx, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx,
+			`UPDATE users SET status = $2, updated_at = NOW() WHERE id = $1 AND erased_at IS NULL`, userID, status)
+		if err != nil {
+			return fmt.Errorf("failed to update user status: %w", err)
+		}
+		if tag.RowsAffected() == 0 {
+			return pgx.ErrNoRows
+		}
+		if rev == nil {
+			return nil
+		}
 
-func (r *AuthRepo) StartTokenCleaner() {
-	ticker := time.NewTicker(time.Minute)
+		if _, err := tx.Exec(ctx,
+			`UPDATE refresh_tokens SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`, userID); err != nil {
+			return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+		}
+		return revocation.Record(ctx, tx, *rev)
+	})
+}
 
-	for range ticker.C {
-		_, err := r.db.Exec(context.Background(),
-			`DELETE FROM active_tokens WHERE created_at < NOW() - INTERVAL '1 minute'`)
+// SetUserRole changes the role of a user who has not been erased and records
+// rev in the same transaction, so tokens carrying the old role stop working. Nothing happens
+// when the user already has the role. It returns the previous role.
+func (r *AuthRepo) SetUserRole(ctx context.Context, userID, role string, rev events.TokenRevoked) (string, error) {
+	var previous string
+	err := r.inTx(ctx, func(tx pgx.Tx) error {
+		err := tx.QueryRow(ctx, `SELECT role FROM users WHERE id = $1 AND erased_at IS NULL FOR UPDATE`, userID).Scan(&previous)
 		if err != nil {
-			log.Printf("failed to clean expired tokens: %v", err)
+			if errors.Is(err, pgx.ErrNoRows) {
+				return pgx.ErrNoRows
+			}
+			return fmt.Errorf("failed to query user role: %w", err)
+		}
+		if previous == role {
+			return nil
+		}
+
+		if _, err := tx.Exec(ctx, `UPDATE users SET role = $2, updated_at = NOW() WHERE id = $1`, userID, role); err != nil {
+			return fmt.Errorf("failed to update user role: %w", err)
 		}
+		return revocation.Record(ctx, tx, rev)
+	})
+	return previous, err
+}
+
+// ExportUser writes the data export of a user, see privacy.Export.
+func (r *AuthRepo) ExportUser(ctx context.Context, userID string, w io.Writer) error {
+	return privacy.Export(ctx, r.db, userID, w)
+}
+
+// EraseUser anonymizes a user, see privacy.Erase.
+func (r *AuthRepo) EraseUser(ctx context.Context, userID string, accessTTL time.Duration) (*privacy.Report, error) {
+	return privacy.Erase(ctx, r.db, userID, accessTTL)
+}
+
+func (r *AuthRepo) inTx(ctx context.Context, fn func(tx pgx.Tx) error) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := fn(tx); err != nil {
+		return err
 	}
+	return tx.Commit(ctx)
 }
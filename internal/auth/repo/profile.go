@@ -0,0 +1,140 @@
+package repo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"ride-hail/internal/shared/events"
+	"ride-hail/internal/shared/models"
+	"ride-hail/internal/shared/revocation"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// ErrEmailTaken is returned when another user has registered the address.
+var ErrEmailTaken = errors.New("email address is already registered")
+
+// GetProfile returns the profile of a user.
+func (r *AuthRepo) GetProfile(ctx context.Context, userID string) (*models.UserProfile, error) {
+	p := &models.UserProfile{}
+	var attrs []byte
+	err := r.db.QueryRow(ctx, `
+		SELECT id, email, email_verified_at IS NOT NULL, coalesce(phone, ''), phone_verified_at IS NOT NULL,
+			coalesce(pending_phone, ''), role, status, attrs, created_at
+		FROM users WHERE id = $1
+	`, userID).Scan(&p.UserID, &p.Email, &p.EmailVerified, &p.Phone, &p.PhoneVerified,
+		&p.PendingPhone, &p.Role, &p.Status, &attrs, &p.CreatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, pgx.ErrNoRows
+		}
+		return nil, fmt.Errorf("failed to query profile: %w", err)
+	}
+
+	if len(attrs) > 0 {
+		var a struct {
+			Name             string                   `json:"name"`
+			Locale           string                   `json:"locale"`
+			AvatarURL        string                   `json:"avatar_url"`
+			EmergencyContact *models.EmergencyContact `json:"emergency_contact"`
+		}
+		if err := json.Unmarshal(attrs, &a); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal user attrs: %w", err)
+		}
+		p.Name, p.Locale, p.AvatarURL, p.EmergencyContact = a.Name, a.Locale, a.AvatarURL, a.EmergencyContact
+	}
+	return p, nil
+}
+
+// UpdateProfile applies u. A new phone number only becomes pending_phone;
+// the current number stays until ConfirmPhone. Removing the number also
+// drops a pending one.
+func (r *AuthRepo) UpdateProfile(ctx context.Context, userID string, u models.ProfileUpdate) error {
+	set, err := json.Marshal(u.Set)
+	if err != nil {
+		return fmt.Errorf("failed to marshall attrs: %w", err)
+	}
+	unset := u.Unset
+	if unset == nil {
+		unset = []string{}
+	}
+	phone := ""
+	if u.Phone != nil {
+		phone = *u.Phone
+	}
+
+	tag, err := r.db.Exec(ctx, `
+		UPDATE users SET
+			attrs = (coalesce(attrs, '{}'::jsonb) || $2::jsonb) - $3::text[],
+			phone = CASE WHEN $4 AND $5 = '' THEN NULL ELSE phone END,
+			phone_verified_at = CASE WHEN $4 AND $5 = '' THEN NULL ELSE phone_verified_at END,
+			pending_phone = CASE
+				WHEN NOT $4 THEN pending_phone
+				WHEN $5 = '' OR $5 = phone THEN NULL
+				ELSE $5
+			END,
+			updated_at = NOW()
+		WHERE id = $1
+	`, userID, set, unset, u.Phone != nil, phone)
+	if err != nil {
+		return fmt.Errorf("failed to update profile: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// ChangeEmail sets a new, unverified email address. Emailed tokens sent to
+// the old address stop working.
+func (r *AuthRepo) ChangeEmail(ctx context.Context, userID, email string) error {
+	return r.inTx(ctx, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, `
+			UPDATE users SET email = $2, email_verified_at = NULL, updated_at = NOW()
+			WHERE id = $1
+		`, userID, email)
+		if err != nil {
+			if isUniqueViolation(err, "users_email_key") {
+				return ErrEmailTaken
+			}
+			return fmt.Errorf("failed to update email: %w", err)
+		}
+		if tag.RowsAffected() == 0 {
+			return pgx.ErrNoRows
+		}
+
+		if _, err := tx.Exec(ctx,
+			`UPDATE email_tokens SET used_at = NOW() WHERE user_id = $1 AND used_at IS NULL`, userID); err != nil {
+			return fmt.Errorf("failed to invalidate email tokens: %w", err)
+		}
+		return nil
+	})
+}
+
+// ChangePassword sets the new password hash, ends every session of the user
+// and records rev.
+func (r *AuthRepo) ChangePassword(ctx context.Context, userID, passwordHash string, rev events.TokenRevoked) error {
+	return r.inTx(ctx, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx,
+			`UPDATE users SET password_hash = $2, updated_at = NOW() WHERE id = $1`, userID, passwordHash)
+		if err != nil {
+			return fmt.Errorf("failed to update password: %w", err)
+		}
+		if tag.RowsAffected() == 0 {
+			return pgx.ErrNoRows
+		}
+
+		if _, err := tx.Exec(ctx,
+			`UPDATE refresh_tokens SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`, userID); err != nil {
+			return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+		}
+		return revocation.Record(ctx, tx, rev)
+	})
+}
+
+func isUniqueViolation(err error, constraint string) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == constraint
+}
@@ -0,0 +1,160 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"ride-hail/internal/shared/events"
+	"ride-hail/internal/shared/models"
+	"ride-hail/internal/shared/revocation"
+	"ride-hail/internal/shared/util"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const tokenCleanupInterval = time.Hour
+
+var ErrRefreshTokenNotFound = errors.New("refresh token not found")
+
+const refreshTokenColumns = `id, user_id, family_id, device, created_at, expires_at, used_at, replaced_by, revoked_at`
+
+func scanRefreshToken(row pgx.Row) (*models.RefreshToken, error) {
+	var t models.RefreshToken
+	err := row.Scan(&t.ID, &t.UserID, &t.FamilyID, &t.Device, &t.CreatedAt, &t.ExpiresAt, &t.UsedAt, &t.ReplacedBy, &t.RevokedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrRefreshTokenNotFound
+	}
+	return &t, err
+}
+
+// CreateRefreshToken stores the first token of a new family.
+func (r *AuthRepo) CreateRefreshToken(ctx context.Context, t *models.RefreshToken, hash string) error {
+	_, err := r.db.Exec(ctx, `
+		INSERT INTO refresh_tokens (id, user_id, family_id, token_hash, device, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`, t.ID, t.UserID, t.FamilyID, hash, t.Device, t.CreatedAt, t.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to save refresh token: %w", err)
+	}
+	return nil
+}
+
+// RotateRefreshToken spends the token with hash and stores next, which takes
+// over its user, family and device. It returns the presented token as it was
+// found; when that token was already spent, revoked or expired nothing is
+// changed and the caller decides what that means.
+func (r *AuthRepo) RotateRefreshToken(ctx context.Context, hash string, next *models.RefreshToken, nextHash string) (*models.RefreshToken, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	current, err := scanRefreshToken(tx.QueryRow(ctx,
+		`SELECT `+refreshTokenColumns+` FROM refresh_tokens WHERE token_hash = $1 FOR UPDATE`, hash))
+	if err != nil {
+		return nil, err
+	}
+	if current.UsedAt != nil || current.RevokedAt != nil || !current.ExpiresAt.After(next.CreatedAt) {
+		return current, nil
+	}
+
+	next.UserID = current.UserID
+	next.FamilyID = current.FamilyID
+	next.Device = current.Device
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO refresh_tokens (id, user_id, family_id, token_hash, device, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`, next.ID, next.UserID, next.FamilyID, nextHash, next.Device, next.CreatedAt, next.ExpiresAt); err != nil {
+		return nil, fmt.Errorf("failed to save refresh token: %w", err)
+	}
+	if _, err := tx.Exec(ctx,
+		`UPDATE refresh_tokens SET used_at = $2, replaced_by = $3 WHERE id = $1`,
+		current.ID, next.CreatedAt, next.ID); err != nil {
+		return nil, fmt.Errorf("failed to spend refresh token: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit refresh token rotation: %w", err)
+	}
+	return current, nil
+}
+
+// RevokeRefreshFamily revokes every token of a family and returns how many
+// were still live.
+func (r *AuthRepo) RevokeRefreshFamily(ctx context.Context, familyID string) (int64, error) {
+	tag, err := r.db.Exec(ctx,
+		`UPDATE refresh_tokens SET revoked_at = NOW() WHERE family_id = $1 AND revoked_at IS NULL`, familyID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to revoke refresh tokens: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// RevokeRefreshFamilyByToken revokes the family of the token with hash.
+func (r *AuthRepo) RevokeRefreshFamilyByToken(ctx context.Context, hash string) (*models.RefreshToken, error) {
+	t, err := scanRefreshToken(r.db.QueryRow(ctx,
+		`SELECT `+refreshTokenColumns+` FROM refresh_tokens WHERE token_hash = $1`, hash))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := r.RevokeRefreshFamily(ctx, t.FamilyID); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// RevokeUserSessions revokes every refresh token of a user and records rev,
+// which revokes the access tokens, in one transaction.
+func (r *AuthRepo) RevokeUserSessions(ctx context.Context, userID string, rev events.TokenRevoked) (int64, error) {
+	var n int64
+	err := r.inTx(ctx, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx,
+			`UPDATE refresh_tokens SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`, userID)
+		if err != nil {
+			return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+		}
+		n = tag.RowsAffected()
+		return revocation.Record(ctx, tx, rev)
+	})
+	return n, err
+}
+
+// RecordRevocation records and publishes a revocation of access tokens.
+func (r *AuthRepo) RecordRevocation(ctx context.Context, rev events.TokenRevoked) error {
+	return r.inTx(ctx, func(tx pgx.Tx) error {
+		return revocation.Record(ctx, tx, rev)
+	})
+}
+
+// StartTokenCleaner deletes expired refresh, email and revoked tokens, phone
+// login codes older than the hour they are counted for, and failed-login
+// counters past the longest allowed failure window, until ctx is done.
+func (r *AuthRepo) StartTokenCleaner(ctx context.Context) {
+	ticker := time.NewTicker(tokenCleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for _, table := range []string{"refresh_tokens", "revoked_tokens", "email_tokens"} {
+			if _, err := r.db.Exec(ctx, `DELETE FROM `+table+` WHERE expires_at < NOW()`); err != nil && ctx.Err() == nil {
+				util.New().Error("TokenCleaner", fmt.Errorf("failed to clean expired %s: %w", table, err))
+			}
+		}
+		if _, err := r.db.Exec(ctx, `DELETE FROM phone_otps WHERE created_at < NOW() - interval '1 hour'`); err != nil && ctx.Err() == nil {
+			util.New().Error("TokenCleaner", fmt.Errorf("failed to clean phone codes: %w", err))
+		}
+		if _, err := r.db.Exec(ctx, `
+			DELETE FROM login_failures
+			WHERE coalesce(blocked_until, '-infinity') < NOW() AND last_failed_at < NOW() - interval '7 days'
+		`); err != nil && ctx.Err() == nil {
+			util.New().Error("TokenCleaner", fmt.Errorf("failed to clean login failures: %w", err))
+		}
+	}
+}
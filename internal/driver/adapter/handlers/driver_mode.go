@@ -3,8 +3,6 @@ package handlers
 import (
 	"context"
 	"encoding/json"
-	"fmt"
-	"log/slog"
 	"net/http"
 	"time"
 
@@ -17,20 +15,20 @@ func (h *Handler) StartDriver(w http.ResponseWriter, r *http.Request) {
 	defer cancel()
 
 	id := r.PathValue("driver_id")
-	fmt.Println("StartDriver called", id)
+	h.logger(r).Debug("StartDriver", "going online")
 
 	location := models.Location{}
 
 	err := json.NewDecoder(r.Body).Decode(&location)
 	if err != nil {
-		slog.Error("error:", err)
+		h.logger(r).Error("StartDriver", err)
 		return
 	}
 	location.DriverID = id
 
 	id, err = h.service.StartSession(ctx, location)
 	if err != nil {
-		slog.Error("error:", err)
+		h.logger(r).Error("StartDriver", err)
 
 		util.ErrResponseInJson(w, err)
 		return
@@ -51,7 +49,7 @@ func (h *Handler) FinishDriver(w http.ResponseWriter, r *http.Request) {
 
 	err := h.service.FinishSession(ctx, id)
 	if err != nil {
-		slog.Error("error:", err)
+		h.logger(r).Error("FinishDriver", err)
 
 		util.ErrResponseInJson(w, err)
 		return
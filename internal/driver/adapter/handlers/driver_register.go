@@ -3,7 +3,6 @@ package handlers
 import (
 	"context"
 	"encoding/json"
-	"fmt"
 	"net/http"
 	"time"
 
@@ -20,14 +19,14 @@ func (h *Handler) RegisterDriver(w http.ResponseWriter, r *http.Request) {
 
 	err := json.NewDecoder(r.Body).Decode(&driverData)
 	if err != nil {
-		fmt.Println("cannot decode json body:", err)
+		h.logger(r).Warn("RegisterDriver", "cannot decode json body: "+err.Error())
 		http.Error(w, err.Error(), http.StatusBadGateway)
 		return
 	}
 
 	statusCode, err := h.service.RegisterDriver(ctx, &driverData)
 	if err != nil {
-		fmt.Println("cannot register driver: ", err)
+		h.logger(r).Error("RegisterDriver", err)
 		http.Error(w, err.Error(), statusCode)
 		return
 	}
@@ -3,7 +3,6 @@ package handlers
 import (
 	"context"
 	"encoding/json"
-	"log/slog"
 	"net/http"
 	"ride-hail/internal/driver/models"
 	"ride-hail/internal/shared/util"
@@ -18,7 +17,7 @@ func (h *Handler) CurrLocationDriver(w http.ResponseWriter, r *http.Request) {
 
 	err := json.NewDecoder(r.Body).Decode(&location)
 	if err != nil {
-		slog.Error("error:", err)
+		h.logger(r).Error("CurrLocationDriver", err)
 		return
 	}
 
@@ -26,7 +25,7 @@ func (h *Handler) CurrLocationDriver(w http.ResponseWriter, r *http.Request) {
 
 	result, err := h.service.UpdateLocation(ctx, &location)
 	if err != nil {
-		slog.Error("error:", err)
+		h.logger(r).Error("CurrLocationDriver", err)
 
 		util.ErrResponseInJson(w, err)
 
@@ -35,3 +34,87 @@ func (h *Handler) CurrLocationDriver(w http.ResponseWriter, r *http.Request) {
 
 	util.ResponseInJson(w, 200, result)
 }
+
+func (h *Handler) ArrivedDriver(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), (time.Second * 30))
+	defer cancel()
+
+	action := models.RideAction{}
+
+	err := json.NewDecoder(r.Body).Decode(&action)
+	if err != nil || action.RideID == "" {
+		util.WriteJSONError(w, "ride_id is required", http.StatusBadRequest)
+		return
+	}
+
+	state, err := h.service.ArriveAtPickup(ctx, r.PathValue("driver_id"), action.RideID)
+	if err != nil {
+		h.logger(r).Error("ArrivedDriver", err)
+
+		util.ErrResponseInJson(w, err)
+		return
+	}
+
+	util.ResponseInJson(w, 200, map[string]interface{}{
+		"ride_id": action.RideID,
+		"status":  models.RideArrived,
+		"wait":    state,
+		"message": "Passenger has been notified that you arrived",
+	})
+}
+
+func (h *Handler) StartRideDriver(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), (time.Second * 30))
+	defer cancel()
+
+	action := models.RideAction{}
+
+	err := json.NewDecoder(r.Body).Decode(&action)
+	if err != nil || action.RideID == "" {
+		util.WriteJSONError(w, "ride_id is required", http.StatusBadRequest)
+		return
+	}
+
+	state, err := h.service.StartRide(ctx, r.PathValue("driver_id"), action.RideID)
+	if err != nil {
+		h.logger(r).Error("StartRideDriver", err)
+
+		util.ErrResponseInJson(w, err)
+		return
+	}
+
+	util.ResponseInJson(w, 200, map[string]interface{}{
+		"ride_id":     action.RideID,
+		"status":      models.RideInProgress,
+		"waiting_fee": state.WaitingFee,
+		"message":     "Ride started",
+	})
+}
+
+func (h *Handler) NoShowDriver(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), (time.Second * 30))
+	defer cancel()
+
+	action := models.RideAction{}
+
+	err := json.NewDecoder(r.Body).Decode(&action)
+	if err != nil || action.RideID == "" {
+		util.WriteJSONError(w, "ride_id is required", http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.service.ReportNoShow(ctx, r.PathValue("driver_id"), action.RideID)
+	if err != nil {
+		h.logger(r).Error("NoShowDriver", err)
+
+		util.ErrResponseInJson(w, err)
+		return
+	}
+
+	util.ResponseInJson(w, 200, map[string]interface{}{
+		"ride_id": result.RideID,
+		"status":  models.RideCancelled,
+		"no_show": result,
+		"message": "Ride cancelled as passenger no-show",
+	})
+}
@@ -3,6 +3,9 @@ package handlers
 import (
 	"net/http"
 	"ride-hail/internal/driver/app/usecase"
+	"ride-hail/internal/shared/auth"
+	"ride-hail/internal/shared/metrics"
+	"ride-hail/internal/shared/util"
 )
 
 type Handler struct {
@@ -16,10 +19,25 @@ func NewHandler(service usecase.Service) *Handler {
 func (h *Handler) Router() *http.ServeMux {
 	mux := http.NewServeMux()
 
-	mux.HandleFunc("POST /drivers/{user_id}/register", h.RegisterDriver)
-	mux.HandleFunc("POST /drivers/{driver_id}/online", h.StartDriver)
-	mux.HandleFunc("POST /drivers/{driver_id}/offline", h.FinishDriver)
-	mux.HandleFunc("POST /drivers/{driver_id}/location", h.CurrLocationDriver)
+	mux.Handle("POST /drivers/{user_id}/register", h.AuthMiddleware(h.RegisterDriver))
+	mux.Handle("POST /drivers/{driver_id}/online", h.AuthMiddleware(h.StartDriver))
+	mux.Handle("POST /drivers/{driver_id}/offline", h.AuthMiddleware(h.FinishDriver))
+	mux.Handle("POST /drivers/{driver_id}/location", h.AuthMiddleware(h.CurrLocationDriver))
+	mux.Handle("POST /drivers/{driver_id}/arrived", h.AuthMiddleware(h.ArrivedDriver))
+	mux.Handle("POST /drivers/{driver_id}/start", h.AuthMiddleware(h.StartRideDriver))
+	mux.Handle("POST /drivers/{driver_id}/no-show", h.AuthMiddleware(h.NoShowDriver))
+	mux.HandleFunc("GET /ws/drivers/{driver_id}", h.DriverWSHandler)
+	mux.Handle("/admin/log-level", auth.RequirePermission(auth.PermSettingsManage, util.LogLevelHandler()))
+	mux.Handle("GET /metrics", metrics.Handler())
 
 	return mux
 }
+
+// logger returns a request-scoped logger tagged with the driver from the path.
+func (h *Handler) logger(r *http.Request) *util.Logger {
+	driverID := r.PathValue("driver_id")
+	if driverID == "" {
+		driverID = r.PathValue("user_id")
+	}
+	return util.New().WithContext(r.Context()).With(util.FieldDriverID, driverID)
+}
@@ -2,33 +2,37 @@ package handlers
 
 import (
 	"net/http"
+
+	"ride-hail/internal/shared/auth"
+	"ride-hail/internal/shared/util"
 )
 
-func (h *Handler) AuthMiddleware(next http.Handler) http.Handler {
+// AuthMiddleware accepts only tokens that may operate as a driver, and only
+// for the driver in the path. The claims are stored in the request context.
+func (h *Handler) AuthMiddleware(next http.HandlerFunc) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// authHeader := r.Header.Get("Authorization")
-		// if authHeader == "" {
-		// 	http.Error(w, "missing auth header", http.StatusUnauthorized)
-		// 	return
-		// }
-
-		// tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-		// claims := &models.Claims{}
-
-		// // token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		// // 	return jwt2.JwtKey, nil
-		// // })
+		claims, err := auth.BearerClaims(r)
+		if err != nil {
+			h.logger(r).Warn("AuthMiddleware", "rejected token: "+err.Error())
+			auth.WriteAuthError(w, err)
+			return
+		}
 
-		// if err != nil || !token.Valid {
-		// 	http.Error(w, "invalid token", http.StatusUnauthorized)
-		// 	return
-		// }
+		if !claims.Can(auth.PermDriverOperate) {
+			util.WriteJSONError(w, "forbidden: driver access required", http.StatusForbidden)
+			return
+		}
 
-		// if claims.Role != "driver" {
-		// 	http.Error(w, "invalid role", http.StatusUnauthorized)
-		// 	return
-		// }
+		driverID := r.PathValue("driver_id")
+		if driverID == "" {
+			driverID = r.PathValue("user_id")
+		}
+		if driverID != claims.UserID {
+			h.logger(r).Warn("AuthMiddleware", "token of "+claims.UserID+" used for another driver")
+			util.WriteJSONError(w, "forbidden: token does not belong to this driver", http.StatusForbidden)
+			return
+		}
 
-		next.ServeHTTP(w, r)
+		next.ServeHTTP(w, r.WithContext(auth.WithClaims(r.Context(), claims)))
 	})
 }
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"ride-hail/internal/shared/auth"
+	"ride-hail/internal/shared/metrics"
+	"ride-hail/internal/shared/ws"
+
+	"github.com/gorilla/websocket"
+)
+
+var upgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+var drivers = ws.NewHub()
+
+func (h *Handler) DriverWSHandler(w http.ResponseWriter, r *http.Request) {
+	driverID := r.PathValue("driver_id")
+	logger := h.logger(r)
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		logger.Error("DriverWSHandler", err)
+		return
+	}
+	defer conn.Close()
+
+	metrics.WebSocketConnections.Inc("driver")
+	defer metrics.WebSocketConnections.Dec("driver")
+
+	logger.Info("DriverWSHandler", "new WS connection")
+
+	session := ws.NewSession(conn)
+	tokenStr, err := session.Token()
+	if errors.Is(err, ws.ErrAuthTimeout) {
+		_ = conn.WriteJSON(ws.Message{Type: "error", Message: "auth timeout"})
+		return
+	} else if err != nil {
+		return
+	}
+	if !validateWebSocketToken(tokenStr, driverID) {
+		_ = conn.WriteJSON(ws.Message{Type: "error", Message: "invalid token"})
+		return
+	}
+
+	drivers.Add(driverID, conn)
+	defer drivers.Remove(driverID, conn)
+	_ = conn.WriteJSON(ws.Message{Type: "auth_success", Message: "authenticated"})
+
+	if err := session.KeepAlive(); err != nil {
+		logger.Warn("DriverWSHandler", "ping failed: "+err.Error())
+		return
+	}
+	logger.Info("DriverWSHandler", "WS connection closed")
+}
+
+func validateWebSocketToken(headerToken, driverID string) bool {
+	tokenStr, ok := strings.CutPrefix(headerToken, "Bearer ")
+	if !ok {
+		return false
+	}
+
+	claims, err := auth.ParseToken(tokenStr)
+	if err != nil {
+		return false
+	}
+
+	return claims.UserID == driverID && claims.Can(auth.PermDriverOperate)
+}
+
+func SendToDriver(driverID string, event ws.Message) error {
+	return drivers.Send(driverID, event)
+}
+
+// StartWaitTimeBroadcaster pushes the pickup countdown to every waiting driver.
+func (h *Handler) StartWaitTimeBroadcaster(ctx context.Context) {
+	drivers.BroadcastWaitTimes(ctx, h.service.WaitingStates, "waiting for passenger")
+}
+
+// CloseWebSockets tells every connected driver to reconnect. It is a step of
+// the graceful shutdown.
+func (h *Handler) CloseWebSockets(ctx context.Context) error {
+	return drivers.Close(ctx)
+}
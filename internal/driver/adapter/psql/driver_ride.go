@@ -2,7 +2,15 @@ package psql
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"ride-hail/internal/driver/models"
+	"ride-hail/internal/shared/apperrors"
+	shared "ride-hail/internal/shared/models"
+	"ride-hail/internal/shared/mq"
+	"time"
+
+	"github.com/jackc/pgx/v5"
 )
 
 func (r *repo) UpdateCurrLocation(ctx context.Context, data *models.LocalHistory, update bool) (*models.Coordinate, error) {
@@ -37,3 +45,174 @@ func (r *repo) UpdateCurrLocation(ctx context.Context, data *models.LocalHistory
 
 	return result, nil
 }
+
+func (r *repo) GetRide(ctx context.Context, rideID string) (*models.Ride, error) {
+	query := `SELECT id, passenger_id, COALESCE(driver_id::text, ''), COALESCE(vehicle_type, ''), status, arrived_at FROM rides WHERE id = $1`
+
+	ride := &models.Ride{}
+
+	err := r.db.QueryRow(ctx, query, rideID).Scan(&ride.ID, &ride.PassengerID, &ride.DriverID, &ride.VehicleType, &ride.Status, &ride.ArrivedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, apperrors.ErrRideNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return ride, nil
+}
+
+func (r *repo) GetArrivedRides(ctx context.Context) ([]models.Ride, error) {
+	query := `SELECT id, passenger_id, driver_id, COALESCE(vehicle_type, ''), status, arrived_at FROM rides WHERE status = $1 AND arrived_at IS NOT NULL AND driver_id IS NOT NULL`
+
+	rows, err := r.db.Query(ctx, query, models.RideArrived)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rides []models.Ride
+	for rows.Next() {
+		var ride models.Ride
+		if err := rows.Scan(&ride.ID, &ride.PassengerID, &ride.DriverID, &ride.VehicleType, &ride.Status, &ride.ArrivedAt); err != nil {
+			return nil, err
+		}
+		rides = append(rides, ride)
+	}
+
+	return rides, rows.Err()
+}
+
+// MarkArrived, StartRide and CancelNoShow write event to the outbox in the
+// same transaction as the status change.
+func (r *repo) MarkArrived(ctx context.Context, rideID, driverID string, event shared.OutboxMessage) (time.Time, error) {
+	queryUpdateRide := `UPDATE rides SET status = $1, arrived_at = NOW(), updated_at = NOW() WHERE id = $2 AND driver_id = $3 AND status IN ($4, $5) RETURNING arrived_at`
+	queryInsertEvent := `INSERT INTO ride_events(ride_id, event_type, event_data) VALUES ($1, 'DRIVER_ARRIVED', $2)`
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	defer tx.Rollback(ctx)
+
+	var arrivedAt time.Time
+
+	err = tx.QueryRow(ctx, queryUpdateRide, models.RideArrived, rideID, driverID, models.RideMatched, models.RideEnRoute).Scan(&arrivedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return time.Time{}, apperrors.ErrInvalidRideStatus
+	} else if err != nil {
+		return time.Time{}, err
+	}
+
+	eventData, err := json.Marshal(map[string]interface{}{
+		"driver_id":  driverID,
+		"arrived_at": arrivedAt,
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	_, err = tx.Exec(ctx, queryInsertEvent, rideID, eventData)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if err := mq.InsertOutbox(ctx, tx, event); err != nil {
+		return time.Time{}, err
+	}
+
+	return arrivedAt, tx.Commit(ctx)
+}
+
+func (r *repo) StartRide(ctx context.Context, rideID, driverID string, waitingFee float64, event shared.OutboxMessage) error {
+	queryUpdateRide := `UPDATE rides SET status = $1, started_at = NOW(), waiting_fee = $2, updated_at = NOW() WHERE id = $3 AND driver_id = $4 AND status = $5`
+	queryUpdateDriver := `UPDATE drivers SET status = $1, updated_at = NOW() WHERE id = $2`
+	queryInsertEvent := `INSERT INTO ride_events(ride_id, event_type, event_data) VALUES ($1, 'RIDE_STARTED', $2)`
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback(ctx)
+
+	cmd, err := tx.Exec(ctx, queryUpdateRide, models.RideInProgress, waitingFee, rideID, driverID, models.RideArrived)
+	if err != nil {
+		return err
+	}
+	if cmd.RowsAffected() == 0 {
+		return apperrors.ErrInvalidRideStatus
+	}
+
+	_, err = tx.Exec(ctx, queryUpdateDriver, models.DriverBusy, driverID)
+	if err != nil {
+		return err
+	}
+
+	eventData, err := json.Marshal(map[string]interface{}{
+		"driver_id":   driverID,
+		"waiting_fee": waitingFee,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, queryInsertEvent, rideID, eventData)
+	if err != nil {
+		return err
+	}
+
+	if err := mq.InsertOutbox(ctx, tx, event); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (r *repo) CancelNoShow(ctx context.Context, data *models.NoShow, driverID string, event shared.OutboxMessage) error {
+	queryUpdateRide := `UPDATE rides SET status = $1, cancelled_at = NOW(), cancellation_reason = 'Passenger no-show', waiting_fee = $2, no_show_fee = $3, final_fare = $4, updated_at = NOW() WHERE id = $5 AND driver_id = $6 AND status = $7`
+	queryUpdateDriver := `UPDATE drivers SET status = $1, total_earnings = total_earnings + $2, updated_at = NOW() WHERE id = $3`
+	queryUpdateSession := `UPDATE driver_sessions SET total_earnings = total_earnings + $1 WHERE driver_id = $2 AND ended_at IS NULL`
+	queryInsertEvent := `INSERT INTO ride_events(ride_id, event_type, event_data) VALUES ($1, 'PASSENGER_NO_SHOW', $2)`
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback(ctx)
+
+	cmd, err := tx.Exec(ctx, queryUpdateRide, models.RideCancelled, data.WaitingFee, data.NoShowFee, data.DriverPayout, data.RideID, driverID, models.RideArrived)
+	if err != nil {
+		return err
+	}
+	if cmd.RowsAffected() == 0 {
+		return apperrors.ErrInvalidRideStatus
+	}
+
+	_, err = tx.Exec(ctx, queryUpdateDriver, models.DriverAvailable, data.DriverPayout, driverID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, queryUpdateSession, data.DriverPayout, driverID)
+	if err != nil {
+		return err
+	}
+
+	eventData, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, queryInsertEvent, data.RideID, eventData)
+	if err != nil {
+		return err
+	}
+
+	if err := mq.InsertOutbox(ctx, tx, event); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
@@ -2,8 +2,10 @@ package psql
 
 import (
 	"context"
+	"time"
 
 	"ride-hail/internal/driver/models"
+	shared "ride-hail/internal/shared/models"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 )
@@ -19,6 +21,11 @@ type Repo interface {
 	UpdateCurrLocation(ctx context.Context, data *models.LocalHistory, update bool) (*models.Coordinate, error)
 	CheckDriverExists(ctx context.Context, driverID string) error
 	CheckUserExistsAndIsDriver(ctx context.Context, userID string) error
+	GetRide(ctx context.Context, rideID string) (*models.Ride, error)
+	GetArrivedRides(ctx context.Context) ([]models.Ride, error)
+	MarkArrived(ctx context.Context, rideID, driverID string, event shared.OutboxMessage) (time.Time, error)
+	StartRide(ctx context.Context, rideID, driverID string, waitingFee float64, event shared.OutboxMessage) error
+	CancelNoShow(ctx context.Context, data *models.NoShow, driverID string, event shared.OutboxMessage) error
 }
 
 func NewRepo(db *pgxpool.Pool) Repo {
@@ -2,7 +2,6 @@ package usecase
 
 import (
 	"context"
-	"fmt"
 	"net/http"
 
 	"ride-hail/internal/driver/models"
@@ -10,21 +9,23 @@ import (
 )
 
 func (s *service) RegisterDriver(ctx context.Context, driverData *models.Driver) (int, error) {
+	logger := util.New().WithContext(ctx).With(util.FieldDriverID, driverData.ID)
+
 	err := s.repo.CheckUserExistsAndIsDriver(ctx, driverData.ID)
 	if err != nil {
-		fmt.Println("driver does not exist with such id: ", driverData.ID)
+		logger.Warn("RegisterDriver", "driver does not exist with such id")
 		return http.StatusBadRequest, err
 	}
 
 	err = util.CheckDriverData(*driverData)
 	if err != nil {
-		fmt.Println("invalid driver data: ", err)
+		logger.Warn("RegisterDriver", "invalid driver data: "+err.Error())
 		return http.StatusBadRequest, err
 	}
 
 	err = s.repo.InsertDriver(ctx, driverData)
 	if err != nil {
-		fmt.Println("could not insert driver data to db: ", err)
+		logger.Error("RegisterDriver", err)
 		return http.StatusBadGateway, err
 	}
 
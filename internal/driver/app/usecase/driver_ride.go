@@ -2,8 +2,17 @@ package usecase
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
 
 	"ride-hail/internal/driver/models"
+	"ride-hail/internal/shared/apperrors"
+	"ride-hail/internal/shared/events"
+	shared "ride-hail/internal/shared/models"
+	"ride-hail/internal/shared/util"
+	"ride-hail/internal/shared/waittime"
 )
 
 func (s *service) UpdateLocation(ctx context.Context, data *models.LocalHistory) (*models.Coordinate, error) {
@@ -17,3 +26,140 @@ func (s *service) UpdateLocation(ctx context.Context, data *models.LocalHistory)
 
 	return s.repo.UpdateCurrLocation(ctx, data, update)
 }
+
+func (s *service) ArriveAtPickup(ctx context.Context, driverID, rideID string) (*waittime.State, error) {
+	ride, err := s.driverRide(ctx, driverID, rideID)
+	if err != nil {
+		return nil, err
+	}
+
+	event, err := statusEvent(ctx, rideID, driverID, models.RideArrived, "")
+	if err != nil {
+		return nil, err
+	}
+
+	arrivedAt, err := s.repo.MarkArrived(ctx, rideID, driverID, event)
+	if err != nil {
+		return nil, err
+	}
+
+	state := s.waitTariffs.Calculate(rideID, ride.VehicleType, arrivedAt, time.Now())
+	return &state, nil
+}
+
+func (s *service) StartRide(ctx context.Context, driverID, rideID string) (*waittime.State, error) {
+	ride, err := s.driverRide(ctx, driverID, rideID)
+	if err != nil {
+		return nil, err
+	}
+
+	if ride.Status != models.RideArrived || ride.ArrivedAt == nil {
+		return nil, apperrors.ErrInvalidRideStatus
+	}
+
+	state := s.waitTariffs.Calculate(rideID, ride.VehicleType, *ride.ArrivedAt, time.Now())
+
+	event, err := statusEvent(ctx, rideID, driverID, models.RideInProgress, "")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.StartRide(ctx, rideID, driverID, state.WaitingFee, event); err != nil {
+		return nil, err
+	}
+
+	return &state, nil
+}
+
+// ReportNoShow cancels a ride whose passenger never came out. The driver is paid
+// the no-show fee plus whatever waiting time was billed until then.
+func (s *service) ReportNoShow(ctx context.Context, driverID, rideID string) (*models.NoShow, error) {
+	ride, err := s.driverRide(ctx, driverID, rideID)
+	if err != nil {
+		return nil, err
+	}
+
+	if ride.Status != models.RideArrived || ride.ArrivedAt == nil {
+		return nil, apperrors.ErrInvalidRideStatus
+	}
+
+	state := s.waitTariffs.Calculate(rideID, ride.VehicleType, *ride.ArrivedAt, time.Now())
+	if !state.NoShowAllowed {
+		return nil, apperrors.ErrNoShowTooEarly
+	}
+
+	result := &models.NoShow{
+		RideID:        rideID,
+		WaitedSeconds: state.WaitedSeconds,
+		WaitingFee:    state.WaitingFee,
+		NoShowFee:     state.NoShowFee,
+		DriverPayout:  state.WaitingFee + state.NoShowFee,
+	}
+
+	event, err := statusEvent(ctx, rideID, driverID, models.RideCancelled, "Passenger no-show")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.CancelNoShow(ctx, result, driverID, event); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// WaitingStates returns the current wait of every ride where a driver is at the pickup point, keyed by driver.
+func (s *service) WaitingStates(ctx context.Context) (map[string]waittime.State, error) {
+	rides, err := s.repo.GetArrivedRides(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	states := make(map[string]waittime.State, len(rides))
+	for _, ride := range rides {
+		states[ride.DriverID] = s.waitTariffs.Calculate(ride.ID, ride.VehicleType, *ride.ArrivedAt, now)
+	}
+
+	return states, nil
+}
+
+func (s *service) driverRide(ctx context.Context, driverID, rideID string) (*models.Ride, error) {
+	ride, err := s.repo.GetRide(ctx, rideID)
+	if err != nil {
+		return nil, err
+	}
+
+	if ride.DriverID != driverID {
+		return nil, apperrors.ErrRideNotAssigned
+	}
+
+	return ride, nil
+}
+
+// statusEvent builds the ride.status.{status} message that the repo writes to
+// the outbox together with the status change.
+func statusEvent(ctx context.Context, rideID, driverID, status, reason string) (shared.OutboxMessage, error) {
+	correlationID := util.RequestID(ctx)
+	env, err := events.New(events.TypeRideStatusChanged, "driver-service", correlationID, events.RideStatusChanged{
+		RideID:    rideID,
+		Status:    status,
+		DriverID:  driverID,
+		Reason:    reason,
+		Timestamp: time.Now().UTC(),
+	})
+	if err != nil {
+		return shared.OutboxMessage{}, err
+	}
+	body, err := json.Marshal(env)
+	if err != nil {
+		return shared.OutboxMessage{}, fmt.Errorf("failed to marshal %s event: %w", events.TypeRideStatusChanged, err)
+	}
+	return shared.OutboxMessage{
+		EventID:       env.EventID,
+		CorrelationID: correlationID,
+		Exchange:      "ride_topic",
+		RoutingKey:    "ride.status." + strings.ToLower(status),
+		Payload:       body,
+	}, nil
+}
@@ -4,13 +4,13 @@ import (
 	"context"
 
 	"ride-hail/internal/driver/adapter/psql"
-	"ride-hail/internal/driver/adapter/rmq"
 	"ride-hail/internal/driver/models"
+	"ride-hail/internal/shared/waittime"
 )
 
 type service struct {
-	repo   psql.Repo
-	broker rmq.Broker
+	repo        psql.Repo
+	waitTariffs waittime.Tariffs
 }
 
 type Service interface {
@@ -18,8 +18,12 @@ type Service interface {
 	StartSession(ctx context.Context, data models.Location) (string, error)
 	FinishSession(ctx context.Context, id string) error
 	UpdateLocation(ctx context.Context, data *models.LocalHistory) (*models.Coordinate, error)
+	ArriveAtPickup(ctx context.Context, driverID, rideID string) (*waittime.State, error)
+	StartRide(ctx context.Context, driverID, rideID string) (*waittime.State, error)
+	ReportNoShow(ctx context.Context, driverID, rideID string) (*models.NoShow, error)
+	WaitingStates(ctx context.Context) (map[string]waittime.State, error)
 }
 
-func NewService(repo psql.Repo, broker rmq.Broker) Service {
-	return &service{repo, broker}
+func NewService(repo psql.Repo, waitTariffs waittime.Tariffs) Service {
+	return &service{repo, waitTariffs}
 }
@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+const (
+	RideMatched    = "MATCHED"
+	RideEnRoute    = "EN_ROUTE"
+	RideArrived    = "ARRIVED"
+	RideInProgress = "IN_PROGRESS"
+	RideCancelled  = "CANCELLED"
+)
+
+type Ride struct {
+	ID          string     `db:"id" json:"ride_id"`
+	PassengerID string     `db:"passenger_id" json:"passenger_id"`
+	DriverID    string     `db:"driver_id" json:"driver_id"`
+	VehicleType string     `db:"vehicle_type" json:"vehicle_type"`
+	Status      string     `db:"status" json:"status"`
+	ArrivedAt   *time.Time `db:"arrived_at" json:"arrived_at,omitempty"`
+}
+
+type RideAction struct {
+	RideID string `json:"ride_id"`
+}
+
+type NoShow struct {
+	RideID        string  `json:"ride_id"`
+	WaitedSeconds int     `json:"waited_seconds"`
+	WaitingFee    float64 `json:"waiting_fee"`
+	NoShowFee     float64 `json:"no_show_fee"`
+	DriverPayout  float64 `json:"driver_payout"`
+}
@@ -3,73 +3,41 @@ package api
 import (
 	"context"
 	"net/http"
-	"ride-hail/internal/ride/repo"
 	"ride-hail/internal/shared/util"
 	"strings"
-	"time"
 
-	jwt "github.com/golang-jwt/jwt/v5"
+	"ride-hail/internal/shared/auth"
 )
 
-var jwtSecret = []byte("supersecret")
-
-type Claims struct {
-	PassengerID string `json:"sub"`
-	Role        string `json:"role"`
-	jwt.RegisteredClaims
-}
-
-func AuthMiddleware(rideRepo *repo.RideRepo) func(http.Handler) http.Handler {
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			authHeader := r.Header.Get("Authorization")
-			if authHeader == "" {
-				util.WriteJSONError(w, "missing Authorization header", http.StatusUnauthorized)
-				return
-			}
-
-			parts := strings.Split(authHeader, " ")
-			if len(parts) != 2 || parts[0] != "Bearer" {
-				util.WriteJSONError(w, "invalid Authorization format", http.StatusUnauthorized)
-				return
-			}
-
-			tokenStr := parts[1]
-			claims := &Claims{}
-
-			token, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
-				return jwtSecret, nil
-			})
-			if err != nil || !token.Valid {
-				util.WriteJSONError(w, "invalid or expired token", http.StatusUnauthorized)
-				return
-			}
-
-			if time.Now().After(claims.ExpiresAt.Time) {
-				util.WriteJSONError(w, "token expired", http.StatusUnauthorized)
-				return
-			}
-
-			exists, err := rideRepo.Exists(r.Context(), claims.PassengerID)
-			if err != nil {
-				util.WriteJSONError(w, "failed to check user existence", http.StatusInternalServerError)
-				return
-			}
-			if !exists {
-				util.WriteJSONError(w, "user not found or deleted", http.StatusUnauthorized)
-				return
-			}
-
-			ctx := context.WithValue(r.Context(), "passenger_id", claims.PassengerID)
-			ctx = context.WithValue(ctx, "role", claims.Role)
-			ctx = context.WithValue(ctx, "token_exp", claims.ExpiresAt.Time)
-
-			if time.Now().After(claims.ExpiresAt.Time) {
-				util.WriteJSONError(w, "token expired", http.StatusUnauthorized)
-				return
-			}
-
-			next.ServeHTTP(w, r.WithContext(ctx))
-		})
-	}
+// AuthMiddleware accepts valid tokens that are not on the revocation list.
+// auth-service revokes the tokens of users that are banned or deactivated,
+// including passengers who deactivate their own account, and refuses them new
+// ones, so no database lookup is needed to keep them from requesting rides.
+func AuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authHeader := r.Header.Get("Authorization")
+		if authHeader == "" {
+			util.WriteJSONError(w, "missing Authorization header", http.StatusUnauthorized)
+			return
+		}
+
+		parts := strings.Split(authHeader, " ")
+		if len(parts) != 2 || parts[0] != "Bearer" {
+			util.WriteJSONError(w, "invalid Authorization format", http.StatusUnauthorized)
+			return
+		}
+
+		tokenStr := parts[1]
+		claims, err := auth.ParseToken(tokenStr)
+		if err != nil {
+			auth.WriteAuthError(w, err)
+			return
+		}
+
+		ctx := auth.WithClaims(r.Context(), claims)
+		ctx = context.WithValue(ctx, "passenger_id", claims.UserID)
+		ctx = context.WithValue(ctx, "token_exp", claims.ExpiresAt.Time)
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
 }
@@ -13,7 +13,7 @@ import (
 )
 
 func (h *Handler) CreateRideHandler(w http.ResponseWriter, r *http.Request) {
-	logger := util.New()
+	logger := util.New().WithContext(r.Context())
 	start := time.Now()
 
 	passengerID, ok := r.Context().Value("passenger_id").(string)
@@ -23,13 +23,6 @@ func (h *Handler) CreateRideHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	role, _ := r.Context().Value("role").(string)
-	if role != "PASSENGER" {
-		logger.Warn("CreateRideHandler", "forbidden: role is not PASSENGER")
-		util.WriteJSONError(w, "forbidden: only passengers can create rides", http.StatusForbidden)
-		return
-	}
-
 	var input domain.CreateRideRequest
 	decoder := json.NewDecoder(r.Body)
 	decoder.DisallowUnknownFields()
@@ -50,8 +43,17 @@ func (h *Handler) CreateRideHandler(w http.ResponseWriter, r *http.Request) {
 	logger.Info("CreateRideHandler", "creating new ride...")
 	ride, err := h.service.CreateRide(ctx, passengerID, input)
 	if err != nil {
-		logger.Error("CreateRideHandler", err)
-		util.WriteJSONError(w, err.Error(), http.StatusUnprocessableEntity)
+		switch {
+		case errors.Is(err, domain.ErrInvalidCoordinates), errors.Is(err, domain.ErrInvalidRideType):
+			logger.Warn("CreateRideHandler", "rejected ride request: "+err.Error())
+			util.WriteJSONError(w, err.Error(), http.StatusUnprocessableEntity)
+			logger.HTTP(http.StatusUnprocessableEntity, time.Since(start), r.RemoteAddr, r.Method, r.URL.Path)
+		default:
+			// a 5xx releases the Idempotency-Key, so the client can retry
+			logger.Error("CreateRideHandler", err)
+			util.WriteJSONError(w, "failed to create ride", http.StatusInternalServerError)
+			logger.HTTP(http.StatusInternalServerError, time.Since(start), r.RemoteAddr, r.Method, r.URL.Path)
+		}
 		return
 	}
 
@@ -73,7 +75,7 @@ func (h *Handler) CreateRideHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) CancelRideHandler(w http.ResponseWriter, r *http.Request) {
-	logger := util.New()
+	logger := util.New().WithContext(r.Context())
 	start := time.Now()
 
 	pathParts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
@@ -92,12 +94,6 @@ func (h *Handler) CancelRideHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	role, _ := r.Context().Value("role").(string)
-	if role != "PASSENGER" {
-		logger.Warn("CancelRideHandler", "forbidden: non-passenger tried to cancel ride")
-		util.WriteJSONError(w, "forbidden: only passengers can cancel rides", http.StatusForbidden)
-	}
-
 	var body struct {
 		Reason string `json:"reason"`
 	}
@@ -151,3 +147,50 @@ func (h *Handler) CancelRideHandler(w http.ResponseWriter, r *http.Request) {
 	logger.OK("CancelRideHandler", "ride cancelled successfully: "+rideID)
 	logger.HTTP(http.StatusOK, time.Since(start), r.RemoteAddr, r.Method, r.URL.Path)
 }
+
+func (h *Handler) GetRideHandler(w http.ResponseWriter, r *http.Request) {
+	logger := util.New().WithContext(r.Context())
+	start := time.Now()
+
+	passengerID, ok := r.Context().Value("passenger_id").(string)
+	if !ok || passengerID == "" {
+		logger.Warn("GetRideHandler", "unauthorized request: missing passenger_id")
+		util.WriteJSONError(w, "unauthorized: missing passenger_id", http.StatusUnauthorized)
+		return
+	}
+
+	ref := r.PathValue("ride")
+	ride, err := h.service.GetPassengerRide(r.Context(), ref, passengerID)
+	if err != nil {
+		h.writeRideLookupError(w, logger, "GetRideHandler", ref, err)
+		return
+	}
+
+	util.ResponseInJson(w, http.StatusOK, ride)
+	logger.HTTP(http.StatusOK, time.Since(start), r.RemoteAddr, r.Method, r.URL.Path)
+}
+
+func (h *Handler) AdminGetRideHandler(w http.ResponseWriter, r *http.Request) {
+	logger := util.New().WithContext(r.Context())
+	start := time.Now()
+
+	ref := r.PathValue("ride")
+	ride, err := h.service.GetRide(r.Context(), ref)
+	if err != nil {
+		h.writeRideLookupError(w, logger, "AdminGetRideHandler", ref, err)
+		return
+	}
+
+	util.ResponseInJson(w, http.StatusOK, ride)
+	logger.HTTP(http.StatusOK, time.Since(start), r.RemoteAddr, r.Method, r.URL.Path)
+}
+
+func (h *Handler) writeRideLookupError(w http.ResponseWriter, logger *util.Logger, instance, ref string, err error) {
+	if errors.Is(err, domain.ErrNotFound) {
+		logger.Warn(instance, "ride not found: "+ref)
+		util.WriteJSONError(w, "ride not found", http.StatusNotFound)
+		return
+	}
+	logger.Error(instance, err)
+	util.WriteJSONError(w, "failed to get ride", http.StatusInternalServerError)
+}
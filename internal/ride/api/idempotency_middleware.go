@@ -0,0 +1,110 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"ride-hail/internal/ride/domain"
+	"ride-hail/internal/shared/util"
+	"time"
+)
+
+const IdempotencyHeader = "Idempotency-Key"
+
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	rec.status = status
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
+
+// IdempotencyMiddleware replays the stored response when a client retries a
+// request with the same Idempotency-Key. It must run after AuthMiddleware,
+// because keys are scoped to the passenger.
+func IdempotencyMiddleware(store domain.IdempotencyStore) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(IdempotencyHeader)
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > 255 {
+				util.WriteJSONError(w, "Idempotency-Key must be at most 255 characters", http.StatusBadRequest)
+				return
+			}
+
+			passengerID, _ := r.Context().Value("passenger_id").(string)
+			if passengerID == "" {
+				util.WriteJSONError(w, "unauthorized: missing passenger_id", http.StatusUnauthorized)
+				return
+			}
+
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				util.WriteJSONError(w, "failed to read request body", http.StatusBadRequest)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			sum := sha256.Sum256(append([]byte(r.Method+" "+r.URL.Path+"\n"), body...))
+			fingerprint := hex.EncodeToString(sum[:])
+
+			stored, err := store.ReserveIdempotencyKey(r.Context(), passengerID, key, fingerprint)
+			if err != nil {
+				util.New().WithContext(r.Context()).Error("IdempotencyMiddleware", fmt.Errorf("failed to reserve key: %w", err))
+				util.WriteJSONError(w, "failed to check idempotency key", http.StatusInternalServerError)
+				return
+			}
+
+			if stored != nil {
+				switch {
+				case stored.Fingerprint != fingerprint:
+					util.WriteJSONError(w, "Idempotency-Key was already used with a different request", http.StatusUnprocessableEntity)
+				case stored.StatusCode == nil:
+					util.WriteJSONError(w, "a request with this Idempotency-Key is still being processed", http.StatusConflict)
+				default:
+					w.Header().Set("Content-Type", "application/json")
+					w.Header().Set("Idempotent-Replayed", "true")
+					w.WriteHeader(*stored.StatusCode)
+					_, _ = w.Write(stored.Body)
+				}
+				return
+			}
+
+			rec := &responseRecorder{ResponseWriter: w}
+			next.ServeHTTP(rec, r)
+
+			// the response is already sent, so a slow or cancelled client must not stop us from storing it
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			if rec.status == 0 || rec.status >= http.StatusInternalServerError {
+				if err := store.ReleaseIdempotencyKey(ctx, passengerID, key); err != nil {
+					util.New().WithContext(r.Context()).Error("IdempotencyMiddleware", fmt.Errorf("failed to release key: %w", err))
+				}
+				return
+			}
+
+			if err := store.SaveIdempotentResponse(ctx, passengerID, key, rec.status, rec.body.Bytes()); err != nil {
+				util.New().WithContext(r.Context()).Error("IdempotencyMiddleware", fmt.Errorf("failed to save response: %w", err))
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"ride-hail/internal/ride/app"
+	"ride-hail/internal/ride/domain"
+	"ride-hail/internal/shared/models"
+	"ride-hail/internal/shared/settings"
+	"ride-hail/internal/shared/util"
+)
+
+type memoryIdempotencyStore struct {
+	mu      sync.Mutex
+	records map[string]*domain.IdempotencyRecord
+}
+
+func (s *memoryIdempotencyStore) ReserveIdempotencyKey(ctx context.Context, userID, key, fingerprint string) (*domain.IdempotencyRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if rec, ok := s.records[userID+"/"+key]; ok {
+		return rec, nil
+	}
+	s.records[userID+"/"+key] = &domain.IdempotencyRecord{Key: key, Fingerprint: fingerprint}
+	return nil, nil
+}
+
+func (s *memoryIdempotencyStore) SaveIdempotentResponse(ctx context.Context, userID, key string, status int, body []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec := s.records[userID+"/"+key]
+	rec.StatusCode = &status
+	rec.Body = body
+	return nil
+}
+
+func (s *memoryIdempotencyStore) ReleaseIdempotencyKey(ctx context.Context, userID, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, userID+"/"+key)
+	return nil
+}
+
+// failingRideRepo fails every ride insert; the other methods are not used.
+type failingRideRepo struct {
+	domain.RideRepository
+	calls int
+}
+
+func (r *failingRideRepo) CreateRide(ctx context.Context, ride *domain.Ride, requested func(*domain.Ride) (models.OutboxMessage, error)) error {
+	r.calls++
+	return errors.New("connection refused")
+}
+
+func TestCreateRideRetriesAfterServerError(t *testing.T) {
+	rideRepo := &failingRideRepo{}
+	cfg := models.RideServiceConfig{Tariffs: []models.Tariff{{RideType: "ECONOMY", BaseFare: 500, PerKm: 100, PerMinute: 50}}}
+	store := settings.NewStore(nil, map[string]string{settings.MatchTimeout: "2m"}, util.New())
+	h := NewHandler(app.NewRideService(rideRepo, cfg, nil, store, util.New()))
+
+	handler := IdempotencyMiddleware(&memoryIdempotencyStore{records: map[string]*domain.IdempotencyRecord{}})(http.HandlerFunc(h.CreateRideHandler))
+	body := `{"pickup_latitude":43.238,"pickup_longitude":76.889,"pickup_address":"A","destination_latitude":43.222,"destination_longitude":76.851,"destination_address":"B","ride_type":"ECONOMY"}`
+
+	for attempt := 1; attempt <= 2; attempt++ {
+		req := httptest.NewRequest(http.MethodPost, "/rides", strings.NewReader(body))
+		req.Header.Set(IdempotencyHeader, "retry-key")
+		req = req.WithContext(context.WithValue(req.Context(), "passenger_id", "passenger-1"))
+		rec := httptest.NewRecorder()
+
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusInternalServerError {
+			t.Fatalf("attempt %d: status = %d, want %d", attempt, rec.Code, http.StatusInternalServerError)
+		}
+		if rec.Header().Get("Idempotent-Replayed") != "" {
+			t.Errorf("attempt %d: response was replayed", attempt)
+		}
+		if strings.Contains(rec.Body.String(), "connection refused") {
+			t.Errorf("attempt %d: response leaks the internal error: %s", attempt, rec.Body.String())
+		}
+		if rideRepo.calls != attempt {
+			t.Fatalf("attempt %d: CreateRide called %d times, want %d", attempt, rideRepo.calls, attempt)
+		}
+	}
+}
@@ -4,6 +4,9 @@ import (
 	"net/http"
 	"ride-hail/internal/ride/app"
 	"ride-hail/internal/ride/repo"
+	"ride-hail/internal/shared/auth"
+	"ride-hail/internal/shared/metrics"
+	"ride-hail/internal/shared/util"
 )
 
 type Handler struct {
@@ -17,8 +20,19 @@ func NewHandler(service *app.RideService) *Handler {
 func (h *Handler) RegisterRoutes(rideRepo *repo.RideRepo) *http.ServeMux {
 	mux := http.NewServeMux()
 
-	mux.Handle("/rides", AuthMiddleware(rideRepo)(http.HandlerFunc(h.CreateRideHandler)))
-	mux.Handle("/rides/", AuthMiddleware(rideRepo)(http.HandlerFunc(h.CancelRideHandler)))
+	idempotent := IdempotencyMiddleware(rideRepo)
+
+	mux.Handle("/rides", authorized(auth.PermRideCreate, idempotent(http.HandlerFunc(h.CreateRideHandler))))
+	mux.Handle("/rides/", authorized(auth.PermRideCancel, idempotent(http.HandlerFunc(h.CancelRideHandler))))
+	mux.Handle("GET /rides/{ride}", authorized(auth.PermRideReadOwn, http.HandlerFunc(h.GetRideHandler)))
+	mux.Handle("GET /admin/rides/{ride}", authorized(auth.PermRideReadAll, http.HandlerFunc(h.AdminGetRideHandler)))
 	mux.HandleFunc("/ws/passengers/", h.PassengerWSHandler)
+	mux.Handle("/admin/log-level", auth.RequirePermission(auth.PermSettingsManage, util.LogLevelHandler()))
+	mux.Handle("GET /metrics", metrics.Handler())
 	return mux
 }
+
+// authorized checks the token, then that it grants p.
+func authorized(p auth.Permission, next http.Handler) http.Handler {
+	return AuthMiddleware(auth.RequirePermission(p, next))
+}
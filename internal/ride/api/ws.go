@@ -2,13 +2,14 @@ package api
 
 import (
 	"context"
-	"encoding/json"
-	"log"
+	"errors"
 	"net/http"
+	"ride-hail/internal/shared/auth"
+	"ride-hail/internal/shared/metrics"
+	"ride-hail/internal/shared/util"
+	"ride-hail/internal/shared/ws"
 	"strings"
-	"time"
 
-	jwt "github.com/golang-jwt/jwt/v5"
 	"github.com/gorilla/websocket"
 )
 
@@ -16,7 +17,7 @@ var upgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool { return true },
 }
 
-var activeConnections = make(map[string]*websocket.Conn)
+var passengers = ws.NewHub()
 
 func (h *Handler) PassengerWSHandler(w http.ResponseWriter, r *http.Request) {
 	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
@@ -25,72 +26,40 @@ func (h *Handler) PassengerWSHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	passengerID := parts[2]
+	logger := util.New().WithContext(r.Context()).With("passenger_id", passengerID)
 
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.Printf("upgrade failed: %v", err)
+		logger.Error("PassengerWSHandler", err)
 		return
 	}
 	defer conn.Close()
 
-	log.Printf("New WS connection from passenger: %s", passengerID)
-
-	authenticated := false
-	tokenTimer := time.NewTimer(5 * time.Second)
-
-	authChan := make(chan string)
-
-	go func() {
-		for {
-			_, msg, err := conn.ReadMessage()
-			if err != nil {
-				log.Printf("read error: %v", err)
-				break
-			}
-
-			var authMsg AuthMessage
-			if err := json.Unmarshal(msg, &authMsg); err != nil {
-				continue
-			}
-
-			if authMsg.Type == "auth" {
-				authChan <- authMsg.Token
-				return
-			}
-		}
-	}()
-
-	select {
-	case tokenStr := <-authChan:
-		if validateWebSocketToken(tokenStr, passengerID) {
-			authenticated = true
-			activeConnections[passengerID] = conn
-			_ = conn.WriteJSON(WSResponse{Type: "auth_success", Message: "authenticated"})
-		} else {
-			_ = conn.WriteJSON(WSResponse{Type: "error", Message: "invalid token"})
-			return
-		}
-	case <-tokenTimer.C:
-		_ = conn.WriteJSON(WSResponse{Type: "error", Message: "auth timeout"})
+	metrics.WebSocketConnections.Inc("passenger")
+	defer metrics.WebSocketConnections.Dec("passenger")
+
+	logger.Info("PassengerWSHandler", "new WS connection")
+
+	session := ws.NewSession(conn)
+	tokenStr, err := session.Token()
+	if errors.Is(err, ws.ErrAuthTimeout) {
+		_ = conn.WriteJSON(ws.Message{Type: "error", Message: "auth timeout"})
+		return
+	} else if err != nil {
+		logger.Debug("PassengerWSHandler", "read error: "+err.Error())
 		return
 	}
-
-	if !authenticated {
+	if !validateWebSocketToken(tokenStr, passengerID) {
+		_ = conn.WriteJSON(ws.Message{Type: "error", Message: "invalid token"})
 		return
 	}
 
-	ticker := time.NewTicker(30 * time.Second)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-ticker.C:
-			if err := conn.WriteMessage(websocket.PingMessage, []byte{}); err != nil {
-				log.Printf("ping failed: %v", err)
-				delete(activeConnections, passengerID)
-				return
-			}
-		}
+	passengers.Add(passengerID, conn)
+	defer passengers.Remove(passengerID, conn)
+	_ = conn.WriteJSON(ws.Message{Type: "auth_success", Message: "authenticated"})
+
+	if err := session.KeepAlive(); err != nil {
+		logger.Warn("PassengerWSHandler", "ping failed: "+err.Error())
 	}
 }
 
@@ -101,21 +70,25 @@ func validateWebSocketToken(headerToken, passengerID string) bool {
 	}
 
 	tokenStr := parts[1]
-	claims := &Claims{}
-	token, err := jwt.ParseWithClaims(tokenStr, claims, func(t *jwt.Token) (interface{}, error) {
-		return jwtSecret, nil
-	})
-	if err != nil || !token.Valid {
+	claims, err := auth.ParseToken(tokenStr)
+	if err != nil {
 		return false
 	}
 
-	return claims.PassengerID == passengerID
+	return claims.UserID == passengerID && claims.Can(auth.PermRideReadOwn)
 }
 
-func SendToPassenger(ctx context.Context, passengerID string, event WSResponse) error {
-	conn, ok := activeConnections[passengerID]
-	if !ok {
-		return nil
-	}
-	return conn.WriteJSON(event)
+func SendToPassenger(ctx context.Context, passengerID string, event ws.Message) error {
+	return passengers.Send(passengerID, event)
+}
+
+// StartWaitTimeBroadcaster pushes the pickup countdown to every waiting passenger.
+func (h *Handler) StartWaitTimeBroadcaster(ctx context.Context) {
+	passengers.BroadcastWaitTimes(ctx, h.service.WaitingStates, "your driver is waiting")
+}
+
+// CloseWebSockets tells every connected passenger to reconnect. It is a step
+// of the graceful shutdown.
+func (h *Handler) CloseWebSockets(ctx context.Context) error {
+	return passengers.Close(ctx)
 }
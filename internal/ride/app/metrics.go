@@ -0,0 +1,17 @@
+package app
+
+import "ride-hail/internal/shared/metrics"
+
+var (
+	ridesCreated = metrics.NewCounterVec("rides_created_total",
+		"Rides requested by passengers, by ride type.", "ride_type")
+	ridesCancelled = metrics.NewCounterVec("rides_cancelled_total",
+		"Rides cancelled, by ride type and who cancelled (passenger, no_driver).", "ride_type", "cancelled_by")
+	ridesMatched = metrics.NewCounterVec("rides_matched_total",
+		"Rides matched to a driver, by ride type.", "ride_type")
+
+	// matchLatency runs up to the 2 minute match timeout.
+	matchLatency = metrics.NewHistogramVec("ride_match_latency_seconds",
+		"Time from ride request to driver match in seconds, by ride type.",
+		[]float64{1, 2, 5, 10, 15, 30, 45, 60, 90, 120}, "ride_type")
+)
@@ -3,50 +3,73 @@ package app
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
 	"ride-hail/internal/ride/domain"
+	"ride-hail/internal/shared/events"
+	"ride-hail/internal/shared/models"
+	"ride-hail/internal/shared/settings"
 	"ride-hail/internal/shared/util"
+	"ride-hail/internal/shared/waittime"
+	"strings"
+	"sync"
 	"time"
+
+	"github.com/google/uuid"
 )
 
 type RideService struct {
 	repo   domain.RideRepository
-	pub    domain.Publisher
 	logger *util.Logger
-}
 
-func NewRideService(repo domain.RideRepository, pub domain.Publisher, logger *util.Logger) *RideService {
-	return &RideService{repo: repo, pub: pub, logger: logger}
+	settings    *settings.Store
+	tariffs     map[string]models.Tariff
+	waitTariffs waittime.Tariffs
+
+	// match timers outlive the request that created the ride
+	timersCtx  context.Context
+	stopTimers context.CancelFunc
+	timers     sync.WaitGroup
 }
 
-var fareRates = map[string]struct {
-	Base   float64
-	PerKm  float64
-	PerMin float64
-}{
-	"ECONOMY": {Base: 500, PerKm: 100, PerMin: 50},
-	"PREMIUM": {Base: 800, PerKm: 120, PerMin: 60},
-	"XL":      {Base: 1000, PerKm: 150, PerMin: 75},
+func NewRideService(repo domain.RideRepository, cfg models.RideServiceConfig, waitTariffs waittime.Tariffs, store *settings.Store, logger *util.Logger) *RideService {
+	tariffs := make(map[string]models.Tariff, len(cfg.Tariffs))
+	for _, t := range cfg.Tariffs {
+		tariffs[t.RideType] = t
+	}
+
+	timersCtx, stopTimers := context.WithCancel(context.Background())
+	return &RideService{
+		repo:        repo,
+		logger:      logger,
+		settings:    store,
+		tariffs:     tariffs,
+		waitTariffs: waitTariffs,
+		timersCtx:   timersCtx,
+		stopTimers:  stopTimers,
+	}
 }
 
 func (s *RideService) CreateRide(ctx context.Context, passengerID string, input domain.CreateRideRequest) (*domain.Ride, error) {
+	logger := s.logger.WithContext(ctx)
 	instance := "RideService.CreateRide"
 	start := time.Now()
+	// read once so the event and the timer agree even if it changes meanwhile
+	matchTimeout := s.settings.Duration(settings.MatchTimeout)
 
 	if input.PickupLat < -90 || input.PickupLat > 90 || input.PickupLng < -180 || input.PickupLng > 180 {
-		s.logger.Warn(instance, fmt.Sprintf("invalid pickup coordinates: lat=%.4f, lng=%.4f", input.PickupLat, input.PickupLng))
+		logger.Warn(instance, fmt.Sprintf("invalid pickup coordinates: lat=%.4f, lng=%.4f", input.PickupLat, input.PickupLng))
 		return nil, domain.ErrInvalidCoordinates
 	}
 
 	if input.DropoffLat < -90 || input.DropoffLat > 90 || input.DropoffLng < -180 || input.DropoffLng > 180 {
-		s.logger.Warn(instance, fmt.Sprintf("invalid dropoff coordinates: lat=%.4f, lng=%.4f", input.DropoffLat, input.DropoffLng))
+		logger.Warn(instance, fmt.Sprintf("invalid dropoff coordinates: lat=%.4f, lng=%.4f", input.DropoffLat, input.DropoffLng))
 		return nil, domain.ErrInvalidCoordinates
 	}
 
-	rate, ok := fareRates[input.RideType]
+	rate, ok := s.tariffs[input.RideType]
 	if !ok {
-		s.logger.Warn(instance, fmt.Sprintf("invalid ride type: %s", input.RideType))
+		logger.Warn(instance, fmt.Sprintf("invalid ride type: %s", input.RideType))
 		return nil, domain.ErrInvalidRideType
 	}
 
@@ -56,21 +79,20 @@ func (s *RideService) CreateRide(ctx context.Context, passengerID string, input
 		estimatedDuration = 1
 	}
 
-	estimatedFare := rate.Base + (distanceKm * rate.PerKm) + (float64(estimatedDuration) * rate.PerMin)
+	estimatedFare := rate.BaseFare + (distanceKm * rate.PerKm) + (float64(estimatedDuration) * rate.PerMinute)
 
 	rideID := util.GenerateUUID()
-	rideNumber := fmt.Sprintf("RIDE_%s_%06d", time.Now().Format("20060102"), time.Now().Unix()%1000000)
+	logger = logger.With(util.FieldRideID, rideID)
 
 	ride := domain.Ride{
 		ID:                rideID,
-		Number:            rideNumber,
 		PassengerID:       passengerID,
 		PickupAddress:     input.PickupAddress,
 		PickupLat:         input.PickupLat,
 		PickupLng:         input.PickupLng,
 		DropoffAddress:    input.DropoffAddress,
 		DropoffLat:        input.DropoffLat,
-		DropoffLng:        input.PickupLng,
+		DropoffLng:        input.DropoffLng,
 		Status:            "REQUESTED",
 		RideType:          input.RideType,
 		EstimatedFare:     estimatedFare,
@@ -79,62 +101,60 @@ func (s *RideService) CreateRide(ctx context.Context, passengerID string, input
 		CreatedAt:         time.Now(),
 	}
 
-	if err := s.repo.CreateRide(ctx, ride); err != nil {
-		s.logger.Error(instance, fmt.Errorf("failed to create ride in DB: %w", err))
+	requested := func(ride *domain.Ride) (models.OutboxMessage, error) {
+		event := events.RideRequested{
+			RideID:     ride.ID,
+			RideNumber: ride.Number,
+			PickupLocation: events.Location{
+				Lat:     input.PickupLat,
+				Lng:     input.PickupLng,
+				Address: input.PickupAddress,
+			},
+			DestinationLocation: events.Location{
+				Lat:     input.DropoffLat,
+				Lng:     input.DropoffLng,
+				Address: input.DropoffAddress,
+			},
+			RideType:       ride.RideType,
+			EstimatedFare:  ride.EstimatedFare,
+			TimeoutSeconds: int(matchTimeout.Seconds()),
+		}
+		return newOutboxMessage(ctx, "ride_topic", fmt.Sprintf("ride.request.%s", ride.RideType), events.TypeRideRequested, event)
+	}
+
+	if err := s.repo.CreateRide(ctx, &ride, requested); err != nil {
+		logger.Error(instance, fmt.Errorf("failed to create ride in DB: %w", err))
 		return nil, err
 	}
 
-	event := map[string]interface{}{
-		"ride_id":     ride.ID,
-		"ride_number": ride.Number,
-		"pickup_location": map[string]interface{}{
-			"lat":     input.PickupLat,
-			"lng":     input.PickupLng,
-			"address": input.PickupAddress,
-		},
-		"destination_location": map[string]interface{}{
-			"lat":     input.DropoffLat,
-			"lng":     input.DropoffLng,
-			"address": input.DropoffAddress,
-		},
-		"ride_type":       ride.RideType,
-		"estimated_fare":  ride.EstimatedFare,
-		"timeout_seconds": 120,
-		"correlation_id":  "",
-	}
-	body, _ := json.Marshal(event)
-	routingKey := fmt.Sprintf("ride.request.%s", ride.RideType)
-	if err := s.pub.Publish(ctx, "ride_topic", routingKey, body); err != nil {
-		s.logger.Warn(instance, fmt.Sprintf("failed to publish ride request: %v", err))
-	} else {
-		s.logger.OK(instance, fmt.Sprintf("ride request published to %s", routingKey))
-	}
-
-	s.logger.Info(instance, fmt.Sprintf("ride created successfully [ride_id=%s, fare=%.2f, type=%s, duration_ms=%d]",
-		rideID, estimatedFare, input.RideType, time.Since(start).Milliseconds()))
-
-	go s.startDriverMatchtimer(ctx, rideID, 2*time.Minute)
+	logger.Info(instance, fmt.Sprintf("ride created successfully [ride_number=%s, fare=%.2f, type=%s, duration_ms=%d]",
+		ride.Number, estimatedFare, input.RideType, time.Since(start).Milliseconds()))
+
+	ridesCreated.Inc(ride.RideType)
+
+	s.scheduleMatchTimeout(ctx, rideID, matchTimeout)
 
 	return &ride, nil
 }
 
 func (s *RideService) CancelRide(ctx context.Context, rideID, passengerID, reason string) (int, error) {
+	logger := s.logger.WithContext(ctx).With(util.FieldRideID, rideID)
 	instance := "RideService.CancelRide"
 	start := time.Now()
 
 	ride, err := s.repo.GetRideByID(ctx, rideID)
 	if err != nil {
-		s.logger.Warn(instance, fmt.Sprintf("ride not found: %s", rideID))
+		logger.Warn(instance, fmt.Sprintf("ride not found: %s", rideID))
 		return 0, domain.ErrNotFound
 	}
 
 	if ride.PassengerID != passengerID {
-		s.logger.Warn(instance, fmt.Sprintf("unauthorized cancellation attempt by passenger %s for ride %s", passengerID, rideID))
+		logger.Warn(instance, fmt.Sprintf("unauthorized cancellation attempt by passenger %s for ride %s", passengerID, rideID))
 		return 0, domain.ErrForbidden
 	}
 
 	if ride.Status != "REQUESTED" && ride.Status != "MATCHED" {
-		s.logger.Warn(instance, fmt.Sprintf("invalid status for cancellation: %s", ride.Status))
+		logger.Warn(instance, fmt.Sprintf("invalid status for cancellation: %s", ride.Status))
 		return 0, domain.ErrInvalidStatus
 	}
 
@@ -148,85 +168,217 @@ func (s *RideService) CancelRide(ctx context.Context, rideID, passengerID, reaso
 		refundPercent = 0
 	}
 
-	err = s.repo.UpdateStatus(ctx, rideID, "CANCELLED", reason)
-	if err != nil {
-		s.logger.Error(instance, fmt.Errorf("failed to update status: %w", err))
-		return 0, fmt.Errorf("failed to update ride: %w", err)
-	}
-
-	err = s.repo.CreateEvent(ctx, rideID, "RIDE_CANCELLED", reason)
-	if err != nil {
-		s.logger.Error(instance, fmt.Errorf("failed to create event: %w", err))
-		return 0, fmt.Errorf("failed to create event: %w", err)
-	}
-
-	event := domain.RideStatusEvent{
+	event, err := newOutboxMessage(ctx, "ride_topic", "ride.status.cancelled", events.TypeRideStatusChanged, events.RideStatusChanged{
 		RideID:    rideID,
 		Status:    "CANCELLED",
 		Reason:    reason,
 		Timestamp: time.Now().UTC(),
+	})
+	if err != nil {
+		return 0, err
 	}
-	err = s.pub.PublishRideStatus(event)
+
+	change, err := s.repo.CancelRide(ctx, rideID, reason, []string{"REQUESTED", "MATCHED"}, event)
 	if err != nil {
-		s.logger.Warn(instance, fmt.Sprintf("failed to publish ride cancel event: %v", err))
+		if errors.Is(err, domain.ErrInvalidStatus) {
+			logger.Warn(instance, fmt.Sprintf("ride %s changed status before it could be cancelled", rideID))
+			return 0, err
+		}
+		logger.Error(instance, fmt.Errorf("failed to cancel ride: %w", err))
+		return 0, fmt.Errorf("failed to cancel ride: %w", err)
 	}
 
-	s.logger.OK(instance, fmt.Sprintf("ride %s cancelled (refund=%d%%, duration=%dms)", rideID, refundPercent, time.Since(start).Milliseconds()))
+	ridesCancelled.Inc(change.RideType, "passenger")
+	logger.OK(instance, fmt.Sprintf("ride %s cancelled (refund=%d%%, duration=%dms)", rideID, refundPercent, time.Since(start).Milliseconds()))
 
 	return refundPercent, nil
 }
 
+// GetRide looks a ride up either by its id or by its RIDE_YYYYMMDD_NNNNNN number.
+func (s *RideService) GetRide(ctx context.Context, ref string) (*domain.Ride, error) {
+	if strings.HasPrefix(ref, "RIDE_") {
+		return s.repo.GetRideByNumber(ctx, ref)
+	}
+	if _, err := uuid.Parse(ref); err != nil {
+		return nil, domain.ErrNotFound
+	}
+	return s.repo.GetRideByID(ctx, ref)
+}
+
+// GetPassengerRide is GetRide limited to the passenger's own rides.
+func (s *RideService) GetPassengerRide(ctx context.Context, ref, passengerID string) (*domain.Ride, error) {
+	logger := s.logger.WithContext(ctx)
+	ride, err := s.GetRide(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	if ride.PassengerID != passengerID {
+		logger.Warn("RideService.GetPassengerRide", fmt.Sprintf("passenger %s requested foreign ride %s", passengerID, ride.ID))
+		return nil, domain.ErrNotFound
+	}
+	return ride, nil
+}
+
 func (s *RideService) HandleDriverAcceptance(ctx context.Context, rideID, driverID string) error {
+	logger := s.logger.WithContext(ctx).With(util.FieldRideID, rideID, util.FieldDriverID, driverID)
 	instance := "RideService.HandleDriverAcceptance"
 	start := time.Now()
 
-	err := s.repo.UpdateRideStatus(ctx, rideID, "MATCHED", driverID)
+	event, err := newOutboxMessage(ctx, "ride_topic", "ride.status.matched", events.TypeRideStatusChanged, events.RideStatusChanged{
+		RideID:    rideID,
+		DriverID:  driverID,
+		Status:    "MATCHED",
+		Timestamp: time.Now().UTC(),
+	})
 	if err != nil {
-		s.logger.Error(instance, fmt.Errorf("failed to update ride status: %w", err))
 		return err
 	}
 
-	event := map[string]interface{}{
-		"ride_id":   rideID,
-		"driver_id": driverID,
-		"status":    "MATCHED",
-		"timestamp": time.Now().UTC(),
+	change, err := s.repo.MatchRide(ctx, rideID, driverID, event)
+	if err != nil {
+		logger.Error(instance, fmt.Errorf("failed to match ride: %w", err))
+		return err
+	}
+	ridesMatched.Inc(change.RideType)
+	matchLatency.Observe(time.Since(change.RequestedAt).Seconds(), change.RideType)
+
+	logger.Info(instance, fmt.Sprintf("driver matched (took %dms)", time.Since(start).Milliseconds()))
+	return nil
+}
+
+func (s *RideService) HandleDriverRejection(ctx context.Context, rideID, driverID string) error {
+	s.logger.WithContext(ctx).With(util.FieldRideID, rideID, util.FieldDriverID, driverID).Info("RideService.HandleDriverRejection", "driver rejected ride")
+	return nil
+}
+
+// WaitingStates returns the pickup wait of every ride in ARRIVED status, keyed by passenger.
+func (s *RideService) WaitingStates(ctx context.Context) (map[string]waittime.State, error) {
+	rides, err := s.repo.ListArrivedRides(ctx)
+	if err != nil {
+		return nil, err
 	}
-	body, _ := json.Marshal(event)
 
-	if err := s.pub.Publish(ctx, "ride_topic", "ride.status.matched", body); err != nil {
-		s.logger.Warn(instance, fmt.Sprintf("failed to publish MATCHED event: %v", err))
-		log.Printf("publish matched failed: %v", err)
-	} else {
-		s.logger.OK(instance, fmt.Sprintf("published MATCHED event for ride %s", rideID))
+	now := time.Now()
+	states := make(map[string]waittime.State, len(rides))
+	for _, ride := range rides {
+		states[ride.PassengerID] = s.waitTariffs.Calculate(ride.RideID, ride.RideType, ride.ArrivedAt, now)
 	}
+	return states, nil
+}
+
+// scheduleMatchTimeout cancels the ride after duration unless a driver accepted
+// it by then. The timer keeps the request id of ctx but not its deadline.
+func (s *RideService) scheduleMatchTimeout(ctx context.Context, rideID string, duration time.Duration) {
+	timerCtx := util.WithRequestID(s.timersCtx, util.RequestID(ctx))
+
+	s.timers.Add(1)
+	go func() {
+		defer s.timers.Done()
+		s.startDriverMatchtimer(timerCtx, rideID, duration)
+	}()
+}
 
-	if err := s.repo.CreateEvent(ctx, rideID, "DRIVER_MATCHED", string(body)); err != nil {
-		s.logger.Warn(instance, fmt.Sprintf("failed to record event: %v", err))
+// ResumeMatchTimers restarts the timers of rides that were still waiting for a
+// driver when the service stopped, with the time they have left.
+func (s *RideService) ResumeMatchTimers(ctx context.Context) error {
+	rides, err := s.repo.ListRequestedRides(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list requested rides: %w", err)
 	}
 
-	s.logger.Info(instance, fmt.Sprintf("driver %s matched to ride %s (took %dms)", driverID, rideID, time.Since(start).Milliseconds()))
+	matchTimeout := s.settings.Duration(settings.MatchTimeout)
+	for _, ride := range rides {
+		remaining := time.Until(ride.RequestedAt.Add(matchTimeout))
+		s.scheduleMatchTimeout(ctx, ride.RideID, max(remaining, 0))
+	}
+	if len(rides) > 0 {
+		s.logger.Info("RideService.ResumeMatchTimers", fmt.Sprintf("resumed %d match timers", len(rides)))
+	}
 	return nil
 }
 
-func (s *RideService) HandleDriverRejection(ctx context.Context, rideID, driverID string) error {
-	log.Printf("[ride %s] driver %s rejected ride", rideID, driverID)
-	return nil
+// StopMatchTimers stops the pending timers and waits for the ones already
+// cancelling a ride. Their rides stay REQUESTED and are picked up again by
+// ResumeMatchTimers on the next start.
+func (s *RideService) StopMatchTimers(ctx context.Context) error {
+	s.stopTimers()
+
+	done := make(chan struct{})
+	go func() {
+		s.timers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("match timers did not stop in time: %w", ctx.Err())
+	}
 }
 
 func (s *RideService) startDriverMatchtimer(ctx context.Context, rideID string, duration time.Duration) {
+	logger := s.logger.WithContext(ctx).With(util.FieldRideID, rideID)
 	instance := "RideService.startDriverMatchtimer"
-	time.Sleep(duration)
+
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+		return
+	}
+	// the cancellation itself must not be cut short by shutdown
+	ctx = context.WithoutCancel(ctx)
 
 	currentStatus, err := s.repo.GetRideStatus(ctx, rideID)
 	if err != nil {
-		s.logger.Warn(instance, fmt.Sprintf("failed to fetch ride status: %v", err))
+		logger.Warn(instance, fmt.Sprintf("failed to fetch ride status: %v", err))
 		return
 	}
 
-	if currentStatus == "REQUESTED" {
-		_ = s.repo.UpdateRideStatus(ctx, rideID, "CANCELLED", "")
-		_ = s.repo.CreateEvent(ctx, rideID, "RIDE_CANCELLED", `{"reason": "No drivers available"}`)
-		s.logger.Info(instance, fmt.Sprintf("ride %s auto-cancelled after %.0fs (no drivers matched)", rideID, duration.Seconds()))
+	if currentStatus != "REQUESTED" {
+		return
+	}
+
+	const reason = "No drivers available"
+	event, err := newOutboxMessage(ctx, "ride_topic", "ride.status.cancelled", events.TypeRideStatusChanged, events.RideStatusChanged{
+		RideID:    rideID,
+		Status:    "CANCELLED",
+		Reason:    reason,
+		Timestamp: time.Now().UTC(),
+	})
+	if err != nil {
+		logger.Error(instance, err)
+		return
+	}
+
+	change, err := s.repo.CancelRide(ctx, rideID, reason, []string{"REQUESTED"}, event)
+	if err != nil {
+		if !errors.Is(err, domain.ErrInvalidStatus) {
+			logger.Warn(instance, fmt.Sprintf("failed to auto-cancel ride %s: %v", rideID, err))
+		}
+		return
+	}
+	ridesCancelled.Inc(change.RideType, "no_driver")
+	logger.Info(instance, fmt.Sprintf("ride %s auto-cancelled (no drivers matched within %s)", rideID, s.settings.Duration(settings.MatchTimeout)))
+}
+
+func newOutboxMessage(ctx context.Context, exchange, routingKey, eventType string, data interface{}) (models.OutboxMessage, error) {
+	correlationID := util.RequestID(ctx)
+	env, err := events.New(eventType, "ride-service", correlationID, data)
+	if err != nil {
+		return models.OutboxMessage{}, err
+	}
+	body, err := json.Marshal(env)
+	if err != nil {
+		return models.OutboxMessage{}, fmt.Errorf("failed to marshal %s event: %w", eventType, err)
 	}
+	return models.OutboxMessage{
+		EventID:       env.EventID,
+		CorrelationID: correlationID,
+		Exchange:      exchange,
+		RoutingKey:    routingKey,
+		Payload:       body,
+	}, nil
 }
@@ -2,67 +2,90 @@ package consumer
 
 import (
 	"context"
-	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
 	"ride-hail/internal/ride/app"
+	"ride-hail/internal/ride/domain"
+	"ride-hail/internal/shared/events"
+	"ride-hail/internal/shared/mq"
+	"ride-hail/internal/shared/util"
 
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
 type DriverResponseConsumer struct {
 	service *app.RideService
-	channel *amqp.Channel
+	conn    *mq.Connection
 	queue   string
+
+	consumer *mq.Consumer
 }
 
-func NewDriverResponseConsumer(service *app.RideService, ch *amqp.Channel) *DriverResponseConsumer {
+func NewDriverResponseConsumer(service *app.RideService, conn *mq.Connection) *DriverResponseConsumer {
 	return &DriverResponseConsumer{
 		service: service,
-		channel: ch,
+		conn:    conn,
 		queue:   "driver_responses",
 	}
 }
 
 func (c *DriverResponseConsumer) Start(ctx context.Context) error {
-	msgs, err := c.channel.Consume(
-		c.queue,
-		"",
-		true,
-		false,
-		false,
-		false,
-		nil,
-	)
-	if err != nil {
-		return err
+	c.consumer = c.conn.Consume(ctx, c.queue, mq.DefaultConsumerOptions, c.handle)
+	util.New().Info("DriverResponseConsumer", "consuming "+c.queue)
+	return nil
+}
+
+// Stop stops taking new responses and waits for the one being handled.
+func (c *DriverResponseConsumer) Stop(ctx context.Context) error {
+	if c.consumer == nil {
+		return nil
 	}
+	return c.consumer.Stop(ctx)
+}
+
+// Check reports whether the consumer goroutine is alive and subscribed.
+func (c *DriverResponseConsumer) Check(ctx context.Context) error {
+	if c.consumer == nil {
+		return errors.New("driver_responses consumer not started")
+	}
+	return c.consumer.Check(ctx)
+}
 
-	go func() {
-		for msg := range msgs {
-			var payload struct {
-				RideID   string `json:"ride_id"`
-				DriverID string `json:"driver_id"`
-				Accepted bool   `json:"accepted"`
-			}
+func (c *DriverResponseConsumer) handle(ctx context.Context, msg amqp.Delivery) error {
+	var payload events.DriverResponded
 
-			if err := json.Unmarshal(msg.Body, &payload); err != nil {
-				log.Printf("[driver_responses] invalid JSON: %v", err)
-				continue
-			}
+	meta, err := events.Decode(msg.Body, events.TypeDriverResponded, &payload)
+	if err != nil {
+		return mq.Permanent(err)
+	}
+	if util.RequestID(ctx) == "" {
+		ctx = util.WithRequestID(ctx, meta.CorrelationID)
+	}
+	logger := util.New().WithContext(ctx).With(util.FieldRideID, payload.RideID, util.FieldDriverID, payload.DriverID)
+	if meta.SchemaVersion < events.CurrentVersion {
+		logger.Info("DriverResponseConsumer", fmt.Sprintf("received v%d payload", meta.SchemaVersion))
+	}
+	if payload.RideID == "" || payload.DriverID == "" {
+		return mq.Permanent(errors.New("ride_id and driver_id are required"))
+	}
 
-			if payload.Accepted {
-				log.Printf("[driver_responses] Driver %s accepted ride %s", payload.DriverID, payload.RideID)
-				if err := c.service.HandleDriverAcceptance(ctx, payload.RideID, payload.DriverID); err != nil {
-					log.Printf("[driver_responses] handle acceptance failed: %v", err)
-				}
-			} else {
-				log.Printf("[driver_responses] Driver %s rejected ride %s", payload.DriverID, payload.RideID)
-				if err := c.service.HandleDriverRejection(ctx, payload.RideID, payload.DriverID); err != nil {
-					log.Printf("[driver_responses] handle rejection failed: %v", err)
-				}
-			}
+	if payload.Accepted {
+		logger.Info("DriverResponseConsumer", "driver accepted ride")
+		err := c.service.HandleDriverAcceptance(ctx, payload.RideID, payload.DriverID)
+		if errors.Is(err, domain.ErrInvalidStatus) {
+			// the ride was cancelled or matched to someone else in the meantime
+			logger.Warn("DriverResponseConsumer", "ride is no longer waiting for a driver")
+			return nil
 		}
-	}()
-	log.Println("driver_responses consumer started")
+		if err != nil {
+			return fmt.Errorf("handle acceptance failed: %w", err)
+		}
+		return nil
+	}
+
+	logger.Info("DriverResponseConsumer", "driver rejected ride")
+	if err := c.service.HandleDriverRejection(ctx, payload.RideID, payload.DriverID); err != nil {
+		return fmt.Errorf("handle rejection failed: %w", err)
+	}
 	return nil
 }
@@ -1,25 +1,37 @@
 package domain
 
-import "context"
+import (
+	"context"
+	"ride-hail/internal/shared/models"
+)
 
 type RideRepository interface {
-	CreateRide(ctx context.Context, ride Ride) error
+	CreateRide(ctx context.Context, ride *Ride, requested func(*Ride) (models.OutboxMessage, error)) error
+	CancelRide(ctx context.Context, rideID, reason string, fromStatuses []string, event models.OutboxMessage) (StatusChange, error)
+	MatchRide(ctx context.Context, rideID, driverID string, event models.OutboxMessage) (StatusChange, error)
 	UpdateRideStatus(ctx context.Context, rideID string, status string, driverID string) error
 	GetRideByID(ctx context.Context, rideID string) (*Ride, error)
+	GetRideByNumber(ctx context.Context, rideNumber string) (*Ride, error)
 	UpdateStatus(ctx context.Context, id string, status, reason string) error
 	GetRideStatus(ctx context.Context, rideID string) (string, error)
 	CreateEvent(ctx context.Context, rideID, eventType string, payload interface{}) error
-	Exists(ctx context.Context, id string) (bool, error)
+	ListArrivedRides(ctx context.Context) ([]WaitingRide, error)
+	ListRequestedRides(ctx context.Context) ([]RequestedRide, error)
+}
+
+// IdempotencyStore keeps the Idempotency-Key reservations and the responses
+// stored for them.
+type IdempotencyStore interface {
+	ReserveIdempotencyKey(ctx context.Context, userID, key, fingerprint string) (*IdempotencyRecord, error)
+	SaveIdempotentResponse(ctx context.Context, userID, key string, status int, body []byte) error
+	ReleaseIdempotencyKey(ctx context.Context, userID, key string) error
 }
 
 type RideService interface {
 	CreateRide(ctx context.Context, passengerID string, input CreateRideRequest) (*Ride, error)
 	CancelRide(ctx context.Context, rideID, passengerID, reason string) (int, error)
+	GetRide(ctx context.Context, ref string) (*Ride, error)
+	GetPassengerRide(ctx context.Context, ref, passengerID string) (*Ride, error)
 	HandleDriverAcceptance(ctx context.Context, rideID, driverID string) error
 	HandleDriverRejection(ctx context.Context, rideID, driverID string) error
 }
-
-type Publisher interface {
-	Publish(ctx context.Context, exchange, routingKey string, body []byte) error
-	PublishRideStatus(event RideStatusEvent) error
-}
@@ -1,6 +1,9 @@
 package domain
 
-import "time"
+import (
+	"ride-hail/internal/shared/models"
+	"time"
+)
 
 type Ride struct {
 	ID                string    `json:"ride_id"`
@@ -21,6 +24,24 @@ type Ride struct {
 	CreatedAt         time.Time `json:"created_at"`
 }
 
+type WaitingRide struct {
+	RideID      string
+	PassengerID string
+	RideType    string
+	ArrivedAt   time.Time
+}
+
+type RequestedRide struct {
+	RideID      string
+	RequestedAt time.Time
+}
+
+// StatusChange describes a ride that has just moved to a new status.
+type StatusChange struct {
+	RideType    string
+	RequestedAt time.Time
+}
+
 type CreateRideRequest struct {
 	PickupLat      float64 `json:"pickup_latitude"`
 	PickupLng      float64 `json:"pickup_longitude"`
@@ -40,13 +61,6 @@ type CreateRideResponse struct {
 	EstimatedDistanceKm   float64 `json:"estimated_distance_km"`
 }
 
-type RideStatusEvent struct {
-	RideID    string    `json:"ride_id"`
-	Status    string    `json:"status"`
-	Reason    string    `json:"reason"`
-	Timestamp time.Time `json:"timestamp"`
-}
-
 type RegisterRequest struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
@@ -58,4 +72,69 @@ type RegisterRequest struct {
 type LoginRequest struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
+	// Device names the session, e.g. "Pixel 8"; the User-Agent is used without it.
+	Device string `json:"device"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+type ResendVerificationRequest struct {
+	Email string `json:"email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+type PhoneCodeRequest struct {
+	Phone string `json:"phone"`
+}
+
+type PhoneLoginRequest struct {
+	Phone string `json:"phone"`
+	Code  string `json:"code"`
+	// Device names the session, as in LoginRequest.
+	Device string `json:"device"`
+}
+
+// UpdateProfileRequest is a PATCH: absent fields stay as they are and empty
+// ones are removed.
+type UpdateProfileRequest struct {
+	Name             *string                  `json:"name"`
+	Phone            *string                  `json:"phone"`
+	Locale           *string                  `json:"locale"`
+	AvatarURL        *string                  `json:"avatar_url"`
+	EmergencyContact *models.EmergencyContact `json:"emergency_contact"`
+}
+
+type VerifyPhoneRequest struct {
+	Code string `json:"code"`
+}
+
+type ChangeEmailRequest struct {
+	Email           string `json:"email"`
+	CurrentPassword string `json:"current_password"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+type IdempotencyRecord struct {
+	Key         string
+	Fingerprint string
+	StatusCode  *int
+	Body        []byte
 }
@@ -0,0 +1,95 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"ride-hail/internal/ride/domain"
+	"ride-hail/internal/shared/util"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	// idempotencyLease is how long a reservation without a response holds its
+	// key. It outlasts any request, so only a crashed request loses its key.
+	idempotencyLease = time.Minute
+	// reserveAttempts bounds the retries when the key is released while we look.
+	reserveAttempts = 3
+)
+
+// ReserveIdempotencyKey claims the key for the user, taking it over when an
+// earlier reservation expired without a response. When the key is taken, the
+// stored record is returned instead.
+func (r *RideRepo) ReserveIdempotencyKey(ctx context.Context, userID, key, fingerprint string) (*domain.IdempotencyRecord, error) {
+	for attempt := 0; attempt < reserveAttempts; attempt++ {
+		cmd, err := r.db.Exec(ctx, `
+			INSERT INTO idempotency_keys (user_id, idempotency_key, request_fingerprint, locked_until)
+			VALUES ($1, $2, $3, NOW() + $4 * INTERVAL '1 second')
+			ON CONFLICT (user_id, idempotency_key) DO UPDATE
+			SET request_fingerprint = EXCLUDED.request_fingerprint,
+			    locked_until = EXCLUDED.locked_until,
+			    created_at = NOW()
+			WHERE idempotency_keys.response_status IS NULL
+			  AND idempotency_keys.locked_until < NOW()
+		`, userID, key, fingerprint, int(idempotencyLease.Seconds()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to reserve idempotency key: %w", err)
+		}
+		if cmd.RowsAffected() == 1 {
+			return nil, nil
+		}
+
+		rec := &domain.IdempotencyRecord{Key: key}
+		err = r.db.QueryRow(ctx, `
+			SELECT request_fingerprint, response_status, response_body
+			FROM idempotency_keys
+			WHERE user_id = $1 AND idempotency_key = $2
+		`, userID, key).Scan(&rec.Fingerprint, &rec.StatusCode, &rec.Body)
+		if errors.Is(err, pgx.ErrNoRows) {
+			// the previous attempt failed and released the key in between
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get idempotency key: %w", err)
+		}
+		return rec, nil
+	}
+	return nil, fmt.Errorf("failed to reserve idempotency key after %d attempts", reserveAttempts)
+}
+
+func (r *RideRepo) SaveIdempotentResponse(ctx context.Context, userID, key string, status int, body []byte) error {
+	_, err := r.db.Exec(ctx, `
+		UPDATE idempotency_keys
+		SET response_status = $1, response_body = $2
+		WHERE user_id = $3 AND idempotency_key = $4
+	`, status, body, userID, key)
+	return err
+}
+
+func (r *RideRepo) ReleaseIdempotencyKey(ctx context.Context, userID, key string) error {
+	_, err := r.db.Exec(ctx, `
+		DELETE FROM idempotency_keys WHERE user_id = $1 AND idempotency_key = $2
+	`, userID, key)
+	return err
+}
+
+// StartIdempotencyKeyCleaner deletes keys older than 24 hours every hour
+// until ctx is cancelled.
+func (r *RideRepo) StartIdempotencyKeyCleaner(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			_, err := r.db.Exec(ctx, `DELETE FROM idempotency_keys WHERE created_at < NOW() - INTERVAL '24 hours'`)
+			if err != nil && ctx.Err() == nil {
+				util.New().Error("IdempotencyKeyCleaner", fmt.Errorf("failed to clean expired idempotency keys: %w", err))
+			}
+		}
+	}
+}
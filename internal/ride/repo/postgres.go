@@ -3,11 +3,15 @@ package repo
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"ride-hail/internal/ride/domain"
+	"ride-hail/internal/shared/models"
+	"ride-hail/internal/shared/mq"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -19,13 +23,30 @@ func NewRideRepo(db *pgxpool.Pool) *RideRepo {
 	return &RideRepo{db: db}
 }
 
-func (r *RideRepo) CreateRide(ctx context.Context, ride domain.Ride) error {
+// CreateRide stores the ride and assigns its ride number. The per-day counter row
+// stays locked until commit, so concurrent inserts are serialized and a rolled
+// back insert does not leave a gap. The event built by requested is written to
+// the outbox in the same transaction.
+func (r *RideRepo) CreateRide(ctx context.Context, ride *domain.Ride, requested func(*domain.Ride) (models.OutboxMessage, error)) error {
 	tx, err := r.db.Begin(ctx)
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback(ctx)
 
+	var day time.Time
+	var seq int
+	err = tx.QueryRow(ctx, `
+		INSERT INTO ride_number_counters (day, last_value)
+		VALUES ((NOW() AT TIME ZONE 'UTC')::date, 1)
+		ON CONFLICT (day) DO UPDATE SET last_value = ride_number_counters.last_value + 1
+		RETURNING day, last_value
+	`).Scan(&day, &seq)
+	if err != nil {
+		return fmt.Errorf("next ride number failed: %w", err)
+	}
+	ride.Number = fmt.Sprintf("RIDE_%s_%06d", day.Format("20060102"), seq)
+
 	var pickupID, destID uuid.UUID
 
 	err = tx.QueryRow(ctx, `
@@ -62,9 +83,109 @@ func (r *RideRepo) CreateRide(ctx context.Context, ride domain.Ride) error {
 		return fmt.Errorf("insert ride failed: %w", err)
 	}
 
+	event, err := requested(ride)
+	if err != nil {
+		return err
+	}
+
+	if err := insertEvent(ctx, tx, ride.ID, "RIDE_REQUESTED", event.Payload); err != nil {
+		return err
+	}
+
+	if err := mq.InsertOutbox(ctx, tx, event); err != nil {
+		return err
+	}
+
 	return tx.Commit(ctx)
 }
 
+// CancelRide cancels the ride if it is still in one of fromStatuses and records
+// the RIDE_CANCELLED event and its outbox message atomically.
+func (r *RideRepo) CancelRide(ctx context.Context, rideID, reason string, fromStatuses []string, event models.OutboxMessage) (domain.StatusChange, error) {
+	var change domain.StatusChange
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return change, err
+	}
+	defer tx.Rollback(ctx)
+
+	err = tx.QueryRow(ctx, `
+		UPDATE rides
+		SET status = 'CANCELLED',
+		    cancellation_reason = $1,
+		    cancelled_at = NOW(),
+		    updated_at = NOW()
+		WHERE id = $2 AND status = ANY($3)
+		RETURNING COALESCE(vehicle_type, ''), COALESCE(requested_at, created_at)
+	`, reason, rideID, fromStatuses).Scan(&change.RideType, &change.RequestedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return change, domain.ErrInvalidStatus
+	}
+	if err != nil {
+		return change, err
+	}
+
+	if err := insertEvent(ctx, tx, rideID, "RIDE_CANCELLED", event.Payload); err != nil {
+		return change, err
+	}
+
+	if err := mq.InsertOutbox(ctx, tx, event); err != nil {
+		return change, err
+	}
+
+	return change, tx.Commit(ctx)
+}
+
+// MatchRide assigns the driver to a REQUESTED ride and records the
+// DRIVER_MATCHED event and its outbox message atomically.
+func (r *RideRepo) MatchRide(ctx context.Context, rideID, driverID string, event models.OutboxMessage) (domain.StatusChange, error) {
+	var change domain.StatusChange
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return change, err
+	}
+	defer tx.Rollback(ctx)
+
+	err = tx.QueryRow(ctx, `
+		UPDATE rides
+		SET status = 'MATCHED',
+		    driver_id = $1,
+		    matched_at = NOW(),
+		    updated_at = NOW()
+		WHERE id = $2 AND status = 'REQUESTED'
+		RETURNING COALESCE(vehicle_type, ''), COALESCE(requested_at, created_at)
+	`, driverID, rideID).Scan(&change.RideType, &change.RequestedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return change, domain.ErrInvalidStatus
+	}
+	if err != nil {
+		return change, err
+	}
+
+	if err := insertEvent(ctx, tx, rideID, "DRIVER_MATCHED", event.Payload); err != nil {
+		return change, err
+	}
+
+	if err := mq.InsertOutbox(ctx, tx, event); err != nil {
+		return change, err
+	}
+
+	return change, tx.Commit(ctx)
+}
+
+func insertEvent(ctx context.Context, tx pgx.Tx, rideID, eventType string, data []byte) error {
+	_, err := tx.Exec(ctx, `
+		INSERT INTO ride_events (ride_id, event_type, event_data)
+		VALUES ($1, $2, $3::jsonb)
+	`, rideID, eventType, string(data))
+	if err != nil {
+		return fmt.Errorf("failed to insert ride_event: %w", err)
+	}
+	return nil
+}
+
 func (r *RideRepo) UpdateRideStatus(ctx context.Context, rideID, status, driverID string) error {
 	query := `
 		UPDATE rides
@@ -79,34 +200,36 @@ func (r *RideRepo) UpdateRideStatus(ctx context.Context, rideID, status, driverI
 }
 
 func (r *RideRepo) GetRideByID(ctx context.Context, rideID string) (*domain.Ride, error) {
+	return r.getRide(ctx, "r.id = $1", rideID)
+}
+
+func (r *RideRepo) GetRideByNumber(ctx context.Context, rideNumber string) (*domain.Ride, error) {
+	return r.getRide(ctx, "r.ride_number = $1", rideNumber)
+}
+
+func (r *RideRepo) getRide(ctx context.Context, where string, arg string) (*domain.Ride, error) {
 	row := r.db.QueryRow(ctx, `
-		SELECT id, passenger_id, ride_number, status, vehicle_type, estimated_fare, created_at
-		FROM rides
-		WHERE id = $1
-	`, rideID)
+		SELECT r.id, r.passenger_id, r.driver_id, r.ride_number, r.status, COALESCE(r.vehicle_type, ''),
+		       COALESCE(r.estimated_fare, 0), r.created_at,
+		       COALESCE(p.address, ''), COALESCE(p.latitude, 0), COALESCE(p.longitude, 0),
+		       COALESCE(d.address, ''), COALESCE(d.latitude, 0), COALESCE(d.longitude, 0)
+		FROM rides r
+		LEFT JOIN coordinates p ON p.id = r.pickup_coordinate_id
+		LEFT JOIN coordinates d ON d.id = r.destination_coordinate_id
+		WHERE `+where, arg)
 
 	var ride domain.Ride
-	err := row.Scan(&ride.ID, &ride.PassengerID, &ride.Number, &ride.Status, &ride.RideType, &ride.EstimatedFare, &ride.CreatedAt)
+	err := row.Scan(&ride.ID, &ride.PassengerID, &ride.DriverID, &ride.Number, &ride.Status, &ride.RideType,
+		&ride.EstimatedFare, &ride.CreatedAt,
+		&ride.PickupAddress, &ride.PickupLat, &ride.PickupLng,
+		&ride.DropoffAddress, &ride.DropoffLat, &ride.DropoffLng)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, domain.ErrNotFound
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	row = r.db.QueryRow(ctx, `
-		SELECT address, latitude, longitude
-		FROM coordinates
-		WHERE entity_id = $1 AND entity_type = 'pickup'
-		LIMIT 1
-	`, rideID)
-	row.Scan(&ride.PickupAddress, &ride.PickupLat, &ride.PickupLng)
-
-	row = r.db.QueryRow(ctx, `
-		SELECT address, latitude, longitude
-		FROM coordinates
-		WHERE entity_id = $1 AND entity_type = 'destination'
-		LIMIT 1
-	`, rideID)
-	row.Scan(&ride.DropoffAddress, &ride.DropoffLat, &ride.DropoffLng)
-
 	return &ride, nil
 }
 
@@ -158,13 +281,47 @@ func (r *RideRepo) CreateEvent(ctx context.Context, rideID, eventType string, pa
 	return nil
 }
 
-func (r *RideRepo) Exists(ctx context.Context, id string) (bool, error) {
-	var exists bool
-	err := r.db.QueryRow(ctx, `
-        SELECT EXISTS(SELECT 1 FROM users WHERE id = $1)
-    `, id).Scan(&exists)
+func (r *RideRepo) ListArrivedRides(ctx context.Context) ([]domain.WaitingRide, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT id, passenger_id, COALESCE(vehicle_type, ''), arrived_at
+		FROM rides
+		WHERE status = 'ARRIVED' AND arrived_at IS NOT NULL
+	`)
 	if err != nil {
-		return false, err
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rides []domain.WaitingRide
+	for rows.Next() {
+		var ride domain.WaitingRide
+		if err := rows.Scan(&ride.RideID, &ride.PassengerID, &ride.RideType, &ride.ArrivedAt); err != nil {
+			return nil, err
+		}
+		rides = append(rides, ride)
+	}
+	return rides, rows.Err()
+}
+
+// ListRequestedRides returns the rides still waiting for a driver.
+func (r *RideRepo) ListRequestedRides(ctx context.Context) ([]domain.RequestedRide, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT id, COALESCE(requested_at, created_at)
+		FROM rides
+		WHERE status = 'REQUESTED'
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rides []domain.RequestedRide
+	for rows.Next() {
+		var ride domain.RequestedRide
+		if err := rows.Scan(&ride.RideID, &ride.RequestedAt); err != nil {
+			return nil, err
+		}
+		rides = append(rides, ride)
 	}
-	return exists, nil
+	return rides, rows.Err()
 }
@@ -4,11 +4,24 @@ import (
 	"errors"
 )
 
-var ErrDriverOnline = errors.New("Driver is alredy online")
+var (
+	ErrDriverOnline      = errors.New("Driver is alredy online")
+	ErrRideNotFound      = errors.New("ride not found")
+	ErrRideNotAssigned   = errors.New("ride is not assigned to this driver")
+	ErrInvalidRideStatus = errors.New("ride is not in a valid status for this action")
+	ErrNoShowTooEarly    = errors.New("no-show can not be reported yet")
+)
 
 func CheckError(err error) int {
-	if errors.Is(err, ErrDriverOnline) {
+	switch {
+	case errors.Is(err, ErrDriverOnline):
 		return 401
+	case errors.Is(err, ErrRideNotFound):
+		return 404
+	case errors.Is(err, ErrRideNotAssigned):
+		return 403
+	case errors.Is(err, ErrInvalidRideStatus), errors.Is(err, ErrNoShowTooEarly):
+		return 409
 	}
 
 	return 500
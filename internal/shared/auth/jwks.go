@@ -0,0 +1,201 @@
+package auth
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"ride-hail/internal/shared/util"
+	"sync"
+	"time"
+)
+
+// JWKSPath is where auth-service publishes its public keys.
+const JWKSPath = "/.well-known/jwks.json"
+
+const (
+	jwksFetchTimeout = 5 * time.Second
+	// jwksMinInterval limits refetches caused by tokens with unknown kids.
+	jwksMinInterval = 30 * time.Second
+)
+
+// JWK is a public key in RFC 7517 form.
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Ed25519
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+var b64 = base64.RawURLEncoding
+
+func (k Key) JWK() JWK {
+	jwk := JWK{KeyID: k.ID, Algorithm: k.Algorithm, Use: "sig"}
+	switch pub := k.Public.(type) {
+	case *rsa.PublicKey:
+		jwk.KeyType = "RSA"
+		jwk.N = b64.EncodeToString(pub.N.Bytes())
+		jwk.E = b64.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.KeyType = "OKP"
+		jwk.Curve = "Ed25519"
+		jwk.X = b64.EncodeToString(pub)
+	}
+	return jwk
+}
+
+func (j JWK) key() (Key, error) {
+	k := Key{ID: j.KeyID, Algorithm: j.Algorithm}
+	switch {
+	case j.KeyType == "RSA" && j.Algorithm == AlgRS256:
+		n, err := b64.DecodeString(j.N)
+		if err != nil {
+			return Key{}, err
+		}
+		e, err := b64.DecodeString(j.E)
+		if err != nil {
+			return Key{}, err
+		}
+		k.Public = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	case j.KeyType == "OKP" && j.Curve == "Ed25519" && j.Algorithm == AlgEdDSA:
+		x, err := b64.DecodeString(j.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return Key{}, errors.New("invalid Ed25519 key")
+		}
+		k.Public = ed25519.PublicKey(x)
+	default:
+		return Key{}, fmt.Errorf("unsupported key type %s/%s", j.KeyType, j.Algorithm)
+	}
+	return k, nil
+}
+
+// JWKSHandler publishes the public half of every key the issuer knows,
+// including retired ones whose tokens may still be in use.
+func (i *Issuer) JWKSHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		set := JWKS{Keys: make([]JWK, 0, len(i.keys))}
+		for _, k := range i.keys {
+			set.Keys = append(set.Keys, k.JWK())
+		}
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		util.ResponseInJson(w, http.StatusOK, set)
+	})
+}
+
+// jwksClient caches the keys published at url.
+type jwksClient struct {
+	url     string
+	refresh time.Duration
+	client  *http.Client
+	logger  *util.Logger
+
+	mu        sync.Mutex
+	keys      map[string]Key
+	fetchedAt time.Time
+	// fetching is closed when the fetch in progress ends; concurrent lookups
+	// wait for it instead of starting their own
+	fetching chan struct{}
+}
+
+func newJWKSClient(url string, refresh time.Duration, logger *util.Logger) *jwksClient {
+	return &jwksClient{
+		url:     url,
+		refresh: refresh,
+		client:  &http.Client{Timeout: jwksFetchTimeout},
+		logger:  logger,
+		keys:    map[string]Key{},
+	}
+}
+
+// key returns the key kid. The set is fetched again when it is older than the
+// refresh interval, or when kid is unknown, which is how new keys are found.
+// The fetch runs without holding mu, so lookups of cached keys never wait on
+// auth-service.
+func (c *jwksClient) key(ctx context.Context, kid string) (Key, bool) {
+	c.mu.Lock()
+	k, ok := c.keys[kid]
+	age := time.Since(c.fetchedAt)
+	if (ok && age < c.refresh) || (!ok && age < jwksMinInterval) {
+		c.mu.Unlock()
+		return k, ok
+	}
+
+	done := c.fetching
+	if done == nil {
+		done = make(chan struct{})
+		c.fetching = done
+		// failures count too, so an unreachable auth-service is not hammered
+		c.fetchedAt = time.Now()
+		c.mu.Unlock()
+
+		keys, err := c.fetch(ctx)
+		if err != nil {
+			c.logger.Warn("JWKS", fmt.Sprintf("failed to fetch %s: %v", c.url, err))
+		}
+
+		c.mu.Lock()
+		if err == nil {
+			c.keys = keys
+		}
+		c.fetching = nil
+		close(done)
+	} else {
+		c.mu.Unlock()
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return k, ok
+		}
+		c.mu.Lock()
+	}
+
+	k, ok = c.keys[kid]
+	c.mu.Unlock()
+	return k, ok
+}
+
+func (c *jwksClient) fetch(ctx context.Context) (map[string]Key, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	var set JWKS
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]Key, len(set.Keys))
+	for _, j := range set.Keys {
+		k, err := j.key()
+		if err != nil {
+			c.logger.Warn("JWKS", fmt.Sprintf("skipping key %s: %v", j.KeyID, err))
+			continue
+		}
+		keys[k.ID] = k
+	}
+	return keys, nil
+}
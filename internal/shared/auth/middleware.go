@@ -0,0 +1,50 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"ride-hail/internal/shared/util"
+	"strings"
+)
+
+var ErrMissingToken = errors.New("missing or invalid Authorization header")
+
+type claimsKey struct{}
+
+// WithClaims stores the claims of an authenticated request.
+func WithClaims(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, claimsKey{}, claims)
+}
+
+// ClaimsFromContext returns the claims stored by WithClaims.
+func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(*Claims)
+	return claims, ok
+}
+
+// Subject returns the user id of the authenticated request, or "" without one.
+func Subject(r *http.Request) string {
+	if claims, ok := ClaimsFromContext(r.Context()); ok {
+		return claims.UserID
+	}
+	return ""
+}
+
+// BearerClaims parses the bearer token of r.
+func BearerClaims(r *http.Request) (*Claims, error) {
+	tokenStr, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || tokenStr == "" {
+		return nil, ErrMissingToken
+	}
+	return ParseToken(tokenStr)
+}
+
+// WriteAuthError answers 401 for a request whose token could not be used.
+func WriteAuthError(w http.ResponseWriter, err error) {
+	if errors.Is(err, ErrMissingToken) || errors.Is(err, ErrRevoked) {
+		util.WriteJSONError(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	util.WriteJSONError(w, "invalid or expired token", http.StatusUnauthorized)
+}
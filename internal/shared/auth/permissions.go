@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"net/http"
+	"ride-hail/internal/shared/util"
+	"slices"
+	"sort"
+)
+
+// Permission is an action a token may be used for. Handlers require
+// permissions, never roles, so what a role may do is decided here alone.
+type Permission string
+
+const (
+	PermRideCreate  Permission = "rides:create"
+	PermRideCancel  Permission = "rides:cancel"
+	PermRideReadOwn Permission = "rides:read_own"
+	PermRideReadAll Permission = "rides:read_all"
+
+	PermDriverOperate Permission = "driver:operate"
+
+	PermProfileManage Permission = "profile:manage"
+
+	PermUserStatus     Permission = "users:status"
+	PermUserRoles      Permission = "users:roles"
+	PermUserPrivacy    Permission = "users:privacy"
+	PermLockoutsManage Permission = "lockouts:manage"
+	PermSettingsManage Permission = "settings:manage"
+)
+
+const (
+	RolePassenger = "PASSENGER"
+	RoleDriver    = "DRIVER"
+	RoleAdmin     = "ADMIN"
+)
+
+// rolePermissions must list every role of the roles table.
+var rolePermissions = map[string][]Permission{
+	RolePassenger: {PermProfileManage, PermRideCreate, PermRideCancel, PermRideReadOwn},
+	RoleDriver:    {PermProfileManage, PermDriverOperate},
+	RoleAdmin: {
+		PermProfileManage, PermRideReadAll,
+		PermUserStatus, PermUserRoles, PermUserPrivacy, PermLockoutsManage, PermSettingsManage,
+	},
+}
+
+// Roles returns every known role, sorted.
+func Roles() []string {
+	roles := make([]string, 0, len(rolePermissions))
+	for role := range rolePermissions {
+		roles = append(roles, role)
+	}
+	sort.Strings(roles)
+	return roles
+}
+
+// ValidRole reports whether role is known.
+func ValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// HasPermission reports whether role grants p.
+func HasPermission(role string, p Permission) bool {
+	return slices.Contains(rolePermissions[role], p)
+}
+
+// Can reports whether the claims grant p.
+func (c *Claims) Can(p Permission) bool {
+	return HasPermission(c.Role, p)
+}
+
+// RequirePermission lets the request through only when its token grants p.
+// Claims already stored by an earlier middleware are used as they are;
+// otherwise the bearer token is parsed and its claims stored.
+func RequirePermission(p Permission, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := ClaimsFromContext(r.Context())
+		if !ok {
+			var err error
+			if claims, err = BearerClaims(r); err != nil {
+				WriteAuthError(w, err)
+				return
+			}
+			r = r.WithContext(WithClaims(r.Context(), claims))
+		}
+
+		if !claims.Can(p) {
+			util.New().WithContext(r.Context()).Warn("RequirePermission",
+				"role "+claims.Role+" of "+claims.UserID+" lacks "+string(p))
+			util.WriteJSONError(w, "forbidden: "+string(p)+" permission required", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,194 @@
+// Package auth issues and verifies the access tokens shared by all services.
+// Tokens are signed with RS256 or EdDSA and name their key in the kid header,
+// so keys can be rotated: auth-service signs with the current key and
+// publishes every key it still accepts at JWKSPath.
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"ride-hail/internal/shared/models"
+	"ride-hail/internal/shared/util"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrUnknownKey = errors.New("token signed with an unknown key")
+	ErrRevoked    = errors.New("token has been revoked")
+)
+
+// iat and exp carry milliseconds instead of whole seconds, so a token issued
+// just after a user's tokens were revoked is told apart from the ones the
+// revocation covers.
+func init() {
+	jwt.TimePrecision = time.Millisecond
+}
+
+// DenyList reports whether a token with a valid signature was revoked since
+// it was issued.
+type DenyList interface {
+	Revoked(claims *Claims) bool
+}
+
+type Claims struct {
+	UserID string `json:"sub"`
+	Email  string `json:"email"`
+	Role   string `json:"role"`
+	jwt.RegisteredClaims
+}
+
+// Issuer signs tokens. Only auth-service has one.
+type Issuer struct {
+	cfg     models.JWTConfig
+	keys    map[string]Key
+	signing Key
+}
+
+// NewIssuer loads the private key of every configured key.
+func NewIssuer(cfg models.JWTConfig) (*Issuer, error) {
+	i := &Issuer{cfg: cfg, keys: make(map[string]Key, len(cfg.Keys))}
+	for _, kc := range cfg.Keys {
+		if kc.PrivateKeyFile == "" {
+			return nil, fmt.Errorf("jwt key %s: private_key_file is required to issue tokens", kc.ID)
+		}
+		private, err := loadPrivateKey(kc.PrivateKeyFile, kc.Algorithm)
+		if err != nil {
+			return nil, fmt.Errorf("jwt key %s: %w", kc.ID, err)
+		}
+		i.keys[kc.ID] = Key{ID: kc.ID, Algorithm: kc.Algorithm, Private: private, Public: private.Public()}
+	}
+
+	signing, ok := i.keys[cfg.SigningKeyID]
+	if !ok {
+		return nil, fmt.Errorf("jwt signing key %q is not configured", cfg.SigningKeyID)
+	}
+	i.signing = signing
+	return i, nil
+}
+
+// Issue returns a signed access token and its claims.
+func (i *Issuer) Issue(userID, email, role string) (string, *Claims, error) {
+	now := time.Now()
+	claims := &Claims{
+		UserID: userID,
+		Email:  email,
+		Role:   role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        util.GenerateUUID(),
+			Issuer:    i.cfg.Issuer,
+			Audience:  jwt.ClaimStrings{i.cfg.Audience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(i.cfg.AccessTokenTTL)),
+		},
+	}
+
+	token := jwt.NewWithClaims(i.signing.method(), claims)
+	token.Header["kid"] = i.signing.ID
+	signed, err := token.SignedString(i.signing.Private)
+	if err != nil {
+		return "", nil, err
+	}
+	return signed, claims, nil
+}
+
+// Verifier returns a verifier that knows the issuer's keys.
+func (i *Issuer) Verifier() *Verifier {
+	return &Verifier{cfg: i.cfg, keys: i.keys}
+}
+
+// Verifier checks signature, kid, issuer, audience and expiry.
+type Verifier struct {
+	cfg  models.JWTConfig
+	keys map[string]Key
+	jwks *jwksClient
+	deny DenyList
+}
+
+// NewVerifier uses the public key files from the config and, when jwks_url
+// is set, the keys published by auth-service.
+func NewVerifier(cfg models.JWTConfig, logger *util.Logger) (*Verifier, error) {
+	v := &Verifier{cfg: cfg, keys: map[string]Key{}}
+	for _, kc := range cfg.Keys {
+		if kc.PublicKeyFile == "" {
+			continue
+		}
+		public, err := loadPublicKey(kc.PublicKeyFile, kc.Algorithm)
+		if err != nil {
+			return nil, fmt.Errorf("jwt key %s: %w", kc.ID, err)
+		}
+		v.keys[kc.ID] = Key{ID: kc.ID, Algorithm: kc.Algorithm, Public: public}
+	}
+
+	if cfg.JWKSURL != "" {
+		v.jwks = newJWKSClient(cfg.JWKSURL, cfg.JWKSRefresh, logger)
+	}
+	if len(v.keys) == 0 && v.jwks == nil {
+		return nil, errors.New("jwt: no public_key_file and no jwks_url to verify tokens with")
+	}
+	return v, nil
+}
+
+// UseDenyList makes Parse reject the tokens d reports as revoked.
+func (v *Verifier) UseDenyList(d DenyList) {
+	v.deny = d
+}
+
+func (v *Verifier) Parse(tokenStr string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenStr, claims, v.keyFunc,
+		jwt.WithValidMethods(Algorithms),
+		jwt.WithIssuer(v.cfg.Issuer),
+		jwt.WithAudience(v.cfg.Audience),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, jwt.ErrTokenInvalidClaims
+	}
+	if v.deny != nil && v.deny.Revoked(claims) {
+		return nil, ErrRevoked
+	}
+	return claims, nil
+}
+
+func (v *Verifier) keyFunc(t *jwt.Token) (any, error) {
+	kid, _ := t.Header["kid"].(string)
+	if kid == "" {
+		return nil, errors.New("token has no kid")
+	}
+
+	key, ok := v.keys[kid]
+	if !ok && v.jwks != nil {
+		key, ok = v.jwks.key(context.Background(), kid)
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, kid)
+	}
+	if t.Method.Alg() != key.Algorithm {
+		return nil, fmt.Errorf("key %s is for %s, token uses %s", kid, key.Algorithm, t.Method.Alg())
+	}
+	return key.Public, nil
+}
+
+var defaultVerifier *Verifier
+
+// SetDefault sets the verifier used by ParseToken and the middleware. Services
+// call it once at startup.
+func SetDefault(v *Verifier) {
+	defaultVerifier = v
+}
+
+// ParseToken verifies a token with the default verifier.
+func ParseToken(tokenStr string) (*Claims, error) {
+	if defaultVerifier == nil {
+		return nil, errors.New("auth: no verifier configured")
+	}
+	return defaultVerifier.Parse(tokenStr)
+}
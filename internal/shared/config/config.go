@@ -1,107 +1,134 @@
+// Package config loads config.yaml. Values are resolved in this order, later
+// sources winning:
+//
+//  1. the defaults in Default
+//  2. the file, where ${VAR} and ${VAR:-default} are replaced from the environment
+//  3. RIDEHAIL_<PATH> environment variables, e.g. RIDEHAIL_SERVICES_RIDE_SERVICE_PORT
+//  4. -set path=value flags, e.g. -set services.ride_service.match_timeout=90s
+//
+// The result is validated before it is returned.
 package config
 
 import (
-	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
 	"os"
+	"regexp"
 	"ride-hail/internal/shared/models"
 	"strings"
+
+	"gopkg.in/yaml.v3"
 )
 
-func LoadConfig(filename string) (*models.Config, error) {
-	file, err := os.Open(filename)
-	if err != nil {
+const DefaultPath = "config.yaml"
+
+// Load reads the configuration for a service from its command-line arguments:
+// -config selects the file and every -set path=value overrides one value.
+func Load(args []string) (*models.Config, error) {
+	fs := flag.NewFlagSet("config", flag.ContinueOnError)
+	loadConfig := Flags(fs)
+	if err := fs.Parse(args); err != nil {
 		return nil, err
 	}
-	defer file.Close()
 
-	cfg := &models.Config{}
-	var section string
+	return loadConfig()
+}
 
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
-		}
+// Flags adds -config and -set to fs, for commands with flags of their own.
+// The returned function loads the configuration once fs has been parsed.
+func Flags(fs *flag.FlagSet) func() (*models.Config, error) {
+	path := fs.String("config", DefaultPath, "path to config file")
+	sets := &setFlags{}
+	fs.Var(sets, "set", "override a config value, e.g. -set services.ride_service.port=3005 (repeatable)")
 
-		if !strings.Contains(line, ":") {
-			continue
-		}
+	return func() (*models.Config, error) {
+		return load(*path, *sets)
+	}
+}
 
-		if strings.HasSuffix(line, ":") {
-			section = strings.TrimSuffix(line, ":")
-			continue
-		}
+func load(filename string, sets []string) (*models.Config, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := Default()
+	if err := decode(data, cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+
+	if err := applyEnv(cfg); err != nil {
+		return nil, err
+	}
 
-		parts := strings.SplitN(line, ":", 2)
-		if len(parts) != 2 {
-			continue
+	for _, set := range sets {
+		path, value, ok := strings.Cut(set, "=")
+		if !ok {
+			return nil, fmt.Errorf("-set %q: expected path=value", set)
+		}
+		if err := setPath(cfg, path, value); err != nil {
+			return nil, fmt.Errorf("-set %s: %w", path, err)
 		}
+	}
 
-		key := strings.TrimSpace(parts[0])
-		val := strings.TrimSpace(parts[1])
+	if err := Validate(cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
 
-		if strings.HasPrefix(val, "${") {
-			inside := strings.TrimSuffix(strings.TrimPrefix(val, "${"), "}")
-			parts := strings.SplitN(inside, ":-", 2)
+// decode expands ${VAR} references in every scalar and decodes the document
+// into cfg, rejecting keys that cfg does not have.
+func decode(data []byte, cfg *models.Config) error {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	if doc.Kind == 0 {
+		return nil
+	}
+	expand(&doc)
 
-			envVar := parts[0]
-			defVal := ""
-			if len(parts) == 2 {
-				defVal = parts[1]
-			}
+	expanded, err := yaml.Marshal(&doc)
+	if err != nil {
+		return err
+	}
 
-			if v, ok := os.LookupEnv(envVar); ok {
-				val = v
-			} else {
-				val = defVal
-			}
+	dec := yaml.NewDecoder(bytes.NewReader(expanded))
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil {
+		var typeErr *yaml.TypeError
+		if errors.As(err, &typeErr) {
+			return errors.New(strings.Join(typeErr.Errors, "; "))
 		}
+		return err
+	}
+	return nil
+}
 
-		switch section {
-		case "database":
-			switch key {
-			case "host":
-				cfg.Database.Host = val
-			case "port":
-				cfg.Database.Port = val
-			case "user":
-				cfg.Database.User = val
-			case "password":
-				cfg.Database.Password = val
-			case "database":
-				cfg.Database.Database = val
-			}
-		case "rabbitmq":
-			switch key {
-			case "host":
-				cfg.RabbitMQ.Host = val
-			case "port":
-				cfg.RabbitMQ.Port = val
-			case "user":
-				cfg.RabbitMQ.User = val
-			case "password":
-				cfg.RabbitMQ.Password = val
-			}
-		case "websocket":
-			if key == "port" {
-				cfg.WebSocket.Port = val
-			}
-		case "services":
-			switch key {
-			case "ride_service":
-				cfg.Services.RideService = val
-			case "driver_location_service":
-				cfg.Services.DriverLocationService = val
-			case "admin_service":
-				cfg.Services.AdminService = val
+var envRef = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(?::-([^}]*))?\}`)
+
+func expand(node *yaml.Node) {
+	if node.Kind == yaml.ScalarNode && envRef.MatchString(node.Value) {
+		node.Value = envRef.ReplaceAllStringFunc(node.Value, func(ref string) string {
+			m := envRef.FindStringSubmatch(ref)
+			if v, ok := os.LookupEnv(m[1]); ok {
+				return v
 			}
-		}
+			return m[2]
+		})
+		// let the value be resolved again, so "${DB_PORT:-5432}" becomes an int
+		node.Tag = ""
+		node.Style = 0
 	}
-
-	if err := scanner.Err(); err != nil {
-		return nil, err
+	for _, child := range node.Content {
+		expand(child)
 	}
-
-	return cfg, nil
 }
+
+type setFlags []string
+
+func (s *setFlags) String() string     { return strings.Join(*s, ",") }
+func (s *setFlags) Set(v string) error { *s = append(*s, v); return nil }
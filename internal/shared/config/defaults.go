@@ -0,0 +1,99 @@
+package config
+
+import (
+	"ride-hail/internal/shared/models"
+	"time"
+)
+
+// Default returns the values used for keys that config.yaml leaves out.
+func Default() *models.Config {
+	httpDefaults := func(port int) models.HTTPConfig {
+		return models.HTTPConfig{
+			Port:         port,
+			ReadTimeout:  10 * time.Second,
+			WriteTimeout: 15 * time.Second,
+			IdleTimeout:  60 * time.Second,
+		}
+	}
+
+	return &models.Config{
+		Database: models.DatabaseConfig{
+			Host:           "localhost",
+			Port:           5432,
+			User:           "ridehail_user",
+			Database:       "ridehail_db",
+			MaxConns:       10,
+			MigrateOnStart: true,
+		},
+		RabbitMQ: models.RabbitMQConfig{
+			Host: "localhost",
+			Port: 5672,
+			User: "ridehail",
+		},
+		Mail: models.MailConfig{
+			Driver: "console",
+			From:   "Ride Hail <no-reply@ridehail.local>",
+			Dir:    "tmp/mail",
+			SMTP: models.SMTPConfig{
+				Port:     587,
+				StartTLS: true,
+				Timeout:  10 * time.Second,
+			},
+		},
+		SMS:       models.SMSConfig{Driver: "fake"},
+		WebSocket: models.WebSocketConfig{Port: 8080},
+		WaitTariffs: []models.WaitTariff{
+			{RideType: "ECONOMY", FreePeriod: 3 * time.Minute, PerMinute: 50, NoShowAfter: 5 * time.Minute, NoShowFee: 500},
+			{RideType: "PREMIUM", FreePeriod: 5 * time.Minute, PerMinute: 60, NoShowAfter: 7 * time.Minute, NoShowFee: 800},
+			{RideType: "XL", FreePeriod: 5 * time.Minute, PerMinute: 75, NoShowAfter: 7 * time.Minute, NoShowFee: 1000},
+		},
+		Services: models.ServicesConfig{
+			RideService: models.RideServiceConfig{
+				HTTPConfig:   httpDefaults(3000),
+				MatchTimeout: 2 * time.Minute,
+				Tariffs: []models.Tariff{
+					{RideType: "ECONOMY", BaseFare: 500, PerKm: 100, PerMinute: 50},
+					{RideType: "PREMIUM", BaseFare: 800, PerKm: 120, PerMinute: 60},
+					{RideType: "XL", BaseFare: 1000, PerKm: 150, PerMinute: 75},
+				},
+			},
+			DriverLocationService: models.DriverServiceConfig{
+				HTTPConfig: httpDefaults(3001),
+			},
+			AuthService: models.AuthServiceConfig{
+				HTTPConfig: httpDefaults(4000),
+				LoginLimits: models.LoginLimitsConfig{
+					AccountMaxFailures: 5,
+					IPMaxFailures:      20,
+					BackoffBase:        time.Second,
+					LockoutDuration:    15 * time.Minute,
+					MaxLockout:         24 * time.Hour,
+					FailureWindow:      time.Hour,
+				},
+				PublicURL:      "http://localhost:3000",
+				VerifyTokenTTL: 48 * time.Hour,
+				ResetTokenTTL:  time.Hour,
+				OTP: models.OTPConfig{
+					CodeLength:      6,
+					TTL:             5 * time.Minute,
+					MaxAttempts:     5,
+					ResendInterval:  time.Minute,
+					MaxPerHour:      5,
+					MaxPerIPPerHour: 20,
+				},
+			},
+			AdminService: httpDefaults(3004),
+		},
+		JWT: models.JWTConfig{
+			Issuer:          "auth-service",
+			Audience:        "ride-hail",
+			AccessTokenTTL:  5 * time.Minute,
+			RefreshTokenTTL: 30 * 24 * time.Hour,
+			JWKSRefresh:     5 * time.Minute,
+		},
+		Shutdown: models.ShutdownConfig{
+			Timeout:    30 * time.Second,
+			DrainDelay: 5 * time.Second,
+		},
+	}
+}
@@ -0,0 +1,145 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"ride-hail/internal/shared/models"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const envPrefix = "RIDEHAIL_"
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// EnvName is the environment variable that overrides the value at path.
+func EnvName(path string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(path, ".", "_"))
+}
+
+// applyEnv overrides every value whose RIDEHAIL_<PATH> variable is set. Lists
+// are given in YAML flow syntax, e.g. [a, b].
+func applyEnv(cfg *models.Config) error {
+	var errs []string
+	walk(reflect.ValueOf(cfg).Elem(), "", func(path string, v reflect.Value) {
+		raw, ok := os.LookupEnv(EnvName(path))
+		if !ok {
+			return
+		}
+		if err := setValue(v, raw); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", EnvName(path), err))
+		}
+	})
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid environment overrides:\n  %s", strings.Join(errs, "\n  "))
+	}
+	return nil
+}
+
+// walk calls fn for every leaf value of a struct, with its dotted yaml path.
+func walk(v reflect.Value, prefix string, fn func(path string, v reflect.Value)) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, inline := yamlName(field)
+		if name == "-" {
+			continue
+		}
+
+		path := prefix
+		if !inline {
+			path = joinPath(prefix, name)
+		}
+
+		fv := v.Field(i)
+		if fv.Kind() == reflect.Struct && fv.Type() != durationType {
+			walk(fv, path, fn)
+			continue
+		}
+		fn(path, fv)
+	}
+}
+
+// setPath sets the value at a dotted path. List elements are addressed by
+// index, e.g. services.ride_service.tariffs.0.base_fare.
+func setPath(cfg *models.Config, path, raw string) error {
+	v := reflect.ValueOf(cfg).Elem()
+	for _, part := range strings.Split(path, ".") {
+		switch v.Kind() {
+		case reflect.Struct:
+			next, ok := fieldByYAMLName(v, part)
+			if !ok {
+				return fmt.Errorf("unknown key %q", part)
+			}
+			v = next
+		case reflect.Slice:
+			idx, err := strconv.Atoi(part)
+			if err != nil || idx < 0 || idx >= v.Len() {
+				return fmt.Errorf("no list element %q", part)
+			}
+			v = v.Index(idx)
+		default:
+			return fmt.Errorf("%q is not a section", part)
+		}
+	}
+	if v.Kind() == reflect.Struct && v.Type() != durationType {
+		return fmt.Errorf("%s is a section, not a value", path)
+	}
+	return setValue(v, raw)
+}
+
+func fieldByYAMLName(v reflect.Value, name string) (reflect.Value, bool) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		fieldName, inline := yamlName(t.Field(i))
+		if inline {
+			if fv, ok := fieldByYAMLName(v.Field(i), name); ok {
+				return fv, true
+			}
+			continue
+		}
+		if fieldName == name {
+			return v.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// setValue parses raw the same way the file is parsed. Strings are taken as
+// they are, so passwords like "123" or "#x" survive.
+func setValue(v reflect.Value, raw string) error {
+	if v.Kind() == reflect.String {
+		v.SetString(raw)
+		return nil
+	}
+
+	target := reflect.New(v.Type())
+	if err := yaml.Unmarshal([]byte(raw), target.Interface()); err != nil {
+		return fmt.Errorf("cannot use %q as %s", raw, v.Type())
+	}
+	v.Set(target.Elem())
+	return nil
+}
+
+func yamlName(field reflect.StructField) (name string, inline bool) {
+	tag := field.Tag.Get("yaml")
+	name, opts, _ := strings.Cut(tag, ",")
+	if strings.Contains(opts, "inline") {
+		return "", true
+	}
+	if name == "" {
+		name = strings.ToLower(field.Name)
+	}
+	return name, false
+}
+
+func joinPath(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "." + name
+}
@@ -0,0 +1,276 @@
+package config
+
+import (
+	"fmt"
+	"net/mail"
+	"net/url"
+	"ride-hail/internal/shared/auth"
+	"ride-hail/internal/shared/models"
+	"ride-hail/internal/shared/settings"
+	"slices"
+	"strings"
+	"time"
+)
+
+// RideTypes are the values of the vehicle_type table.
+var RideTypes = []string{"ECONOMY", "PREMIUM", "XL"}
+
+type validator struct {
+	errs []string
+}
+
+func (v *validator) fail(path, format string, args ...any) {
+	v.errs = append(v.errs, path+": "+fmt.Sprintf(format, args...))
+}
+
+func (v *validator) required(path, value string) {
+	if strings.TrimSpace(value) == "" {
+		v.fail(path, "is required")
+	}
+}
+
+func (v *validator) port(path string, port int) {
+	if port < 1 || port > 65535 {
+		v.fail(path, "must be between 1 and 65535, got %d", port)
+	}
+}
+
+func (v *validator) duration(path string, d, min, max time.Duration) {
+	if d < min || d > max {
+		v.fail(path, "must be between %s and %s, got %s", min, max, d)
+	}
+}
+
+func (v *validator) number(path string, n, min, max float64) {
+	if n < min || n > max {
+		v.fail(path, "must be between %g and %g, got %g", min, max, n)
+	}
+}
+
+func (v *validator) http(path string, c models.HTTPConfig) {
+	v.port(path+".port", c.Port)
+	v.duration(path+".read_timeout", c.ReadTimeout, time.Second, 5*time.Minute)
+	v.duration(path+".write_timeout", c.WriteTimeout, time.Second, 5*time.Minute)
+	v.duration(path+".idle_timeout", c.IdleTimeout, time.Second, 30*time.Minute)
+}
+
+// Validate checks every value and reports all problems at once.
+func Validate(cfg *models.Config) error {
+	v := &validator{}
+
+	v.required("database.host", cfg.Database.Host)
+	v.port("database.port", cfg.Database.Port)
+	v.required("database.user", cfg.Database.User)
+	v.required("database.database", cfg.Database.Database)
+	v.number("database.max_conns", float64(cfg.Database.MaxConns), 1, 500)
+
+	v.required("rabbitmq.host", cfg.RabbitMQ.Host)
+	v.port("rabbitmq.port", cfg.RabbitMQ.Port)
+	v.required("rabbitmq.user", cfg.RabbitMQ.User)
+
+	validateMail(v, cfg.Mail)
+
+	v.port("websocket.port", cfg.WebSocket.Port)
+	validateWaitTariffs(v, "wait_tariffs", cfg.WaitTariffs)
+
+	ride := cfg.Services.RideService
+	v.http("services.ride_service", ride.HTTPConfig)
+	matchTimeout := settings.MustLookup(settings.MatchTimeout)
+	v.duration("services.ride_service.match_timeout", ride.MatchTimeout, matchTimeout.MinDuration(), matchTimeout.MaxDuration())
+	validateTariffs(v, "services.ride_service.tariffs", ride.Tariffs)
+
+	driver := cfg.Services.DriverLocationService
+	v.http("services.driver_location_service", driver.HTTPConfig)
+
+	v.http("services.auth_service", cfg.Services.AuthService.HTTPConfig)
+	authCfg := cfg.Services.AuthService
+	validateLoginLimits(v, "services.auth_service.login_limits", authCfg.LoginLimits)
+	if u, err := url.Parse(authCfg.PublicURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		v.fail("services.auth_service.public_url", "must be an http(s) URL, got %q", authCfg.PublicURL)
+	}
+	v.duration("services.auth_service.verify_token_ttl", authCfg.VerifyTokenTTL, 10*time.Minute, 30*24*time.Hour)
+	v.duration("services.auth_service.reset_token_ttl", authCfg.ResetTokenTTL, 5*time.Minute, 24*time.Hour)
+	otp := authCfg.OTP
+	v.number("services.auth_service.otp.code_length", float64(otp.CodeLength), 4, 10)
+	v.duration("services.auth_service.otp.ttl", otp.TTL, 30*time.Second, time.Hour)
+	v.number("services.auth_service.otp.max_attempts", float64(otp.MaxAttempts), 1, 20)
+	v.duration("services.auth_service.otp.resend_interval", otp.ResendInterval, 0, otp.TTL)
+	v.number("services.auth_service.otp.max_per_hour", float64(otp.MaxPerHour), 1, 100)
+	v.number("services.auth_service.otp.max_per_ip_per_hour", float64(otp.MaxPerIPPerHour), 1, 10000)
+	v.http("services.admin_service", cfg.Services.AdminService)
+
+	ports := map[int]string{}
+	for path, port := range map[string]int{
+		"services.ride_service.port":            ride.Port,
+		"services.driver_location_service.port": driver.Port,
+		"services.auth_service.port":            cfg.Services.AuthService.Port,
+		"services.admin_service.port":           cfg.Services.AdminService.Port,
+	} {
+		if other, ok := ports[port]; ok {
+			first, second := min(path, other), max(path, other)
+			v.fail(second, "port %d is already used by %s", port, first)
+		}
+		ports[port] = path
+	}
+
+	validateJWT(v, cfg.JWT, cfg.DevMode)
+
+	v.duration("shutdown.timeout", cfg.Shutdown.Timeout, time.Second, 10*time.Minute)
+	if cfg.Shutdown.DrainDelay < 0 || cfg.Shutdown.DrainDelay >= cfg.Shutdown.Timeout {
+		v.fail("shutdown.drain_delay", "must be at least 0 and shorter than shutdown.timeout (%s), got %s", cfg.Shutdown.Timeout, cfg.Shutdown.DrainDelay)
+	}
+
+	if len(v.errs) > 0 {
+		return fmt.Errorf("invalid configuration:\n  %s", strings.Join(v.errs, "\n  "))
+	}
+	return nil
+}
+
+func validateMail(v *validator, cfg models.MailConfig) {
+	if _, err := mail.ParseAddress(cfg.From); err != nil {
+		v.fail("mail.from", "must be an email address, got %q", cfg.From)
+	}
+	switch cfg.Driver {
+	case "smtp":
+		v.required("mail.smtp.host", cfg.SMTP.Host)
+		v.port("mail.smtp.port", cfg.SMTP.Port)
+		v.duration("mail.smtp.timeout", cfg.SMTP.Timeout, time.Second, 5*time.Minute)
+		if cfg.SMTP.Username != "" && !cfg.SMTP.StartTLS {
+			v.fail("mail.smtp.starttls", "must be true when a username is set")
+		}
+	case "file":
+		v.required("mail.dir", cfg.Dir)
+	case "console":
+	default:
+		v.fail("mail.driver", "must be one of smtp, file, console, got %q", cfg.Driver)
+	}
+}
+
+func validateLoginLimits(v *validator, path string, l models.LoginLimitsConfig) {
+	v.number(path+".account_max_failures", float64(l.AccountMaxFailures), 1, 100)
+	v.number(path+".ip_max_failures", float64(l.IPMaxFailures), 1, 10000)
+	v.duration(path+".backoff_base", l.BackoffBase, 0, time.Minute)
+	v.duration(path+".lockout_duration", l.LockoutDuration, time.Second, 24*time.Hour)
+	v.duration(path+".max_lockout", l.MaxLockout, l.LockoutDuration, 30*24*time.Hour)
+	v.duration(path+".failure_window", l.FailureWindow, time.Minute, 7*24*time.Hour)
+}
+
+// devKeyPrefix marks key ids that may only be used with dev_mode on, so a
+// development key cannot end up signing production tokens.
+const devKeyPrefix = "dev-"
+
+func validateJWT(v *validator, cfg models.JWTConfig, devMode bool) {
+	v.required("jwt.issuer", cfg.Issuer)
+	v.required("jwt.audience", cfg.Audience)
+	v.duration("jwt.access_token_ttl", cfg.AccessTokenTTL, 30*time.Second, 24*time.Hour)
+	v.duration("jwt.refresh_token_ttl", cfg.RefreshTokenTTL, time.Hour, 365*24*time.Hour)
+	if cfg.RefreshTokenTTL <= cfg.AccessTokenTTL {
+		v.fail("jwt.refresh_token_ttl", "must be longer than access_token_ttl")
+	}
+
+	ids := map[string]bool{}
+	signingKey := false
+	for i, k := range cfg.Keys {
+		p := fmt.Sprintf("jwt.keys[%d]", i)
+		v.required(p+".id", k.ID)
+		if ids[k.ID] {
+			v.fail(p+".id", "%s is defined twice", k.ID)
+		}
+		ids[k.ID] = true
+		if strings.HasPrefix(k.ID, devKeyPrefix) && !devMode {
+			v.fail(p+".id", "%s is a development key and needs dev_mode", k.ID)
+		}
+
+		if !slices.Contains(auth.Algorithms, k.Algorithm) {
+			v.fail(p+".algorithm", "must be one of %s, got %q", strings.Join(auth.Algorithms, ", "), k.Algorithm)
+		}
+		if k.PrivateKeyFile == "" && k.PublicKeyFile == "" {
+			v.fail(p, "needs private_key_file or public_key_file")
+		}
+		if k.ID == cfg.SigningKeyID {
+			signingKey = true
+		}
+	}
+
+	if cfg.SigningKeyID != "" && !signingKey {
+		v.fail("jwt.signing_key_id", "no key with id %q", cfg.SigningKeyID)
+	}
+	if len(cfg.Keys) == 0 && cfg.JWKSURL == "" {
+		v.fail("jwt", "needs keys or a jwks_url to verify tokens")
+	}
+	if cfg.JWKSURL != "" {
+		v.duration("jwt.jwks_refresh", cfg.JWKSRefresh, 10*time.Second, 24*time.Hour)
+	}
+}
+
+// ValidateIssuer checks what auth-service needs on top of Validate to sign
+// tokens. The other services only verify, so they get public keys alone.
+func ValidateIssuer(cfg *models.Config) error {
+	v := &validator{}
+
+	v.required("jwt.signing_key_id", cfg.JWT.SigningKeyID)
+	for i, k := range cfg.JWT.Keys {
+		v.required(fmt.Sprintf("jwt.keys[%d].private_key_file", i), k.PrivateKeyFile)
+	}
+
+	if len(v.errs) > 0 {
+		return fmt.Errorf("invalid configuration:\n  %s", strings.Join(v.errs, "\n  "))
+	}
+	return nil
+}
+
+func validateTariffs(v *validator, path string, tariffs []models.Tariff) {
+	seen := map[string]bool{}
+	for i, t := range tariffs {
+		p := fmt.Sprintf("%s[%d]", path, i)
+		if !knownRideType(t.RideType) {
+			v.fail(p+".ride_type", "must be one of %s, got %q", strings.Join(RideTypes, ", "), t.RideType)
+		}
+		if seen[t.RideType] {
+			v.fail(p+".ride_type", "%s is defined twice", t.RideType)
+		}
+		seen[t.RideType] = true
+
+		v.number(p+".base_fare", t.BaseFare, 0, 1e6)
+		v.number(p+".per_km", t.PerKm, 0, 1e5)
+		v.number(p+".per_minute", t.PerMinute, 0, 1e5)
+	}
+	for _, rideType := range RideTypes {
+		if !seen[rideType] {
+			v.fail(path, "no tariff for %s", rideType)
+		}
+	}
+}
+
+func validateWaitTariffs(v *validator, path string, tariffs []models.WaitTariff) {
+	seen := map[string]bool{}
+	for i, t := range tariffs {
+		p := fmt.Sprintf("%s[%d]", path, i)
+		if !knownRideType(t.RideType) {
+			v.fail(p+".ride_type", "must be one of %s, got %q", strings.Join(RideTypes, ", "), t.RideType)
+		}
+		if seen[t.RideType] {
+			v.fail(p+".ride_type", "%s is defined twice", t.RideType)
+		}
+		seen[t.RideType] = true
+
+		v.duration(p+".free_period", t.FreePeriod, 0, time.Hour)
+		v.number(p+".per_minute", t.PerMinute, 0, 1e5)
+		v.duration(p+".no_show_after", t.NoShowAfter, time.Minute, time.Hour)
+		v.number(p+".no_show_fee", t.NoShowFee, 0, 1e6)
+	}
+	for _, rideType := range RideTypes {
+		if !seen[rideType] {
+			v.fail(path, "no wait tariff for %s", rideType)
+		}
+	}
+}
+
+func knownRideType(rideType string) bool {
+	for _, t := range RideTypes {
+		if t == rideType {
+			return true
+		}
+	}
+	return false
+}
@@ -3,27 +3,34 @@ package db
 import (
 	"context"
 	"fmt"
-	"log"
+	"net/url"
 	"ride-hail/internal/shared/models"
+	"ride-hail/internal/shared/util"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 func ConnectToDB(cfg *models.DatabaseConfig) *pgxpool.Pool {
-	dsn := fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable",
-		cfg.User, cfg.Password, cfg.Host, cfg.Port, cfg.Database)
+	dsn := fmt.Sprintf("postgres://%s:%s@%s:%d/%s?sslmode=disable",
+		url.QueryEscape(cfg.User), url.QueryEscape(cfg.Password), cfg.Host, cfg.Port, cfg.Database)
 
-	pool, err := pgxpool.New(context.Background(), dsn)
+	poolCfg, err := pgxpool.ParseConfig(dsn)
 	if err != nil {
-		log.Fatalf("Unable to connect to database: %v\n", err)
+		util.New().Fatal("Database", fmt.Errorf("invalid database config: %w", err))
+	}
+	if cfg.MaxConns > 0 {
+		poolCfg.MaxConns = cfg.MaxConns
 	}
 
-	err = pool.Ping(context.Background())
+	pool, err := pgxpool.NewWithConfig(context.Background(), poolCfg)
 	if err != nil {
-		log.Fatalf("Unable to ping database: %v\n", err)
+		util.New().Fatal("Database", fmt.Errorf("unable to connect to database: %w", err))
 	}
 
-	fmt.Println("Connected to PostgreSQL!")
+	err = pool.Ping(context.Background())
+	if err != nil {
+		util.New().Fatal("Database", fmt.Errorf("unable to ping database: %w", err))
+	}
 
 	return pool
 }
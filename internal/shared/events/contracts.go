@@ -0,0 +1,68 @@
+package events
+
+import "time"
+
+const (
+	TypeRideRequested     = "ride.requested"
+	TypeRideStatusChanged = "ride.status_changed"
+	TypeDriverResponded   = "driver.responded"
+	TypeTokenRevoked      = "auth.token_revoked"
+)
+
+type Location struct {
+	Lat     float64 `json:"lat"`
+	Lng     float64 `json:"lng"`
+	Address string  `json:"address"`
+}
+
+// RideRequested is published on ride_topic with routing key ride.request.{ride_type}.
+type RideRequested struct {
+	RideID              string   `json:"ride_id"`
+	RideNumber          string   `json:"ride_number"`
+	PickupLocation      Location `json:"pickup_location"`
+	DestinationLocation Location `json:"destination_location"`
+	RideType            string   `json:"ride_type"`
+	EstimatedFare       float64  `json:"estimated_fare"`
+	TimeoutSeconds      int      `json:"timeout_seconds"`
+}
+
+// RideStatusChanged is published on ride_topic with routing key ride.status.{status}.
+type RideStatusChanged struct {
+	RideID    string    `json:"ride_id"`
+	Status    string    `json:"status"`
+	DriverID  string    `json:"driver_id,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// DriverResponded is published on driver_topic with routing key driver.response.{ride_id}.
+type DriverResponded struct {
+	RideID   string `json:"ride_id"`
+	DriverID string `json:"driver_id"`
+	Accepted bool   `json:"accepted"`
+}
+
+// TokenRevoked is published on auth_fanout. It names either one access token
+// by TokenID, or with UserID every token of a user issued up to RevokedAt.
+// Services may forget it after ExpiresAt, when the tokens it covers have expired.
+type TokenRevoked struct {
+	TokenID   string    `json:"token_id,omitempty"`
+	UserID    string    `json:"user_id,omitempty"`
+	Reason    string    `json:"reason"`
+	RevokedAt time.Time `json:"revoked_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Contract ties an event type to its data struct. Contracts is the list the
+// JSON schemas are generated from.
+type Contract struct {
+	Type string
+	Data interface{}
+}
+
+var Contracts = []Contract{
+	{Type: TypeRideRequested, Data: RideRequested{}},
+	{Type: TypeRideStatusChanged, Data: RideStatusChanged{}},
+	{Type: TypeDriverResponded, Data: DriverResponded{}},
+	{Type: TypeTokenRevoked, Data: TokenRevoked{}},
+}
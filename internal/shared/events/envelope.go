@@ -0,0 +1,96 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// CurrentVersion is the schema version written by producers. Consumers also
+// accept PreviousVersion, the bare payloads sent before the envelope existed.
+const (
+	CurrentVersion  = 2
+	PreviousVersion = 1
+)
+
+// Envelope wraps every event published to RabbitMQ.
+type Envelope struct {
+	EventID       string          `json:"event_id"`
+	EventType     string          `json:"event_type"`
+	SchemaVersion int             `json:"schema_version"`
+	CorrelationID string          `json:"correlation_id"`
+	OccurredAt    time.Time       `json:"occurred_at"`
+	Producer      string          `json:"producer"`
+	Data          json.RawMessage `json:"data"`
+}
+
+// Meta is the envelope without its data, as seen by consumers.
+type Meta struct {
+	EventID       string
+	EventType     string
+	SchemaVersion int
+	CorrelationID string
+	OccurredAt    time.Time
+	Producer      string
+}
+
+func New(eventType, producer, correlationID string, data interface{}) (*Envelope, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal %s data: %w", eventType, err)
+	}
+
+	return &Envelope{
+		EventID:       uuid.NewString(),
+		EventType:     eventType,
+		SchemaVersion: CurrentVersion,
+		CorrelationID: correlationID,
+		OccurredAt:    time.Now().UTC(),
+		Producer:      producer,
+		Data:          raw,
+	}, nil
+}
+
+// Decode reads either an enveloped event of a supported version or a bare
+// previous-version payload into data.
+func Decode(body []byte, eventType string, data interface{}) (Meta, error) {
+	var probe struct {
+		SchemaVersion *int            `json:"schema_version"`
+		Data          json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(body, &probe); err != nil {
+		return Meta{}, err
+	}
+
+	if probe.SchemaVersion == nil {
+		if err := json.Unmarshal(body, data); err != nil {
+			return Meta{}, fmt.Errorf("invalid v%d %s payload: %w", PreviousVersion, eventType, err)
+		}
+		return Meta{EventType: eventType, SchemaVersion: PreviousVersion}, nil
+	}
+
+	var env Envelope
+	if err := json.Unmarshal(body, &env); err != nil {
+		return Meta{}, err
+	}
+	if env.SchemaVersion < PreviousVersion || env.SchemaVersion > CurrentVersion {
+		return Meta{}, fmt.Errorf("unsupported schema_version %d for %s", env.SchemaVersion, eventType)
+	}
+	if env.EventType != eventType {
+		return Meta{}, fmt.Errorf("unexpected event_type %q, want %q", env.EventType, eventType)
+	}
+	if err := json.Unmarshal(env.Data, data); err != nil {
+		return Meta{}, fmt.Errorf("invalid v%d %s data: %w", env.SchemaVersion, eventType, err)
+	}
+
+	return Meta{
+		EventID:       env.EventID,
+		EventType:     env.EventType,
+		SchemaVersion: env.SchemaVersion,
+		CorrelationID: env.CorrelationID,
+		OccurredAt:    env.OccurredAt,
+		Producer:      env.Producer,
+	}, nil
+}
@@ -0,0 +1,119 @@
+package events
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// The committed schemas are the golden files of the message contracts. Any
+// change to the structs above must be followed by `ridehail events export`, and
+// `ridehail events check` fails while the two disagree.
+//
+//go:embed schemas/*.json
+var golden embed.FS
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// SchemaFileName is the golden file name of the contract's current version.
+func SchemaFileName(c Contract) string {
+	return fmt.Sprintf("%s.v%d.schema.json", c.Type, CurrentVersion)
+}
+
+// Schema returns the JSON Schema of the enveloped event.
+func Schema(c Contract) ([]byte, error) {
+	envelope := objectSchema(reflect.TypeOf(Envelope{}))
+	envelope["$schema"] = "http://json-schema.org/draft-07/schema#"
+	envelope["title"] = c.Type
+
+	props := envelope["properties"].(map[string]interface{})
+	props["event_type"] = map[string]interface{}{"const": c.Type}
+	props["schema_version"] = map[string]interface{}{"type": "integer", "minimum": PreviousVersion, "maximum": CurrentVersion}
+	props["data"] = typeSchema(reflect.TypeOf(c.Data))
+
+	out, err := json.MarshalIndent(envelope, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(out, '\n'), nil
+}
+
+// CheckGolden compares every contract with its committed schema.
+func CheckGolden() error {
+	var stale []string
+	for _, c := range Contracts {
+		want, err := Schema(c)
+		if err != nil {
+			return err
+		}
+		got, err := golden.ReadFile("schemas/" + SchemaFileName(c))
+		if err != nil || !bytes.Equal(got, want) {
+			stale = append(stale, SchemaFileName(c))
+		}
+	}
+	if len(stale) > 0 {
+		return fmt.Errorf("event contracts changed without updating golden schemas: %s", strings.Join(stale, ", "))
+	}
+	return nil
+}
+
+func typeSchema(t reflect.Type) map[string]interface{} {
+	if t == timeType {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+	if t == reflect.TypeOf(json.RawMessage{}) {
+		return map[string]interface{}{}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return typeSchema(t.Elem())
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice:
+		return map[string]interface{}{"type": "array", "items": typeSchema(t.Elem())}
+	case reflect.Struct:
+		return objectSchema(t)
+	}
+	return map[string]interface{}{}
+}
+
+func objectSchema(t reflect.Type) map[string]interface{} {
+	props := map[string]interface{}{}
+	required := []string{}
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" || !f.IsExported() {
+			continue
+		}
+
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = f.Name
+		}
+
+		props[name] = typeSchema(f.Type)
+		if !strings.Contains(opts, "omitempty") {
+			required = append(required, name)
+		}
+	}
+
+	return map[string]interface{}{
+		"type":                 "object",
+		"properties":           props,
+		"required":             required,
+		"additionalProperties": true,
+	}
+}
@@ -0,0 +1,117 @@
+package events
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckGolden(t *testing.T) {
+	if err := CheckGolden(); err != nil {
+		t.Fatalf("%v; run `go run ./cmd/ridehail events export`", err)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	occurred := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	want := RideStatusChanged{RideID: "ride-1", Status: "MATCHED", DriverID: "driver-1", Timestamp: occurred}
+
+	tests := []struct {
+		name    string
+		body    string
+		meta    Meta
+		wantErr string
+	}{
+		{
+			name: "v1 bare payload",
+			body: `{"ride_id":"ride-1","status":"MATCHED","driver_id":"driver-1","timestamp":"2026-10-01T12:00:00Z"}`,
+			meta: Meta{EventType: TypeRideStatusChanged, SchemaVersion: 1},
+		},
+		{
+			name: "v2 envelope",
+			body: `{"event_id":"evt-1","event_type":"ride.status_changed","schema_version":2,"correlation_id":"req-1",
+				"occurred_at":"2026-10-01T12:00:00Z","producer":"ride-service",
+				"data":{"ride_id":"ride-1","status":"MATCHED","driver_id":"driver-1","timestamp":"2026-10-01T12:00:00Z"}}`,
+			meta: Meta{EventID: "evt-1", EventType: TypeRideStatusChanged, SchemaVersion: 2, CorrelationID: "req-1",
+				OccurredAt: occurred, Producer: "ride-service"},
+		},
+		{
+			name: "v1 in an envelope",
+			body: `{"event_id":"evt-2","event_type":"ride.status_changed","schema_version":1,
+				"data":{"ride_id":"ride-1","status":"MATCHED","driver_id":"driver-1","timestamp":"2026-10-01T12:00:00Z"}}`,
+			meta: Meta{EventID: "evt-2", EventType: TypeRideStatusChanged, SchemaVersion: 1},
+		},
+		{
+			name:    "unsupported version",
+			body:    `{"event_type":"ride.status_changed","schema_version":3,"data":{}}`,
+			wantErr: "unsupported schema_version 3",
+		},
+		{
+			name:    "other event type",
+			body:    `{"event_type":"ride.requested","schema_version":2,"data":{}}`,
+			wantErr: `unexpected event_type "ride.requested"`,
+		},
+		{
+			name:    "invalid v2 data",
+			body:    `{"event_type":"ride.status_changed","schema_version":2,"data":{"ride_id":1}}`,
+			wantErr: "invalid v2 ride.status_changed data",
+		},
+		{
+			name:    "invalid v1 payload",
+			body:    `{"ride_id":1}`,
+			wantErr: "invalid v1 ride.status_changed payload",
+		},
+		{
+			name:    "not JSON",
+			body:    `ride.status_changed`,
+			wantErr: "invalid character",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got RideStatusChanged
+			meta, err := Decode([]byte(tt.body), TypeRideStatusChanged, &got)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Decode() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if meta != tt.meta {
+				t.Errorf("Decode() meta = %+v, want %+v", meta, tt.meta)
+			}
+			if got != want {
+				t.Errorf("Decode() data = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestNewDecodesAsCurrentVersion(t *testing.T) {
+	data := DriverResponded{RideID: "ride-1", DriverID: "driver-1", Accepted: true}
+	env, err := New(TypeDriverResponded, "driver-service", "req-1", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := json.Marshal(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got DriverResponded
+	meta, err := Decode(body, TypeDriverResponded, &got)
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if meta.SchemaVersion != CurrentVersion || meta.EventID != env.EventID || meta.CorrelationID != "req-1" {
+		t.Errorf("Decode() meta = %+v, want version %d of event %s", meta, CurrentVersion, env.EventID)
+	}
+	if got != data {
+		t.Errorf("Decode() data = %+v, want %+v", got, data)
+	}
+}
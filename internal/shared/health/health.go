@@ -0,0 +1,145 @@
+// Package health serves the liveness (/healthz) and readiness (/readyz)
+// endpoints of a service.
+package health
+
+import (
+	"context"
+	"net/http"
+	"ride-hail/internal/shared/util"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const checkTimeout = 2 * time.Second
+
+const (
+	StatusOK          = "ok"
+	StatusDown        = "down"
+	StatusUnavailable = "unavailable"
+	StatusDraining    = "draining"
+)
+
+// Check returns nil when the dependency is usable.
+type Check func(ctx context.Context) error
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+type Checker struct {
+	mu       sync.Mutex
+	checks   []namedCheck
+	draining atomic.Bool
+}
+
+func NewChecker() *Checker {
+	return &Checker{}
+}
+
+// Add registers a dependency that must be healthy for the service to be ready.
+func (c *Checker) Add(name string, check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks = append(c.checks, namedCheck{name: name, check: check})
+}
+
+// SetDraining makes /readyz fail from now on, so no new traffic is routed to
+// the service while it shuts down.
+func (c *Checker) SetDraining() {
+	c.draining.Store(true)
+}
+
+func (c *Checker) Draining() bool {
+	return c.draining.Load()
+}
+
+type DependencyStatus struct {
+	Status    string `json:"status"`
+	Error     string `json:"error,omitempty"`
+	LatencyMs int64  `json:"latency_ms"`
+}
+
+type Report struct {
+	Status string                      `json:"status"`
+	Checks map[string]DependencyStatus `json:"checks,omitempty"`
+}
+
+// Run checks every dependency concurrently.
+func (c *Checker) Run(ctx context.Context) Report {
+	c.mu.Lock()
+	checks := append([]namedCheck(nil), c.checks...)
+	c.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	report := Report{Status: StatusOK, Checks: make(map[string]DependencyStatus, len(checks))}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, nc := range checks {
+		wg.Add(1)
+		go func(nc namedCheck) {
+			defer wg.Done()
+
+			start := time.Now()
+			dep := DependencyStatus{Status: StatusOK}
+			if err := nc.check(ctx); err != nil {
+				dep.Status = StatusDown
+				dep.Error = err.Error()
+			}
+			dep.LatencyMs = time.Since(start).Milliseconds()
+
+			mu.Lock()
+			report.Checks[nc.name] = dep
+			if dep.Status != StatusOK {
+				report.Status = StatusUnavailable
+			}
+			mu.Unlock()
+		}(nc)
+	}
+	wg.Wait()
+
+	if c.Draining() {
+		report.Status = StatusDraining
+	}
+	return report
+}
+
+// LivenessHandler answers 200 as long as the process can serve HTTP.
+func (c *Checker) LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		util.ResponseInJson(w, http.StatusOK, Report{Status: StatusOK})
+	})
+}
+
+// ReadinessHandler answers 200 when every dependency is healthy and 503 when one
+// of them is down or the service is draining.
+func (c *Checker) ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := c.Run(r.Context())
+
+		status := http.StatusOK
+		if report.Status != StatusOK {
+			status = http.StatusServiceUnavailable
+		}
+		util.ResponseInJson(w, status, report)
+	})
+}
+
+// Register mounts /healthz and /readyz on mux.
+func (c *Checker) Register(mux *http.ServeMux) {
+	mux.Handle("GET /healthz", c.LivenessHandler())
+	mux.Handle("GET /readyz", c.ReadinessHandler())
+}
+
+// PgxPool checks that a connection can be acquired and answers a ping.
+func PgxPool(pool *pgxpool.Pool) Check {
+	return func(ctx context.Context) error {
+		return pool.Ping(ctx)
+	}
+}
@@ -1,25 +0,0 @@
-package jwt
-
-import (
-	"ride-hail/internal/shared/models"
-	"time"
-
-	"github.com/golang-jwt/jwt/v5"
-)
-
-var JwtKey = []byte("awdwkamdawdnhbkdl")
-
-func GenerateJWT(role string) (string, error) {
-	expirationTime := time.Now().Add(15 * time.Hour)
-	claims := &models.Claims{
-		Role: role,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expirationTime),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-		},
-	}
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-
-	return token.SignedString(JwtKey)
-}
@@ -0,0 +1,117 @@
+// Package lifecycle runs the graceful shutdown shared by all services.
+package lifecycle
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"ride-hail/internal/shared/health"
+	"ride-hail/internal/shared/models"
+	"ride-hail/internal/shared/util"
+	"syscall"
+	"time"
+)
+
+// Stage is one step of the shutdown. It should return once its work is done
+// or ctx expires, whichever comes first.
+type Stage func(ctx context.Context) error
+
+type namedStage struct {
+	name string
+	run  Stage
+}
+
+// Manager shuts a service down in a fixed order: it marks the service as
+// draining, waits DrainDelay so load balancers stop routing to it, then runs
+// the registered stages one after another. Everything shares one deadline,
+// Timeout, counted from the signal.
+type Manager struct {
+	cfg     models.ShutdownConfig
+	checker *health.Checker
+	logger  *util.Logger
+	stages  []namedStage
+}
+
+func New(cfg models.ShutdownConfig, checker *health.Checker, logger *util.Logger) *Manager {
+	return &Manager{cfg: cfg, checker: checker, logger: logger}
+}
+
+// Add registers a stage. Stages run in the order they were added, so add them
+// from the outside in: servers first, then consumers and background work, then
+// buffers, then the connections everything else depends on.
+func (m *Manager) Add(name string, run Stage) {
+	m.stages = append(m.stages, namedStage{name: name, run: run})
+}
+
+// AddCloser registers a stage that cannot fail or be interrupted, like closing a pool.
+func (m *Manager) AddCloser(name string, closeFn func()) {
+	m.Add(name, func(context.Context) error {
+		closeFn()
+		return nil
+	})
+}
+
+// Wait blocks until SIGINT or SIGTERM and then shuts down.
+func (m *Manager) Wait() {
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-quit
+	signal.Stop(quit)
+
+	m.logger.Warn("Lifecycle", fmt.Sprintf("received %s, shutting down (deadline %s)", sig, m.cfg.Timeout))
+	m.Shutdown()
+}
+
+// Shutdown runs the shutdown sequence. Stages that fail are logged and the
+// sequence continues, so connections are always closed.
+func (m *Manager) Shutdown() {
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), m.cfg.Timeout)
+	defer cancel()
+
+	if m.checker != nil {
+		m.checker.SetDraining()
+	}
+	if m.cfg.DrainDelay > 0 {
+		select {
+		case <-time.After(m.cfg.DrainDelay):
+		case <-ctx.Done():
+		}
+	}
+
+	for _, stage := range m.stages {
+		stageStart := time.Now()
+		if err := stage.run(ctx); err != nil {
+			m.logger.Error("Lifecycle", fmt.Errorf("%s: %w", stage.name, err))
+			continue
+		}
+		m.logger.OK("Lifecycle", fmt.Sprintf("%s stopped (%dms)", stage.name, time.Since(stageStart).Milliseconds()))
+	}
+
+	if ctx.Err() != nil {
+		m.logger.Warn("Lifecycle", fmt.Sprintf("shutdown deadline of %s exceeded", m.cfg.Timeout))
+	}
+	m.logger.Info("Lifecycle", fmt.Sprintf("shutdown complete in %dms", time.Since(start).Milliseconds()))
+}
+
+// Background runs fn in a goroutine and returns a stage that cancels it and
+// waits for it to return.
+func Background(fn func(ctx context.Context)) Stage {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fn(ctx)
+	}()
+
+	return func(stopCtx context.Context) error {
+		cancel()
+		select {
+		case <-done:
+			return nil
+		case <-stopCtx.Done():
+			return stopCtx.Err()
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package lifecycle
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Tasks runs work that outlives the request that started it, such as an email
+// sent after the response. Stop is a shutdown stage that waits for the running
+// tasks; tasks started after it run before Go returns.
+type Tasks struct {
+	mu      sync.Mutex
+	stopped bool
+	wg      sync.WaitGroup
+}
+
+// Go runs fn in a goroutine with the values of ctx but not its cancellation,
+// bounded by timeout.
+func (t *Tasks) Go(ctx context.Context, timeout time.Duration, fn func(ctx context.Context)) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+
+	t.mu.Lock()
+	stopped := t.stopped
+	if !stopped {
+		t.wg.Add(1)
+	}
+	t.mu.Unlock()
+
+	if stopped {
+		defer cancel()
+		fn(ctx)
+		return
+	}
+	go func() {
+		defer t.wg.Done()
+		defer cancel()
+		fn(ctx)
+	}()
+}
+
+func (t *Tasks) Stop(ctx context.Context) error {
+	t.mu.Lock()
+	t.stopped = true
+	t.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		t.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("background tasks did not finish in time: %w", ctx.Err())
+	}
+}
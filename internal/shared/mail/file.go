@@ -0,0 +1,51 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"ride-hail/internal/shared/util"
+	"time"
+)
+
+// FileMailer writes every message to its own .eml file, which any mail client
+// can open.
+type FileMailer struct {
+	dir  string
+	from *mail.Address
+}
+
+func (m *FileMailer) Send(ctx context.Context, msg Message) error {
+	data, err := render(m.from, msg)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(m.dir, 0o755); err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405.000000000"), util.GenerateUUID()[:8])
+	return os.WriteFile(filepath.Join(m.dir, name), data, 0o600)
+}
+
+// ConsoleMailer logs messages instead of sending them.
+type ConsoleMailer struct {
+	from   *mail.Address
+	logger *util.Logger
+}
+
+func (m *ConsoleMailer) Send(ctx context.Context, msg Message) error {
+	data, err := render(m.from, msg)
+	if err != nil {
+		return err
+	}
+	m.logger.WithContext(ctx).Info("Mail", "not sent, console mail driver:\n"+string(data))
+	return nil
+}
+
+var (
+	_ Mailer = (*FileMailer)(nil)
+	_ Mailer = (*ConsoleMailer)(nil)
+)
@@ -0,0 +1,79 @@
+package metrics
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var (
+	httpRequests = NewCounterVec("http_requests_total",
+		"HTTP requests handled, by route, method and status.", "route", "method", "status")
+	httpDuration = NewHistogramVec("http_request_duration_seconds",
+		"HTTP request latency in seconds, by route, method and status.", nil, "route", "method", "status")
+
+	// WebSocketConnections is the number of open WebSocket connections, by client role.
+	WebSocketConnections = NewGaugeVec("websocket_connections_active",
+		"Open WebSocket connections, by client role.", "role")
+)
+
+// InstrumentHandler records the latency and status of every request served by
+// mux. It must wrap the ServeMux directly, because the matched route is read
+// from the request the mux has routed.
+func InstrumentHandler(mux http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+
+		mux.ServeHTTP(rec, r)
+
+		route := r.Pattern
+		if route == "" {
+			route = "unmatched"
+		}
+		status := rec.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		labels := []string{route, r.Method, strconv.Itoa(status)}
+		httpRequests.Inc(labels...)
+		httpDuration.Observe(time.Since(start).Seconds(), labels...)
+	})
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// Hijack lets WebSocket upgrades through; the connection is reported as 101.
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+	r.status = http.StatusSwitchingProtocols
+	return hijacker.Hijack()
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
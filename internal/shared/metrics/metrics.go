@@ -0,0 +1,338 @@
+// Package metrics is a small, dependency-free implementation of the Prometheus
+// text exposition format. Metrics register themselves in a process-wide
+// registry when they are created and are served by Handler.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefBuckets are the default histogram buckets, in seconds.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type collector interface {
+	name() string
+	write(w io.Writer)
+}
+
+var (
+	registryMu sync.Mutex
+	registry   = map[string]collector{}
+)
+
+func register(c collector) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if _, ok := registry[c.name()]; ok {
+		panic("metrics: duplicate metric " + c.name())
+	}
+	registry[c.name()] = c
+}
+
+// Handler serves every registered metric in the Prometheus text format.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		registryMu.Lock()
+		collectors := make([]collector, 0, len(registry))
+		for _, c := range registry {
+			collectors = append(collectors, c)
+		}
+		registryMu.Unlock()
+
+		sort.Slice(collectors, func(i, j int) bool { return collectors[i].name() < collectors[j].name() })
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		for _, c := range collectors {
+			c.write(w)
+		}
+	})
+}
+
+// --- VECTORS ---
+
+// vec holds one series per combination of label values.
+type vec[T any] struct {
+	metricName string
+	help       string
+	kind       string
+	labels     []string
+
+	mu     sync.Mutex
+	series map[string]*entry[T]
+	init   func() *T
+}
+
+type entry[T any] struct {
+	labelValues []string
+	value       *T
+}
+
+func newVec[T any](name, help, kind string, labels []string, init func() *T) *vec[T] {
+	return &vec[T]{
+		metricName: name,
+		help:       help,
+		kind:       kind,
+		labels:     labels,
+		series:     map[string]*entry[T]{},
+		init:       init,
+	}
+}
+
+func (v *vec[T]) name() string { return v.metricName }
+
+// with returns the series for labelValues and must be called with v.mu held.
+func (v *vec[T]) with(labelValues []string) *T {
+	if len(labelValues) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", v.metricName, len(v.labels), len(labelValues)))
+	}
+
+	key := strings.Join(labelValues, "\xff")
+	e, ok := v.series[key]
+	if !ok {
+		e = &entry[T]{labelValues: append([]string(nil), labelValues...), value: v.init()}
+		v.series[key] = e
+	}
+	return e.value
+}
+
+// sorted returns the series ordered by label values and must be called with v.mu held.
+func (v *vec[T]) sorted() []*entry[T] {
+	entries := make([]*entry[T], 0, len(v.series))
+	for _, e := range v.series {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return strings.Join(entries[i].labelValues, "\xff") < strings.Join(entries[j].labelValues, "\xff")
+	})
+	return entries
+}
+
+func (v *vec[T]) header(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", v.metricName, escapeHelp(v.help), v.metricName, v.kind)
+}
+
+// --- COUNTER ---
+
+type CounterVec struct {
+	*vec[float64]
+}
+
+// NewCounterVec registers a counter. Without labels the counter is always
+// exported, starting at zero.
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{newVec(name, help, "counter", labels, func() *float64 { return new(float64) })}
+	if len(labels) == 0 {
+		c.Add(0)
+	}
+	register(c)
+	return c
+}
+
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add increases the counter; negative values are ignored.
+func (c *CounterVec) Add(delta float64, labelValues ...string) {
+	if delta < 0 {
+		return
+	}
+	c.mu.Lock()
+	*c.with(labelValues) += delta
+	c.mu.Unlock()
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	writeScalar(w, c.vec)
+}
+
+// --- GAUGE ---
+
+type GaugeVec struct {
+	*vec[float64]
+}
+
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{newVec(name, help, "gauge", labels, func() *float64 { return new(float64) })}
+	if len(labels) == 0 {
+		g.Add(0)
+	}
+	register(g)
+	return g
+}
+
+func (g *GaugeVec) Set(value float64, labelValues ...string) {
+	g.mu.Lock()
+	*g.with(labelValues) = value
+	g.mu.Unlock()
+}
+
+func (g *GaugeVec) Add(delta float64, labelValues ...string) {
+	g.mu.Lock()
+	*g.with(labelValues) += delta
+	g.mu.Unlock()
+}
+
+func (g *GaugeVec) Inc(labelValues ...string) { g.Add(1, labelValues...) }
+func (g *GaugeVec) Dec(labelValues ...string) { g.Add(-1, labelValues...) }
+
+func (g *GaugeVec) write(w io.Writer) {
+	writeScalar(w, g.vec)
+}
+
+func writeScalar(w io.Writer, v *vec[float64]) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if len(v.series) == 0 {
+		return
+	}
+	v.header(w)
+	for _, e := range v.sorted() {
+		fmt.Fprintf(w, "%s%s %s\n", v.metricName, formatLabels(v.labels, e.labelValues), formatFloat(*e.value))
+	}
+}
+
+// --- FUNC METRICS ---
+
+// funcMetric reads its value when the metrics are scraped.
+type funcMetric struct {
+	metricName string
+	help       string
+	kind       string
+	fn         func() float64
+}
+
+// NewGaugeFunc registers a gauge whose value is read from fn on every scrape.
+func NewGaugeFunc(name, help string, fn func() float64) {
+	register(&funcMetric{metricName: name, help: help, kind: "gauge", fn: fn})
+}
+
+// NewCounterFunc registers a counter whose value is read from fn on every
+// scrape. fn must never decrease.
+func NewCounterFunc(name, help string, fn func() float64) {
+	register(&funcMetric{metricName: name, help: help, kind: "counter", fn: fn})
+}
+
+func (f *funcMetric) name() string { return f.metricName }
+
+func (f *funcMetric) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %s\n",
+		f.metricName, escapeHelp(f.help), f.metricName, f.kind, f.metricName, formatFloat(f.fn()))
+}
+
+// --- HISTOGRAM ---
+
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+type HistogramVec struct {
+	*vec[histogram]
+	buckets []float64
+}
+
+// NewHistogramVec registers a histogram. buckets must be sorted ascending;
+// nil means DefBuckets.
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if buckets == nil {
+		buckets = DefBuckets
+	}
+	h := &HistogramVec{buckets: buckets}
+	h.vec = newVec(name, help, "histogram", labels, func() *histogram {
+		return &histogram{counts: make([]uint64, len(buckets))}
+	})
+	register(h)
+	return h
+}
+
+func (h *HistogramVec) Observe(value float64, labelValues ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s := h.with(labelValues)
+	for i, upper := range h.buckets {
+		if value <= upper {
+			s.counts[i]++
+		}
+	}
+	s.sum += value
+	s.count++
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.series) == 0 {
+		return
+	}
+	h.header(w)
+
+	labels := append(append([]string(nil), h.labels...), "le")
+	for _, e := range h.sorted() {
+		values := append(append([]string(nil), e.labelValues...), "")
+		for i, upper := range h.buckets {
+			values[len(values)-1] = formatFloat(upper)
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.metricName, formatLabels(labels, values), e.value.counts[i])
+		}
+		values[len(values)-1] = "+Inf"
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.metricName, formatLabels(labels, values), e.value.count)
+
+		plain := formatLabels(h.labels, e.labelValues)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.metricName, plain, formatFloat(e.value.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.metricName, plain, e.value.count)
+	}
+}
+
+// --- FORMATTING ---
+
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(name)
+		b.WriteString(`="`)
+		b.WriteString(escapeLabel(values[i]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var (
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case math.IsNaN(f):
+		return "NaN"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,33 @@
+package metrics
+
+import (
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// RegisterPgxPool exports the statistics of pool. It must be called once per
+// process.
+func RegisterPgxPool(pool *pgxpool.Pool) {
+	gauge := func(name, help string, fn func(*pgxpool.Stat) int32) {
+		NewGaugeFunc(name, help, func() float64 { return float64(fn(pool.Stat())) })
+	}
+	counter := func(name, help string, fn func(*pgxpool.Stat) float64) {
+		NewCounterFunc(name, help, func() float64 { return fn(pool.Stat()) })
+	}
+
+	gauge("pgxpool_acquired_conns", "Connections currently acquired from the pool.", (*pgxpool.Stat).AcquiredConns)
+	gauge("pgxpool_idle_conns", "Idle connections in the pool.", (*pgxpool.Stat).IdleConns)
+	gauge("pgxpool_constructing_conns", "Connections currently being established.", (*pgxpool.Stat).ConstructingConns)
+	gauge("pgxpool_total_conns", "Total connections in the pool.", (*pgxpool.Stat).TotalConns)
+	gauge("pgxpool_max_conns", "Maximum size of the pool.", (*pgxpool.Stat).MaxConns)
+
+	counter("pgxpool_acquire_total", "Successful connection acquires.",
+		func(s *pgxpool.Stat) float64 { return float64(s.AcquireCount()) })
+	counter("pgxpool_acquire_duration_seconds_total", "Total time spent acquiring connections.",
+		func(s *pgxpool.Stat) float64 { return s.AcquireDuration().Seconds() })
+	counter("pgxpool_canceled_acquire_total", "Acquires cancelled by their context.",
+		func(s *pgxpool.Stat) float64 { return float64(s.CanceledAcquireCount()) })
+	counter("pgxpool_empty_acquire_total", "Acquires that had to wait for a connection.",
+		func(s *pgxpool.Stat) float64 { return float64(s.EmptyAcquireCount()) })
+	counter("pgxpool_new_conns_total", "Connections opened by the pool.",
+		func(s *pgxpool.Stat) float64 { return float64(s.NewConnsCount()) })
+}
@@ -0,0 +1,385 @@
+// Package migrate applies the SQL migrations embedded in the binaries. Every
+// migration runs in its own transaction together with the row that records
+// it, and the whole run holds a Postgres advisory lock so replicas starting at
+// the same time apply each migration once.
+package migrate
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"ride-hail/internal/shared/models"
+	"ride-hail/internal/shared/util"
+	"ride-hail/migrations"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// lockID is the advisory lock key, shared by every service.
+const lockID int64 = 0x72696465686169 // "ridehai"
+
+var fileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+var ErrNoDown = errors.New("migration has no down file")
+
+type Migration struct {
+	Version  int64
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+// Status is one migration as known to the files and to the database.
+type Status struct {
+	Version   int64      `json:"version"`
+	Name      string     `json:"name"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+	// Modified means the up file changed after it was applied.
+	Modified bool `json:"modified,omitempty"`
+	// Missing means the database has a version with no file, e.g. from a newer build.
+	Missing bool `json:"missing,omitempty"`
+}
+
+func (s Status) Applied() bool { return s.AppliedAt != nil }
+
+// Parse reads NNN_name.up.sql and NNN_name.down.sql files from the root of fsys.
+func Parse(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, e := range entries {
+		m := fileName.FindStringSubmatch(e.Name())
+		if e.IsDir() || m == nil {
+			continue
+		}
+		version, _ := strconv.ParseInt(m[1], 10, 64)
+		data, err := fs.ReadFile(fsys, e.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		} else if mig.Name != m[2] {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, mig.Name, m[2])
+		}
+
+		if m[3] == "up" {
+			mig.Up = string(data)
+			sum := sha256.Sum256(data)
+			mig.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			mig.Down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Checksum == "" {
+			return nil, fmt.Errorf("migration %d_%s has a down file but no up file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+type Runner struct {
+	pool       *pgxpool.Pool
+	migrations []Migration
+	logger     *util.Logger
+}
+
+func New(pool *pgxpool.Pool, fsys fs.FS, logger *util.Logger) (*Runner, error) {
+	migrations, err := Parse(fsys)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+	return &Runner{pool: pool, migrations: migrations, logger: logger}, nil
+}
+
+// Up applies every pending migration and returns the ones it applied.
+func (r *Runner) Up(ctx context.Context) ([]Migration, error) {
+	var applied []Migration
+	err := r.withLock(ctx, func(conn *pgx.Conn) error {
+		versions, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, m := range r.migrations {
+			if _, ok := versions[m.Version]; ok {
+				continue
+			}
+			if err := r.apply(ctx, conn, m); err != nil {
+				return err
+			}
+			applied = append(applied, m)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down rolls back the last steps applied migrations, newest first.
+func (r *Runner) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var reverted []Migration
+	err := r.withLock(ctx, func(conn *pgx.Conn) error {
+		var err error
+		reverted, err = r.down(ctx, conn, steps)
+		return err
+	})
+	return reverted, err
+}
+
+// Redo rolls back the latest migration and applies it again.
+func (r *Runner) Redo(ctx context.Context) (*Migration, error) {
+	var redone *Migration
+	err := r.withLock(ctx, func(conn *pgx.Conn) error {
+		reverted, err := r.down(ctx, conn, 1)
+		if err != nil || len(reverted) == 0 {
+			return err
+		}
+		redone = &reverted[0]
+		return r.apply(ctx, conn, *redone)
+	})
+	return redone, err
+}
+
+func (r *Runner) Status(ctx context.Context) ([]Status, error) {
+	var statuses []Status
+	err := r.withLock(ctx, func(conn *pgx.Conn) error {
+		versions, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range r.migrations {
+			s := Status{Version: m.Version, Name: m.Name}
+			if a, ok := versions[m.Version]; ok {
+				s.AppliedAt = &a.appliedAt
+				s.Modified = a.checksum != "" && a.checksum != m.Checksum
+				delete(versions, m.Version)
+			}
+			statuses = append(statuses, s)
+		}
+		for version, a := range versions {
+			statuses = append(statuses, Status{Version: version, Name: a.name, AppliedAt: &a.appliedAt, Missing: true})
+		}
+		sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+		return nil
+	})
+	return statuses, err
+}
+
+func (r *Runner) down(ctx context.Context, conn *pgx.Conn, steps int) ([]Migration, error) {
+	versions, err := appliedVersions(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	var reverted []Migration
+	for i := len(r.migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+		m := r.migrations[i]
+		if _, ok := versions[m.Version]; !ok {
+			continue
+		}
+		if m.Down == "" {
+			return reverted, fmt.Errorf("%d_%s: %w", m.Version, m.Name, ErrNoDown)
+		}
+
+		start := time.Now()
+		err := pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+			if _, err := tx.Exec(ctx, m.Down); err != nil {
+				return err
+			}
+			_, err := tx.Exec(ctx, `DELETE FROM schema_versions WHERE version = $1`, m.Version)
+			return err
+		})
+		if err != nil {
+			return reverted, fmt.Errorf("failed to revert %d_%s: %w", m.Version, m.Name, err)
+		}
+		r.logger.Info("Migrations", fmt.Sprintf("reverted %d_%s (%dms)", m.Version, m.Name, time.Since(start).Milliseconds()))
+		reverted = append(reverted, m)
+	}
+	return reverted, nil
+}
+
+func (r *Runner) apply(ctx context.Context, conn *pgx.Conn, m Migration) error {
+	start := time.Now()
+	err := pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, m.Up); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, `
+			INSERT INTO schema_versions (version, name, checksum)
+			VALUES ($1, $2, $3)
+		`, m.Version, m.Name, m.Checksum)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to apply %d_%s: %w", m.Version, m.Name, err)
+	}
+	r.logger.Info("Migrations", fmt.Sprintf("applied %d_%s (%dms)", m.Version, m.Name, time.Since(start).Milliseconds()))
+	return nil
+}
+
+// withLock runs fn on one connection while holding the advisory lock. The
+// lock belongs to the session, so it is released even if fn fails halfway.
+func (r *Runner) withLock(ctx context.Context, fn func(conn *pgx.Conn) error) error {
+	pooled, err := r.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer pooled.Release()
+	conn := pooled.Conn()
+
+	if _, err := conn.Exec(ctx, `SELECT pg_advisory_lock($1)`, lockID); err != nil {
+		return fmt.Errorf("failed to take the migration lock: %w", err)
+	}
+	defer conn.Exec(context.Background(), `SELECT pg_advisory_unlock($1)`, lockID)
+
+	if err := ensureVersionTable(ctx, conn); err != nil {
+		return err
+	}
+	return fn(conn)
+}
+
+func ensureVersionTable(ctx context.Context, conn *pgx.Conn) error {
+	_, err := conn.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_versions (
+			version bigint PRIMARY KEY,
+			name text NOT NULL,
+			checksum text NOT NULL DEFAULT '',
+			applied_at timestamptz NOT NULL DEFAULT now()
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_versions: %w", err)
+	}
+	return adoptGolangMigrate(ctx, conn)
+}
+
+// adoptGolangMigrate takes over databases migrated by the migrate/migrate
+// container, which only keeps the latest version in schema_migrations.
+// Everything up to that version is recorded as applied, without a checksum.
+func adoptGolangMigrate(ctx context.Context, conn *pgx.Conn) error {
+	var adopted bool
+	err := conn.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM schema_versions)`).Scan(&adopted)
+	if err != nil || adopted {
+		return err
+	}
+
+	var hasLegacy bool
+	err = conn.QueryRow(ctx, `SELECT to_regclass('schema_migrations') IS NOT NULL`).Scan(&hasLegacy)
+	if err != nil || !hasLegacy {
+		return err
+	}
+
+	var version int64
+	var dirty bool
+	err = conn.QueryRow(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&version, &dirty)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	if dirty {
+		return fmt.Errorf("schema_migrations is dirty at version %d; fix the database by hand first", version)
+	}
+
+	_, err = conn.Exec(ctx, `
+		INSERT INTO schema_versions (version, name)
+		SELECT v, 'adopted from schema_migrations' FROM generate_series(1, $1::bigint) AS v
+	`, version)
+	return err
+}
+
+type appliedVersion struct {
+	name      string
+	checksum  string
+	appliedAt time.Time
+}
+
+func appliedVersions(ctx context.Context, conn *pgx.Conn) (map[int64]appliedVersion, error) {
+	rows, err := conn.Query(ctx, `SELECT version, name, checksum, applied_at FROM schema_versions`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema_versions: %w", err)
+	}
+	defer rows.Close()
+
+	versions := map[int64]appliedVersion{}
+	for rows.Next() {
+		var version int64
+		var a appliedVersion
+		if err := rows.Scan(&version, &a.name, &a.checksum, &a.appliedAt); err != nil {
+			return nil, err
+		}
+		versions[version] = a
+	}
+	return versions, rows.Err()
+}
+
+// Seed runs every .sql file of fsys in name order. Seeds are not versioned, so
+// they must be safe to run again (insert ... on conflict do nothing).
+func (r *Runner) Seed(ctx context.Context, fsys fs.FS) ([]string, error) {
+	names, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+
+	err = r.withLock(ctx, func(conn *pgx.Conn) error {
+		for _, name := range names {
+			data, err := fs.ReadFile(fsys, name)
+			if err != nil {
+				return err
+			}
+			err = pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+				_, err := tx.Exec(ctx, string(data))
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("failed to seed %s: %w", path.Base(name), err)
+			}
+			r.logger.Info("Migrations", "seeded "+name)
+		}
+		return nil
+	})
+	return names, err
+}
+
+// OnStart applies the embedded migrations when database.migrate_on_start is set.
+func OnStart(ctx context.Context, pool *pgxpool.Pool, cfg models.DatabaseConfig, logger *util.Logger) error {
+	if !cfg.MigrateOnStart {
+		return nil
+	}
+
+	runner, err := New(pool, migrations.FS, logger)
+	if err != nil {
+		return err
+	}
+	applied, err := runner.Up(ctx)
+	if err != nil {
+		return err
+	}
+	if len(applied) == 0 {
+		logger.Info("Migrations", "schema is up to date")
+	}
+	return nil
+}
@@ -1,40 +1,198 @@
 package models
 
+import (
+	"strconv"
+	"time"
+)
+
 type DatabaseConfig struct {
-	Host     string
-	Port     string
-	User     string
-	Password string
-	Database string
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+	Database string `yaml:"database"`
+	MaxConns int32  `yaml:"max_conns"`
+	// MigrateOnStart applies pending migrations before the service starts.
+	MigrateOnStart bool `yaml:"migrate_on_start"`
 }
 
 type RabbitMQConfig struct {
-	Host     string
-	Port     string
-	User     string
-	Password string
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+}
+
+// MailConfig selects how emails are sent: "smtp", "file" (one .eml file per
+// message in Dir) or "console" (written to the log). The last two are for
+// local development.
+type MailConfig struct {
+	Driver string     `yaml:"driver"`
+	From   string     `yaml:"from"`
+	Dir    string     `yaml:"dir"`
+	SMTP   SMTPConfig `yaml:"smtp"`
+}
+
+// SMTPConfig is the relay used by the smtp mail driver. StartTLS is required
+// whenever Username is set, so credentials never travel in the clear.
+type SMTPConfig struct {
+	Host     string        `yaml:"host"`
+	Port     int           `yaml:"port"`
+	Username string        `yaml:"username"`
+	Password string        `yaml:"password"`
+	StartTLS bool          `yaml:"starttls"`
+	Timeout  time.Duration `yaml:"timeout"`
+}
+
+// SMSConfig selects how text messages are sent. Only "fake", which logs
+// them, exists so far.
+type SMSConfig struct {
+	Driver string `yaml:"driver"`
 }
 
 type WebSocketConfig struct {
-	Port string
+	Port int `yaml:"port"`
+}
+
+// HTTPConfig is the listener of one service.
+type HTTPConfig struct {
+	Port         int           `yaml:"port"`
+	ReadTimeout  time.Duration `yaml:"read_timeout"`
+	WriteTimeout time.Duration `yaml:"write_timeout"`
+	IdleTimeout  time.Duration `yaml:"idle_timeout"`
+}
+
+// Addr is the listen address, e.g. ":3000".
+func (c HTTPConfig) Addr() string {
+	return ":" + strconv.Itoa(c.Port)
+}
+
+// Tariff is the fare of one ride type. Fares are in tenge.
+type Tariff struct {
+	RideType  string  `yaml:"ride_type"`
+	BaseFare  float64 `yaml:"base_fare"`
+	PerKm     float64 `yaml:"per_km"`
+	PerMinute float64 `yaml:"per_minute"`
+}
+
+// WaitTariff bills the time a driver waits at the pickup point. The first
+// FreePeriod is free, every started minute after it costs PerMinute. From
+// NoShowAfter on the driver may cancel and is paid NoShowFee. Fees are in tenge.
+type WaitTariff struct {
+	RideType    string        `yaml:"ride_type"`
+	FreePeriod  time.Duration `yaml:"free_period"`
+	PerMinute   float64       `yaml:"per_minute"`
+	NoShowAfter time.Duration `yaml:"no_show_after"`
+	NoShowFee   float64       `yaml:"no_show_fee"`
+}
+
+type RideServiceConfig struct {
+	HTTPConfig   `yaml:",inline"`
+	MatchTimeout time.Duration `yaml:"match_timeout"`
+	Tariffs      []Tariff      `yaml:"tariffs"`
+}
+
+type DriverServiceConfig struct {
+	HTTPConfig `yaml:",inline"`
+}
+
+// LoginLimitsConfig throttles failed logins, per account and per client IP.
+// Each failure delays the next attempt by BackoffBase, doubled per failure;
+// from MaxFailures on the key is locked for LockoutDuration, doubled per
+// further failure up to MaxLockout. Failures older than FailureWindow are
+// forgotten.
+type LoginLimitsConfig struct {
+	AccountMaxFailures int           `yaml:"account_max_failures"`
+	IPMaxFailures      int           `yaml:"ip_max_failures"`
+	BackoffBase        time.Duration `yaml:"backoff_base"`
+	LockoutDuration    time.Duration `yaml:"lockout_duration"`
+	MaxLockout         time.Duration `yaml:"max_lockout"`
+	FailureWindow      time.Duration `yaml:"failure_window"`
+}
+
+// OTPConfig governs phone codes. A code works once, for TTL and for
+// MaxAttempts wrong guesses. A new code can be requested after ResendInterval,
+// at most MaxPerHour times an hour per phone and MaxPerIPPerHour times an hour
+// per client address.
+type OTPConfig struct {
+	CodeLength      int           `yaml:"code_length"`
+	TTL             time.Duration `yaml:"ttl"`
+	MaxAttempts     int           `yaml:"max_attempts"`
+	ResendInterval  time.Duration `yaml:"resend_interval"`
+	MaxPerHour      int           `yaml:"max_per_hour"`
+	MaxPerIPPerHour int           `yaml:"max_per_ip_per_hour"`
+}
+
+// AuthServiceConfig also covers the emailed tokens: links in emails point
+// into PublicURL, and verification and reset tokens expire after their TTLs.
+type AuthServiceConfig struct {
+	HTTPConfig     `yaml:",inline"`
+	LoginLimits    LoginLimitsConfig `yaml:"login_limits"`
+	PublicURL      string            `yaml:"public_url"`
+	VerifyTokenTTL time.Duration     `yaml:"verify_token_ttl"`
+	ResetTokenTTL  time.Duration     `yaml:"reset_token_ttl"`
+	OTP            OTPConfig         `yaml:"otp"`
 }
 
 type ServicesConfig struct {
-	RideService           string
-	DriverLocationService string
-	AdminService          string
+	RideService           RideServiceConfig   `yaml:"ride_service"`
+	DriverLocationService DriverServiceConfig `yaml:"driver_location_service"`
+	AuthService           AuthServiceConfig   `yaml:"auth_service"`
+	AdminService          HTTPConfig          `yaml:"admin_service"`
+}
+
+// JWTKey is one signing key. Only auth-service reads PrivateKeyFile; the other
+// services verify with PublicKeyFile or with the keys published at JWKSURL.
+type JWTKey struct {
+	ID             string `yaml:"id"`
+	Algorithm      string `yaml:"algorithm"`
+	PrivateKeyFile string `yaml:"private_key_file"`
+	PublicKeyFile  string `yaml:"public_key_file"`
+}
+
+// JWTConfig configures issuing and verifying access tokens. Tokens are signed
+// with the key SigningKeyID; the other keys stay valid for verification, which
+// is how keys are rotated. RefreshTokenTTL is how long a login lasts without
+// being used.
+type JWTConfig struct {
+	Issuer          string        `yaml:"issuer"`
+	Audience        string        `yaml:"audience"`
+	AccessTokenTTL  time.Duration `yaml:"access_token_ttl"`
+	RefreshTokenTTL time.Duration `yaml:"refresh_token_ttl"`
+	SigningKeyID    string        `yaml:"signing_key_id"`
+	Keys            []JWTKey      `yaml:"keys"`
+	JWKSURL         string        `yaml:"jwks_url"`
+	JWKSRefresh     time.Duration `yaml:"jwks_refresh"`
+}
+
+// ShutdownConfig bounds the graceful shutdown. DrainDelay is the part of
+// Timeout during which /readyz already fails but requests are still served.
+type ShutdownConfig struct {
+	Timeout    time.Duration `yaml:"timeout"`
+	DrainDelay time.Duration `yaml:"drain_delay"`
 }
 
+// Config is the whole of config.yaml. DevMode allows settings that are only
+// safe on a developer machine, such as dev- signing keys.
 type Config struct {
-	Database  DatabaseConfig
-	RabbitMQ  RabbitMQConfig
-	WebSocket WebSocketConfig
-	Services  ServicesConfig
+	DevMode   bool            `yaml:"dev_mode"`
+	Database  DatabaseConfig  `yaml:"database"`
+	RabbitMQ  RabbitMQConfig  `yaml:"rabbitmq"`
+	Mail      MailConfig      `yaml:"mail"`
+	SMS       SMSConfig       `yaml:"sms"`
+	WebSocket WebSocketConfig `yaml:"websocket"`
+	// WaitTariffs are shared by ride-service, which shows the wait to the
+	// passenger, and driver-service, which bills it.
+	WaitTariffs []WaitTariff   `yaml:"wait_tariffs"`
+	Services    ServicesConfig `yaml:"services"`
+	JWT         JWTConfig      `yaml:"jwt"`
+	Shutdown    ShutdownConfig `yaml:"shutdown"`
 }
 
 type User struct {
 	ID           string
 	Email        string
+	Phone        string
 	Role         string
 	Status       string
 	PasswordHash string
@@ -1,8 +0,0 @@
-package models
-
-import "github.com/golang-jwt/jwt/v5"
-
-type Claims struct {
-	Role string `json:"role"`
-	jwt.RegisteredClaims
-}
@@ -0,0 +1,12 @@
+package models
+
+// OutboxMessage is an event waiting in the outbox table to be published.
+// EventID is sent as the AMQP message id so consumers can drop duplicates, and
+// CorrelationID as the AMQP correlation id.
+type OutboxMessage struct {
+	EventID       string
+	CorrelationID string
+	Exchange      string
+	RoutingKey    string
+	Payload       []byte
+}
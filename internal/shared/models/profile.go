@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// UserProfile is what users see and edit about themselves. Name, locale,
+// avatar and emergency contact are kept in users.attrs.
+type UserProfile struct {
+	UserID           string            `json:"user_id"`
+	Email            string            `json:"email"`
+	EmailVerified    bool              `json:"email_verified"`
+	Phone            string            `json:"phone,omitempty"`
+	PhoneVerified    bool              `json:"phone_verified"`
+	PendingPhone     string            `json:"pending_phone,omitempty"`
+	Role             string            `json:"role"`
+	Status           string            `json:"status"`
+	Name             string            `json:"name,omitempty"`
+	Locale           string            `json:"locale,omitempty"`
+	AvatarURL        string            `json:"avatar_url,omitempty"`
+	EmergencyContact *EmergencyContact `json:"emergency_contact,omitempty"`
+	CreatedAt        time.Time         `json:"created_at"`
+}
+
+type EmergencyContact struct {
+	Name  string `json:"name"`
+	Phone string `json:"phone"`
+}
+
+// ProfileUpdate is a validated change to a profile: Set and Unset are applied
+// to users.attrs. Phone, when not nil, becomes the pending number, which
+// replaces the phone number once verified; "" removes both.
+type ProfileUpdate struct {
+	Set   map[string]interface{}
+	Unset []string
+	Phone *string
+}
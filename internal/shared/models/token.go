@@ -0,0 +1,65 @@
+package models
+
+import "time"
+
+// RefreshToken is one token of a login's family. A token is spent once
+// UsedAt is set; ReplacedBy then points at its successor.
+type RefreshToken struct {
+	ID         string
+	UserID     string
+	FamilyID   string
+	Device     string
+	CreatedAt  time.Time
+	ExpiresAt  time.Time
+	UsedAt     *time.Time
+	ReplacedBy *string
+	RevokedAt  *time.Time
+}
+
+const (
+	LoginKeyAccount = "account"
+	LoginKeyIP      = "ip"
+)
+
+// LoginKey is what failed logins are counted by: an account (the lowercased
+// email, or the phone number for code logins) or a client IP.
+type LoginKey struct {
+	Kind    string
+	Subject string
+}
+
+// LoginLockout is one entry of the lockout audit trail.
+type LoginLockout struct {
+	ID          int64      `json:"id"`
+	Kind        string     `json:"kind"`
+	Subject     string     `json:"subject"`
+	Failures    int        `json:"failures"`
+	LockedAt    time.Time  `json:"locked_at"`
+	LockedUntil time.Time  `json:"locked_until"`
+	ClearedAt   *time.Time `json:"cleared_at,omitempty"`
+	ClearedBy   string     `json:"cleared_by,omitempty"`
+}
+
+const (
+	TokenPurposeVerifyEmail   = "verify_email"
+	TokenPurposeResetPassword = "reset_password"
+)
+
+// EmailToken is a single-use token sent to the user's email address.
+type EmailToken struct {
+	ID        string
+	UserID    string
+	Purpose   string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+// PhoneOTP is a one-time code sent by text message, to log in or to verify
+// a number. RequestedIP is the client that asked for it.
+type PhoneOTP struct {
+	ID          string
+	Phone       string
+	RequestedIP string
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
+}
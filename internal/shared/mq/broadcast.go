@@ -0,0 +1,89 @@
+package mq
+
+import (
+	"context"
+	"ride-hail/internal/shared/util"
+	"time"
+
+	"github.com/rabbitmq/amqp091-go"
+)
+
+// BroadcastFunc handles one message of a Subscribe subscription. There are no
+// retries: a message that cannot be handled is logged by the caller and dropped.
+type BroadcastFunc func(ctx context.Context, msg amqp091.Delivery)
+
+// Subscribe delivers every message published to the fanout exchange to handle.
+// Each subscriber gets its own exclusive, auto-deleted queue, so every replica
+// sees every message. Messages published while the subscriber is disconnected
+// are lost; onStart runs every time the subscription is (re)established, after
+// it is bound, so callers can resynchronise from the database there.
+func (c *Connection) Subscribe(ctx context.Context, exchange string, onStart func(ctx context.Context), handle BroadcastFunc) *Consumer {
+	cs := &Consumer{queue: exchange, done: make(chan struct{}), stop: make(chan struct{})}
+	logger := util.New().With("exchange", exchange)
+
+	go func() {
+		defer close(cs.done)
+		for {
+			if err := c.subscribeOnce(ctx, cs, onStart, handle); err != nil {
+				logger.Warn("Subscriber", "subscription stopped: "+err.Error())
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-cs.stop:
+				return
+			case <-c.done:
+				return
+			case <-time.After(time.Second):
+				logger.Info("Subscriber", "resubscribing")
+			}
+		}
+	}()
+
+	return cs
+}
+
+func (c *Connection) subscribeOnce(ctx context.Context, cs *Consumer, onStart func(ctx context.Context), handle BroadcastFunc) error {
+	exchange := cs.queue
+
+	ch, err := c.Channel()
+	if err != nil {
+		return err
+	}
+	defer ch.Close()
+
+	q, err := ch.QueueDeclare("", false, true, true, false, nil)
+	if err != nil {
+		return err
+	}
+	if err := ch.QueueBind(q.Name, "", exchange, false, nil); err != nil {
+		return err
+	}
+	msgs, err := ch.Consume(q.Name, "", true, true, false, false, nil)
+	if err != nil {
+		return err
+	}
+
+	cs.running.Store(true)
+	defer cs.running.Store(false)
+
+	if onStart != nil {
+		onStart(ctx)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-cs.stop:
+			return nil
+		case msg, ok := <-msgs:
+			if !ok {
+				return amqp091.ErrClosed
+			}
+			consumed.Inc(exchange, "ack")
+			handle(ContextFromDelivery(ctx, msg), msg)
+		}
+	}
+}
@@ -0,0 +1,277 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"ride-hail/internal/shared/util"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	headerRetryCount       = "x-retry-count"
+	headerError            = "x-last-error"
+	headerOriginalQueue    = "x-original-queue"
+	headerOriginalKey      = "x-original-routing-key"
+	headerDeadLetteredAt   = "x-dead-lettered-at"
+	headerOriginalExchange = "x-original-exchange"
+)
+
+// HandlerFunc processes one delivery. The request id of the message is available
+// through util.RequestID(ctx). Returning nil acks it. Any other error is
+// retried after a delay, unless it is wrapped with Permanent or the retries are
+// used up, in which case the message goes to the queue's dead-letter queue.
+type HandlerFunc func(ctx context.Context, msg amqp091.Delivery) error
+
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent marks an error that will not go away on retry, such as a malformed payload.
+func Permanent(err error) error {
+	return permanentError{err: err}
+}
+
+type ConsumerOptions struct {
+	Prefetch    int
+	RetryDelays []time.Duration
+}
+
+var DefaultConsumerOptions = ConsumerOptions{
+	Prefetch:    10,
+	RetryDelays: []time.Duration{time.Second, 5 * time.Second, 30 * time.Second},
+}
+
+// RetryQueue is the queue that holds messages of queue for delay before they
+// flow back. There is one per delay, with a queue-level TTL, so a message with
+// a short delay never waits behind one with a long delay.
+func RetryQueue(queue string, delay time.Duration) string {
+	return queue + ".retry." + delay.String()
+}
+
+func DeadLetterQueue(queue string) string { return queue + ".dlq" }
+
+// declareRetryQueues declares the retry queues of queue for the given delays.
+func declareRetryQueues(ch *amqp091.Channel, queue string, delays []time.Duration) error {
+	for _, delay := range delays {
+		args := amqp091.Table{
+			"x-dead-letter-exchange":    "",
+			"x-dead-letter-routing-key": queue,
+			"x-message-ttl":             delay.Milliseconds(),
+		}
+		if _, err := ch.QueueDeclare(RetryQueue(queue, delay), true, false, false, false, args); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Consumer is a subscription started by Connection.Consume.
+type Consumer struct {
+	queue   string
+	running atomic.Bool
+	done    chan struct{}
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// Check returns an error unless the consumer is currently subscribed to its
+// queue. It is meant for readiness checks.
+func (cs *Consumer) Check(ctx context.Context) error {
+	select {
+	case <-cs.done:
+		return fmt.Errorf("consumer for %s has exited", cs.queue)
+	default:
+	}
+	if !cs.running.Load() {
+		return fmt.Errorf("consumer for %s is not subscribed", cs.queue)
+	}
+	return nil
+}
+
+// Done is closed once the consumer goroutine has exited.
+func (cs *Consumer) Done() <-chan struct{} {
+	return cs.done
+}
+
+// Stop cancels the subscription so the broker sends no new deliveries, lets
+// the message being handled finish and waits for the consumer to exit.
+// Prefetched messages that were not handled yet go back to the queue.
+func (cs *Consumer) Stop(ctx context.Context) error {
+	cs.stopOnce.Do(func() { close(cs.stop) })
+
+	select {
+	case <-cs.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("consumer for %s did not stop in time: %w", cs.queue, ctx.Err())
+	}
+}
+
+// Consume subscribes handle to the queue with manual acks until ctx is
+// cancelled or the consumer is stopped. The subscription is re-established on
+// a fresh channel whenever the channel or the connection is lost.
+func (c *Connection) Consume(ctx context.Context, queue string, opts ConsumerOptions, handle HandlerFunc) *Consumer {
+	cs := &Consumer{queue: queue, done: make(chan struct{}), stop: make(chan struct{})}
+	logger := util.New().With("queue", queue)
+
+	go func() {
+		defer close(cs.done)
+		for {
+			if err := c.consumeOnce(ctx, cs, opts, handle); err != nil {
+				logger.Warn("Consumer", "consumer stopped: "+err.Error())
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-cs.stop:
+				return
+			case <-c.done:
+				return
+			case <-time.After(time.Second):
+				logger.Info("Consumer", "restarting consumer")
+			}
+		}
+	}()
+
+	return cs
+}
+
+func (c *Connection) consumeOnce(ctx context.Context, cs *Consumer, opts ConsumerOptions, handle HandlerFunc) error {
+	queue := cs.queue
+
+	ch, err := c.Channel()
+	if err != nil {
+		return err
+	}
+	defer ch.Close()
+
+	// the topology only covers the default delays
+	if err := declareRetryQueues(ch, queue, opts.RetryDelays); err != nil {
+		return err
+	}
+
+	if opts.Prefetch > 0 {
+		if err := ch.Qos(opts.Prefetch, 0, false); err != nil {
+			return err
+		}
+	}
+
+	tag := queue + "-" + util.GenerateUUID()
+	msgs, err := ch.Consume(queue, tag, false, false, false, false, nil)
+	if err != nil {
+		return err
+	}
+
+	cs.running.Store(true)
+	defer cs.running.Store(false)
+
+	finished := make(chan struct{})
+	defer close(finished)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-cs.stop:
+		case <-finished:
+			return
+		}
+		// stop new deliveries; the range below ends once the broker confirms
+		_ = ch.Cancel(tag, false)
+	}()
+
+	// handlers finish their message even when ctx is cancelled underneath them
+	handleCtx := context.WithoutCancel(ctx)
+	for msg := range msgs {
+		c.dispatch(handleCtx, queue, opts, handle, msg)
+	}
+	return nil
+}
+
+func (c *Connection) dispatch(ctx context.Context, queue string, opts ConsumerOptions, handle HandlerFunc, msg amqp091.Delivery) {
+	ctx = ContextFromDelivery(ctx, msg)
+	logger := util.New().WithContext(ctx).With("queue", queue, "message_id", msg.MessageId)
+
+	err := handle(ctx, msg)
+	if err == nil {
+		if err := msg.Ack(false); err != nil {
+			logger.Error("Consumer", fmt.Errorf("ack failed: %w", err))
+		}
+		consumed.Inc(queue, "ack")
+		return
+	}
+	consumeFailures.Inc(queue)
+
+	retries := retryCount(msg)
+
+	outcome := "retry"
+	var perm permanentError
+	if errors.As(err, &perm) || retries >= len(opts.RetryDelays) {
+		outcome = "dead_letter"
+		logger.Error("Consumer", fmt.Errorf("dead-lettering message after %d retries: %w", retries, err))
+		err = c.forward(ctx, DeadLetterQueue(queue), queue, msg, retries, err)
+	} else {
+		delay := opts.RetryDelays[retries]
+		logger.Warn("Consumer", fmt.Sprintf("retrying message in %s (attempt %d/%d): %v", delay, retries+1, len(opts.RetryDelays), err))
+		err = c.forward(ctx, RetryQueue(queue, delay), queue, msg, retries+1, err)
+	}
+
+	if err != nil {
+		// could not park the message anywhere, let the broker redeliver it
+		logger.Error("Consumer", fmt.Errorf("failed to forward message, requeueing: %w", err))
+		_ = msg.Nack(false, true)
+		consumed.Inc(queue, "requeue")
+		return
+	}
+	_ = msg.Ack(false)
+	consumed.Inc(queue, outcome)
+}
+
+// forward republishes msg to target through the default exchange, keeping its
+// body and properties and recording where it came from.
+func (c *Connection) forward(ctx context.Context, target, queue string, msg amqp091.Delivery, retries int, cause error) error {
+	headers := amqp091.Table{}
+	for k, v := range msg.Headers {
+		headers[k] = v
+	}
+	headers[headerRetryCount] = int32(retries)
+	headers[headerError] = cause.Error()
+	headers[headerOriginalQueue] = queue
+	if _, ok := headers[headerOriginalKey]; !ok {
+		headers[headerOriginalKey] = msg.RoutingKey
+		headers[headerOriginalExchange] = msg.Exchange
+	}
+	if target == DeadLetterQueue(queue) {
+		headers[headerDeadLetteredAt] = time.Now().UTC().Format(time.RFC3339)
+	}
+
+	pub := amqp091.Publishing{
+		Headers:       headers,
+		ContentType:   msg.ContentType,
+		DeliveryMode:  amqp091.Persistent,
+		CorrelationId: msg.CorrelationId,
+		MessageId:     msg.MessageId,
+		Timestamp:     msg.Timestamp,
+		Type:          msg.Type,
+		Body:          msg.Body,
+	}
+	return c.PublishConfirmed(ctx, "", target, pub)
+}
+
+func retryCount(msg amqp091.Delivery) int {
+	switch v := msg.Headers[headerRetryCount].(type) {
+	case int32:
+		return int(v)
+	case int64:
+		return int(v)
+	case int:
+		return v
+	}
+	return 0
+}
@@ -0,0 +1,104 @@
+package mq
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rabbitmq/amqp091-go"
+)
+
+type DeadLetter struct {
+	MessageID      string `json:"message_id"`
+	RoutingKey     string `json:"original_routing_key"`
+	Retries        int    `json:"retries"`
+	Error          string `json:"error"`
+	DeadLetteredAt string `json:"dead_lettered_at"`
+	Body           string `json:"body"`
+}
+
+// InspectDeadLetters returns up to limit messages from the queue's dead-letter
+// queue without removing them.
+func (c *Connection) InspectDeadLetters(queue string, limit int) ([]DeadLetter, error) {
+	ch, err := c.Channel()
+	if err != nil {
+		return nil, err
+	}
+	// closing the channel returns every unacked message to the queue
+	defer ch.Close()
+
+	var letters []DeadLetter
+	for len(letters) < limit {
+		msg, ok, err := ch.Get(DeadLetterQueue(queue), false)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+
+		letter := DeadLetter{
+			MessageID: msg.MessageId,
+			Retries:   retryCount(msg),
+			Body:      string(msg.Body),
+		}
+		letter.RoutingKey, _ = msg.Headers[headerOriginalKey].(string)
+		letter.Error, _ = msg.Headers[headerError].(string)
+		letter.DeadLetteredAt, _ = msg.Headers[headerDeadLetteredAt].(string)
+		letters = append(letters, letter)
+	}
+
+	return letters, nil
+}
+
+// ReplayDeadLetters moves up to limit messages from the dead-letter queue back
+// to the queue with a fresh retry budget. It returns how many were replayed.
+func (c *Connection) ReplayDeadLetters(ctx context.Context, queue string, limit int) (int, error) {
+	ch, err := c.Channel()
+	if err != nil {
+		return 0, err
+	}
+	defer ch.Close()
+
+	replayed := 0
+	for replayed < limit {
+		msg, ok, err := ch.Get(DeadLetterQueue(queue), false)
+		if err != nil {
+			return replayed, err
+		}
+		if !ok {
+			break
+		}
+
+		headers := amqp091.Table{}
+		for k, v := range msg.Headers {
+			headers[k] = v
+		}
+		delete(headers, headerRetryCount)
+		delete(headers, headerError)
+		delete(headers, headerDeadLetteredAt)
+		headers["x-replayed-at"] = time.Now().UTC().Format(time.RFC3339)
+
+		err = c.PublishConfirmed(ctx, "", queue, amqp091.Publishing{
+			Headers:       headers,
+			ContentType:   msg.ContentType,
+			DeliveryMode:  amqp091.Persistent,
+			CorrelationId: msg.CorrelationId,
+			MessageId:     msg.MessageId,
+			Timestamp:     msg.Timestamp,
+			Type:          msg.Type,
+			Body:          msg.Body,
+		})
+		if err != nil {
+			_ = msg.Nack(false, true)
+			return replayed, fmt.Errorf("failed to replay message %s: %w", msg.MessageId, err)
+		}
+
+		if err := msg.Ack(false); err != nil {
+			return replayed, err
+		}
+		replayed++
+	}
+
+	return replayed, nil
+}
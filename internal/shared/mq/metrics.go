@@ -0,0 +1,24 @@
+package mq
+
+import "ride-hail/internal/shared/metrics"
+
+var (
+	published = metrics.NewCounterVec("rabbitmq_published_total",
+		"Messages confirmed by the broker, by exchange.", "exchange")
+	publishFailures = metrics.NewCounterVec("rabbitmq_publish_failures_total",
+		"Publishes that failed or were nacked, by exchange.", "exchange")
+	publishBuffer = metrics.NewGaugeVec("rabbitmq_publish_buffer_size",
+		"Messages waiting in the outage buffer.")
+
+	consumed = metrics.NewCounterVec("rabbitmq_consumed_total",
+		"Deliveries processed, by queue and outcome (ack, retry, dead_letter, requeue).", "queue", "outcome")
+	consumeFailures = metrics.NewCounterVec("rabbitmq_consume_failures_total",
+		"Deliveries whose handler returned an error, by queue.", "queue")
+)
+
+func exchangeLabel(exchange string) string {
+	if exchange == "" {
+		return "(default)"
+	}
+	return exchange
+}
@@ -0,0 +1,194 @@
+package mq
+
+import (
+	"context"
+	"fmt"
+	"ride-hail/internal/shared/models"
+	"ride-hail/internal/shared/util"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rabbitmq/amqp091-go"
+)
+
+// outboxLockID is the advisory lock key that makes only one relay publish at a time,
+// which keeps events in order when several replicas are running.
+const outboxLockID = 7_340_001
+
+// InsertOutbox writes the message inside the caller's transaction.
+func InsertOutbox(ctx context.Context, tx pgx.Tx, msg models.OutboxMessage) error {
+	_, err := tx.Exec(ctx, `
+		INSERT INTO outbox (event_id, correlation_id, exchange, routing_key, payload)
+		VALUES ($1, $2, $3, $4, $5)
+	`, msg.EventID, msg.CorrelationID, msg.Exchange, msg.RoutingKey, msg.Payload)
+	if err != nil {
+		return fmt.Errorf("failed to insert outbox message: %w", err)
+	}
+	return nil
+}
+
+type OutboxRelay struct {
+	db        *pgxpool.Pool
+	conn      *Connection
+	interval  time.Duration
+	batchSize int
+	retention time.Duration
+}
+
+func NewOutboxRelay(db *pgxpool.Pool, conn *Connection) *OutboxRelay {
+	return &OutboxRelay{
+		db:        db,
+		conn:      conn,
+		interval:  500 * time.Millisecond,
+		batchSize: 100,
+		retention: 7 * 24 * time.Hour,
+	}
+}
+
+// Run publishes pending outbox rows until ctx is cancelled. Delivery is
+// at-least-once: a row is marked sent only after the broker confirms it.
+func (r *OutboxRelay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	cleaner := time.NewTicker(time.Hour)
+	defer cleaner.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-cleaner.C:
+			if _, err := r.db.Exec(ctx, `DELETE FROM outbox WHERE published_at < $1`, time.Now().Add(-r.retention)); err != nil {
+				util.New().Error("OutboxRelay", fmt.Errorf("failed to clean published messages: %w", err))
+			}
+		case <-ticker.C:
+			for {
+				n, err := r.relayBatch(ctx)
+				if err != nil {
+					util.New().Error("OutboxRelay", err)
+					break
+				}
+				if n < r.batchSize {
+					break
+				}
+			}
+		}
+	}
+}
+
+// relayBatch claims the next batch in a short transaction and publishes it
+// after the commit, so no transaction stays open while the broker confirms.
+// The batch runs under a session advisory lock on one pooled connection, which
+// keeps the relay of other replicas from publishing in between.
+func (r *OutboxRelay) relayBatch(ctx context.Context) (int, error) {
+	conn, err := r.db.Acquire(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Release()
+
+	var locked bool
+	if err := conn.QueryRow(ctx, `SELECT pg_try_advisory_lock($1)`, outboxLockID).Scan(&locked); err != nil {
+		return 0, err
+	}
+	if !locked {
+		return 0, nil
+	}
+	defer func() {
+		if _, err := conn.Exec(context.WithoutCancel(ctx), `SELECT pg_advisory_unlock($1)`, outboxLockID); err != nil {
+			// closing the session is the only other way to drop the lock
+			_ = conn.Hijack().Close(context.WithoutCancel(ctx))
+		}
+	}()
+
+	batch, err := r.claim(ctx, conn)
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, p := range batch {
+		if err := r.publish(ctx, p.msg); err != nil {
+			// stop at the first failure so later events are not published ahead of it
+			if _, uerr := conn.Exec(ctx, `UPDATE outbox SET last_error = $1 WHERE id = $2`, err.Error(), p.id); uerr != nil {
+				return sent, uerr
+			}
+			return sent, fmt.Errorf("failed to publish event %s: %w", p.msg.EventID, err)
+		}
+
+		if _, err := conn.Exec(ctx, `UPDATE outbox SET published_at = NOW() WHERE id = $1`, p.id); err != nil {
+			return sent, err
+		}
+		sent++
+	}
+
+	return sent, nil
+}
+
+type pendingMessage struct {
+	id  int64
+	msg models.OutboxMessage
+}
+
+// claim picks the oldest unpublished rows and counts the attempt. Rows are
+// ordered by the transaction that wrote them, and only rows written before the
+// oldest transaction still running are taken: a row with a lower id can commit
+// later, but no row can still appear ahead of the ones returned.
+func (r *OutboxRelay) claim(ctx context.Context, conn *pgxpool.Conn) ([]pendingMessage, error) {
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `
+		WITH claimed AS (
+			UPDATE outbox SET attempts = attempts + 1
+			WHERE id IN (
+				SELECT id FROM outbox
+				WHERE published_at IS NULL
+				  AND txid < pg_snapshot_xmin(pg_current_snapshot())
+				ORDER BY txid, id
+				LIMIT $1
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING id, txid, event_id, correlation_id, exchange, routing_key, payload
+		)
+		SELECT id, event_id, correlation_id, exchange, routing_key, payload
+		FROM claimed
+		ORDER BY txid, id
+	`, r.batchSize)
+	if err != nil {
+		return nil, err
+	}
+
+	var batch []pendingMessage
+	for rows.Next() {
+		var p pendingMessage
+		if err := rows.Scan(&p.id, &p.msg.EventID, &p.msg.CorrelationID, &p.msg.Exchange, &p.msg.RoutingKey, &p.msg.Payload); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		batch = append(batch, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return batch, tx.Commit(ctx)
+}
+
+func (r *OutboxRelay) publish(ctx context.Context, msg models.OutboxMessage) error {
+	return r.conn.PublishConfirmed(ctx, msg.Exchange, msg.RoutingKey, amqp091.Publishing{
+		Headers:       correlationHeaders(msg.CorrelationID),
+		ContentType:   "application/json",
+		Body:          msg.Payload,
+		DeliveryMode:  amqp091.Persistent,
+		MessageId:     msg.EventID,
+		CorrelationId: msg.CorrelationID,
+		Timestamp:     time.Now(),
+	})
+}
@@ -2,79 +2,350 @@ package mq
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
-	"ride-hail/internal/ride/domain"
+	"net/url"
 	"ride-hail/internal/shared/models"
+	"ride-hail/internal/shared/util"
+	"sync"
 	"time"
 
 	"github.com/rabbitmq/amqp091-go"
 )
 
-type Publisher struct {
-	ch *amqp091.Channel
+var (
+	ErrNotConnected = errors.New("rabbitmq: not connected")
+	ErrNacked       = errors.New("rabbitmq: broker did not confirm the message")
+	ErrBuffered     = errors.New("rabbitmq: broker unavailable, message buffered")
+	ErrBufferFull   = errors.New("rabbitmq: broker unavailable and outage buffer is full")
+)
+
+const (
+	maxBackoff     = 30 * time.Second
+	outageBufLimit = 1000
+	confirmTimeout = 5 * time.Second
+)
+
+type bufferedMessage struct {
+	exchange   string
+	routingKey string
+	msg        amqp091.Publishing
 }
 
-func NewPublisher(ch *amqp091.Channel) *Publisher {
-	return &Publisher{ch: ch}
+// Connection keeps a RabbitMQ connection alive. It reconnects with backoff when
+// the broker goes away, re-declares the topology, reopens the publish channel in
+// confirm mode and lets registered consumers resubscribe.
+type Connection struct {
+	url string
+
+	mu    sync.Mutex
+	conn  *amqp091.Connection
+	pubCh *amqp091.Channel
+
+	bufMu  sync.Mutex
+	buffer []bufferedMessage
+	// flushed is closed once the buffer has been flushed on the current
+	// connection. Publishes wait for it, so they cannot overtake buffered messages.
+	flushed chan struct{}
+
+	done      chan struct{}
+	closeOnce sync.Once
 }
 
-func ConnectToRMQ(cfg *models.RabbitMQConfig) (*amqp091.Connection, *amqp091.Channel, error) {
-	dsn := fmt.Sprintf("amqp://%s:%s@%s:%s/", cfg.User, cfg.Password, cfg.Host, cfg.Port)
+func Dial(cfg *models.RabbitMQConfig) (*Connection, error) {
+	c := &Connection{
+		url:  fmt.Sprintf("amqp://%s:%s@%s:%d/", url.QueryEscape(cfg.User), url.QueryEscape(cfg.Password), cfg.Host, cfg.Port),
+		done: make(chan struct{}),
+	}
 
-	var conn *amqp091.Connection
-	var ch *amqp091.Channel
 	var err error
-
 	for i := 0; i < 10; i++ {
-		conn, err = amqp091.Dial(dsn)
-		if err == nil {
-			ch, err = conn.Channel()
-			if err == nil {
-				return conn, ch, nil
-			}
+		if err = c.connect(); err == nil {
+			go c.flushBuffer(c.flushed)
+			go c.watch()
+			return c, nil
 		}
-		log.Printf("RabbitMQ not ready, retrying... (%d/10)", i+1)
+		util.New().Warn("RabbitMQ", fmt.Sprintf("not ready, retrying... (%d/10)", i+1))
 		time.Sleep(3 * time.Second)
 	}
 
-	return nil, nil, fmt.Errorf("failed to connect to RabbitMQ: %w", err)
+	return nil, fmt.Errorf("failed to connect to RabbitMQ: %w", err)
 }
 
-func (p *Publisher) Publish(ctx context.Context, exchange, routingKey string, body []byte) error {
-	err := p.ch.PublishWithContext(ctx,
-		exchange,   // exchange
-		routingKey, // routing key
-		false,      // mandatory
-		false,      // immediate
-		amqp091.Publishing{
-			ContentType:  "application/json",
-			Body:         body,
-			DeliveryMode: amqp091.Persistent,
-			Timestamp:    time.Now(),
-		})
+func (c *Connection) connect() error {
+	conn, err := amqp091.Dial(c.url)
 	if err != nil {
-		return fmt.Errorf("failed to publish message: %w", err)
+		return err
+	}
+
+	ch, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer ch.Close()
+
+	if err := DeclareTopology(ch); err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to declare topology: %w", err)
+	}
+
+	c.mu.Lock()
+	c.conn = conn
+	c.pubCh = nil
+	c.flushed = make(chan struct{})
+	c.mu.Unlock()
+
+	return nil
+}
+
+func (c *Connection) watch() {
+	for {
+		c.mu.Lock()
+		conn := c.conn
+		c.mu.Unlock()
+
+		closed := conn.NotifyClose(make(chan *amqp091.Error, 1))
+		select {
+		case <-c.done:
+			return
+		case err := <-closed:
+			util.New().Warn("RabbitMQ", fmt.Sprintf("connection lost: %v", err))
+		}
+
+		backoff := time.Second
+		for {
+			select {
+			case <-c.done:
+				return
+			case <-time.After(backoff):
+			}
+
+			if err := c.connect(); err != nil {
+				util.New().Warn("RabbitMQ", fmt.Sprintf("reconnect failed, next attempt in %s: %v", backoff, err))
+				backoff = min(backoff*2, maxBackoff)
+				continue
+			}
+			util.New().OK("RabbitMQ", "reconnected")
+			break
+		}
+
+		c.mu.Lock()
+		flushed := c.flushed
+		c.mu.Unlock()
+		go c.flushBuffer(flushed)
+	}
+}
+
+// IsConnected reports whether the underlying connection is open.
+func (c *Connection) IsConnected() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.conn != nil && !c.conn.IsClosed()
+}
+
+// Check returns an error unless the connection is open and the publish channel
+// can be used. It is meant for readiness checks.
+func (c *Connection) Check(ctx context.Context) error {
+	if !c.IsConnected() {
+		return ErrNotConnected
+	}
+	if _, err := c.publishChannel(); err != nil {
+		return fmt.Errorf("publish channel unavailable: %w", err)
 	}
 	return nil
 }
 
-func (p *Publisher) PublishRideStatus(event domain.RideStatusEvent) error {
-	body, err := json.Marshal(event)
+// Channel opens a new channel on the current connection.
+func (c *Connection) Channel() (*amqp091.Channel, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn == nil || c.conn.IsClosed() {
+		return nil, ErrNotConnected
+	}
+	return c.conn.Channel()
+}
+
+func (c *Connection) publishChannel() (*amqp091.Channel, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.pubCh != nil && !c.pubCh.IsClosed() {
+		return c.pubCh, nil
+	}
+	if c.conn == nil || c.conn.IsClosed() {
+		return nil, ErrNotConnected
+	}
+
+	ch, err := c.conn.Channel()
+	if err != nil {
+		return nil, err
+	}
+	if err := ch.Confirm(false); err != nil {
+		ch.Close()
+		return nil, fmt.Errorf("failed to enable publisher confirms: %w", err)
+	}
+
+	c.pubCh = ch
+	return ch, nil
+}
+
+// PublishConfirmed publishes the message and waits until the broker acks it.
+// After a reconnect it first waits until the outage buffer has been flushed.
+func (c *Connection) PublishConfirmed(ctx context.Context, exchange, routingKey string, msg amqp091.Publishing) error {
+	c.mu.Lock()
+	flushed := c.flushed
+	c.mu.Unlock()
+
+	select {
+	case <-flushed:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return c.publish(ctx, exchange, routingKey, msg)
+}
+
+func (c *Connection) publish(ctx context.Context, exchange, routingKey string, msg amqp091.Publishing) error {
+	err := c.publishConfirmed(ctx, exchange, routingKey, msg)
 	if err != nil {
+		publishFailures.Inc(exchangeLabel(exchange))
 		return err
 	}
+	published.Inc(exchangeLabel(exchange))
+	return nil
+}
+
+func (c *Connection) publishConfirmed(ctx context.Context, exchange, routingKey string, msg amqp091.Publishing) error {
+	ch, err := c.publishChannel()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, confirmTimeout)
+	defer cancel()
+
+	dc, err := ch.PublishWithDeferredConfirmWithContext(ctx, exchange, routingKey, false, false, msg)
+	if err != nil {
+		return err
+	}
+
+	acked, err := dc.WaitContext(ctx)
+	if err != nil {
+		return err
+	}
+	if !acked {
+		return ErrNacked
+	}
+	return nil
+}
+
+func (c *Connection) bufferMessage(m bufferedMessage) error {
+	c.bufMu.Lock()
+	defer c.bufMu.Unlock()
+
+	if len(c.buffer) >= outageBufLimit {
+		return ErrBufferFull
+	}
+	c.buffer = append(c.buffer, m)
+	publishBuffer.Set(float64(len(c.buffer)))
+	return ErrBuffered
+}
+
+// flushBuffer flushes the buffer after a (re)connect and then lets publishes
+// through by closing flushed.
+func (c *Connection) flushBuffer(flushed chan struct{}) {
+	defer close(flushed)
+	if err := c.Flush(context.Background()); err != nil {
+		util.New().Warn("RabbitMQ", err.Error())
+	}
+}
+
+// Flush publishes the messages kept in the outage buffer. Messages that could
+// not be published stay in the buffer and are reported in the error.
+func (c *Connection) Flush(ctx context.Context) error {
+	c.bufMu.Lock()
+	pending := c.buffer
+	c.buffer = nil
+	publishBuffer.Set(0)
+	c.bufMu.Unlock()
+
+	for i, m := range pending {
+		if err := c.publish(ctx, m.exchange, m.routingKey, m.msg); err != nil {
+			c.bufMu.Lock()
+			c.buffer = append(pending[i:], c.buffer...)
+			publishBuffer.Set(float64(len(c.buffer)))
+			c.bufMu.Unlock()
+			return fmt.Errorf("buffer flush stopped, %d messages left: %w", len(pending)-i, err)
+		}
+	}
 
-	return p.ch.PublishWithContext(
-		context.Background(),
-		"ride_topic",            // exchange
-		"ride.status.cancelled", // routing key
-		false, false,
-		amqp091.Publishing{
-			ContentType:  "application/json",
-			Body:         body,
-			DeliveryMode: amqp091.Persistent,
-		},
-	)
+	if len(pending) > 0 {
+		util.New().Info("RabbitMQ", fmt.Sprintf("buffer flushed, %d messages published", len(pending)))
+	}
+	return nil
+}
+
+func (c *Connection) Close() error {
+	c.closeOnce.Do(func() { close(c.done) })
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn == nil {
+		return nil
+	}
+	return c.conn.Close()
+}
+
+type Publisher struct {
+	conn *Connection
+}
+
+func NewPublisher(conn *Connection) *Publisher {
+	return &Publisher{conn: conn}
+}
+
+// Publish returns once the broker has confirmed the message. While the broker is
+// unreachable the message is kept in a bounded in-memory buffer, published after
+// reconnecting, and ErrBuffered is returned.
+func (p *Publisher) Publish(ctx context.Context, exchange, routingKey string, body []byte) error {
+	requestID := util.RequestID(ctx)
+	msg := amqp091.Publishing{
+		Headers:       correlationHeaders(requestID),
+		ContentType:   "application/json",
+		Body:          body,
+		DeliveryMode:  amqp091.Persistent,
+		CorrelationId: requestID,
+		Timestamp:     time.Now(),
+	}
+
+	err := p.conn.PublishConfirmed(ctx, exchange, routingKey, msg)
+	if err == nil {
+		return nil
+	}
+	if ctx.Err() != nil {
+		return fmt.Errorf("failed to publish message: %w", err)
+	}
+
+	util.New().WithContext(ctx).Warn("RabbitMQ", fmt.Sprintf("publish to %s/%s failed, buffering: %v", exchange, routingKey, err))
+	return p.conn.bufferMessage(bufferedMessage{exchange: exchange, routingKey: routingKey, msg: msg})
+}
+
+const headerRequestID = "x-request-id"
+
+func correlationHeaders(requestID string) amqp091.Table {
+	if requestID == "" {
+		return nil
+	}
+	return amqp091.Table{headerRequestID: requestID}
+}
+
+// ContextFromDelivery restores the request id carried by the message into ctx.
+func ContextFromDelivery(ctx context.Context, msg amqp091.Delivery) context.Context {
+	id := msg.CorrelationId
+	if id == "" {
+		id, _ = msg.Headers[headerRequestID].(string)
+	}
+	return util.WithRequestID(ctx, id)
 }
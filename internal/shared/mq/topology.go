@@ -0,0 +1,83 @@
+package mq
+
+import "github.com/rabbitmq/amqp091-go"
+
+// The topology mirrors rabbitmq/definitions.json. It is declared again on every
+// (re)connect, so a broker that lost its definitions is repaired automatically.
+// Every work queue gets a <queue>.retry.<delay> queue per retry delay of
+// DefaultConsumerOptions, whose expired messages flow back to the work queue,
+// and a <queue>.dlq queue for poison messages.
+
+type exchangeDef struct {
+	name string
+	kind string
+}
+
+type queueDef struct {
+	name string
+	args amqp091.Table
+}
+
+type bindingDef struct {
+	exchange   string
+	queue      string
+	routingKey string
+}
+
+var exchanges = []exchangeDef{
+	{name: "ride_topic", kind: amqp091.ExchangeTopic},
+	{name: "driver_topic", kind: amqp091.ExchangeTopic},
+	{name: "location_fanout", kind: amqp091.ExchangeFanout},
+	// auth_fanout has no durable queues; every replica binds its own, see Subscribe
+	{name: "auth_fanout", kind: amqp091.ExchangeFanout},
+}
+
+var queues = []queueDef{
+	{name: "ride_requests"},
+	{name: "ride_status"},
+	{name: "driver_matching"},
+	{name: "driver_responses"},
+	{name: "driver_status"},
+	{name: "location_updates_ride"},
+	{name: "location_updates_driver"},
+}
+
+var bindings = []bindingDef{
+	{exchange: "ride_topic", queue: "ride_requests", routingKey: "ride.request.*"},
+	{exchange: "ride_topic", queue: "ride_status", routingKey: "ride.status.*"},
+	{exchange: "ride_topic", queue: "driver_matching", routingKey: "ride.request.*"},
+	{exchange: "driver_topic", queue: "driver_responses", routingKey: "driver.response.*"},
+	{exchange: "driver_topic", queue: "driver_status", routingKey: "driver.status.*"},
+	{exchange: "location_fanout", queue: "location_updates_ride"},
+	{exchange: "location_fanout", queue: "location_updates_driver"},
+}
+
+func DeclareTopology(ch *amqp091.Channel) error {
+	for _, e := range exchanges {
+		if err := ch.ExchangeDeclare(e.name, e.kind, true, false, false, false, nil); err != nil {
+			return err
+		}
+	}
+
+	for _, q := range queues {
+		if _, err := ch.QueueDeclare(q.name, true, false, false, false, q.args); err != nil {
+			return err
+		}
+
+		if err := declareRetryQueues(ch, q.name, DefaultConsumerOptions.RetryDelays); err != nil {
+			return err
+		}
+
+		if _, err := ch.QueueDeclare(DeadLetterQueue(q.name), true, false, false, false, nil); err != nil {
+			return err
+		}
+	}
+
+	for _, b := range bindings {
+		if err := ch.QueueBind(b.queue, b.routingKey, b.exchange, false, nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
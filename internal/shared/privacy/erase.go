@@ -0,0 +1,265 @@
+package privacy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"ride-hail/internal/shared/revocation"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Erased replaces erased text.
+const Erased = "[erased]"
+
+// Report counts what Erase changed.
+type Report struct {
+	UserID          string    `json:"user_id"`
+	ErasedAt        time.Time `json:"erased_at"`
+	Sessions        int64     `json:"sessions"`
+	Coordinates     int64     `json:"coordinates"`
+	LocationHistory int64     `json:"location_history"`
+	RideEvents      int64     `json:"ride_events"`
+	OutboxMessages  int64     `json:"outbox_messages"`
+	Rides           int64     `json:"rides"`
+}
+
+// Keys of ride event payloads that hold personal data, at any depth.
+var (
+	erasedKeys     = map[string]bool{"address": true, "pickup_address": true, "destination_address": true}
+	droppedKeys    = map[string]bool{"reason": true, "cancellation_reason": true}
+	coordinateKeys = map[string]bool{"lat": true, "lng": true, "latitude": true, "longitude": true}
+)
+
+// passengerCoordinates selects the pickup and destination points of the
+// user's rides as a passenger.
+const passengerCoordinates = `
+	SELECT pickup_coordinate_id FROM rides WHERE passenger_id = $1 AND pickup_coordinate_id IS NOT NULL
+	UNION
+	SELECT destination_coordinate_id FROM rides WHERE passenger_id = $1 AND destination_coordinate_id IS NOT NULL`
+
+// Erase anonymizes a user in one transaction:
+//   - users: email, phone, password and attrs are replaced; the account
+//     becomes INACTIVE and erased_at is set
+//   - sessions, emailed tokens, login codes, failed-login counters and stored
+//     idempotent responses are deleted, and access tokens are revoked
+//   - coordinates of the user and of their rides lose their address and are
+//     rounded to about a kilometre; a driver's location history is deleted
+//   - payloads of the ride events and of the outbox messages (published or
+//     not) of their rides, as passenger or driver, lose addresses and
+//     free-text reasons, and coordinates are rounded the same way
+//   - a driver's license number and vehicle details are removed
+//
+// Rides, fares, earnings, driver session totals and ratings stay. Users with a ride
+// in progress cannot be erased until it ends.
+func Erase(ctx context.Context, db *pgxpool.Pool, userID string, accessTTL time.Duration) (*Report, error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var (
+		email, phone, pendingPhone string
+		erased                     bool
+	)
+	err = tx.QueryRow(ctx, `
+		SELECT lower(email), coalesce(phone, ''), coalesce(pending_phone, ''), erased_at IS NOT NULL
+		FROM users WHERE id = $1 FOR UPDATE
+	`, userID).Scan(&email, &phone, &pendingPhone, &erased)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query user: %w", err)
+	}
+	if erased {
+		return nil, ErrAlreadyErased
+	}
+
+	var active bool
+	if err := tx.QueryRow(ctx, `
+		SELECT EXISTS (SELECT 1 FROM rides WHERE (passenger_id = $1 OR driver_id = $1) AND status = ANY($2))
+	`, userID, activeRideStatuses).Scan(&active); err != nil {
+		return nil, fmt.Errorf("failed to query rides: %w", err)
+	}
+	if active {
+		return nil, ErrActiveRide
+	}
+
+	report := &Report{UserID: userID}
+	if err := tx.QueryRow(ctx, `
+		UPDATE users SET
+			email = 'erased-' || id || '@erased.invalid',
+			phone = NULL,
+			phone_verified_at = NULL,
+			pending_phone = NULL,
+			email_verified_at = NULL,
+			password_hash = '',
+			attrs = '{}'::jsonb,
+			status = 'INACTIVE',
+			erased_at = NOW(),
+			updated_at = NOW()
+		WHERE id = $1
+		RETURNING erased_at
+	`, userID).Scan(&report.ErasedAt); err != nil {
+		return nil, fmt.Errorf("failed to anonymize user: %w", err)
+	}
+
+	subjects := []string{email}
+	if phone != "" {
+		subjects = append(subjects, phone)
+	}
+	steps := []struct {
+		what  string
+		query string
+		args  []interface{}
+		count *int64
+	}{
+		{"refresh tokens", `DELETE FROM refresh_tokens WHERE user_id = $1`, []interface{}{userID}, &report.Sessions},
+		{"email tokens", `DELETE FROM email_tokens WHERE user_id = $1`, []interface{}{userID}, nil},
+		{"phone codes", `DELETE FROM phone_otps WHERE phone = ANY($1)`, []interface{}{[]string{phone, pendingPhone}}, nil},
+		{"login failures", `DELETE FROM login_failures WHERE kind = 'account' AND subject = ANY($1)`, []interface{}{subjects}, nil},
+		{"lockouts", `UPDATE login_lockouts SET subject = 'erased-' || $2::text WHERE kind = 'account' AND subject = ANY($1)`,
+			[]interface{}{subjects, userID}, nil},
+		{"idempotency keys", `DELETE FROM idempotency_keys WHERE user_id = $1`, []interface{}{userID}, nil},
+		{"cancellation reasons", `
+			UPDATE rides SET cancellation_reason = NULL, updated_at = NOW()
+			WHERE passenger_id = $1 AND cancellation_reason IS NOT NULL
+		`, []interface{}{userID}, &report.Rides},
+		{"coordinates", `
+			UPDATE coordinates SET
+				address = '` + Erased + `',
+				latitude = round(latitude::numeric, 2),
+				longitude = round(longitude::numeric, 2),
+				location = ST_SetSRID(ST_MakePoint(round(longitude::numeric, 2), round(latitude::numeric, 2)), 4326),
+				updated_at = NOW()
+			WHERE entity_id = $1 OR id IN (` + passengerCoordinates + `)
+		`, []interface{}{userID}, &report.Coordinates},
+		{"location history", `DELETE FROM location_history WHERE driver_id = $1`, []interface{}{userID}, &report.LocationHistory},
+		{"driver", `
+			UPDATE drivers SET license_number = 'erased-' || id, vehicle_attrs = NULL, status = 'OFFLINE', updated_at = NOW()
+			WHERE id = $1
+		`, []interface{}{userID}, nil},
+	}
+	for _, step := range steps {
+		tag, err := tx.Exec(ctx, step.query, step.args...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to erase %s: %w", step.what, err)
+		}
+		if step.count != nil {
+			*step.count = tag.RowsAffected()
+		}
+	}
+
+	if report.RideEvents, err = redactPayloads(ctx, tx, userID, "ride events", `
+		SELECT id::text, event_data FROM ride_events WHERE ride_id IN `+rideFilter, `
+		UPDATE ride_events SET event_data = $2::jsonb WHERE id = $1::text::uuid`); err != nil {
+		return nil, err
+	}
+	// the relay keeps published messages for a while, and the revocation
+	// recorded below must still go out, so messages are scrubbed, not deleted
+	if report.OutboxMessages, err = redactPayloads(ctx, tx, userID, "outbox messages", `
+		SELECT id::text, payload FROM outbox
+		WHERE payload->'data'->>'ride_id' IN (SELECT id::text FROM rides WHERE passenger_id = $1 OR driver_id = $1)
+		   OR payload->'data'->>'driver_id' = $1::text`, `
+		UPDATE outbox SET payload = $2::jsonb WHERE id = $1::text::bigint`); err != nil {
+		return nil, err
+	}
+
+	if err := revocation.Record(ctx, tx, revocation.User(userID, accessTTL, revocation.ReasonErased)); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit erasure: %w", err)
+	}
+	return report, nil
+}
+
+// redactPayloads runs redact over the JSON column returned by query, next
+// to a text id, writes the changed values back with update and returns how
+// many changed.
+func redactPayloads(ctx context.Context, tx pgx.Tx, userID, what, query, update string) (int64, error) {
+	rows, err := tx.Query(ctx, query, userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query %s: %w", what, err)
+	}
+
+	redacted := map[string][]byte{}
+	for rows.Next() {
+		var (
+			id   string
+			data []byte
+		)
+		if err := rows.Scan(&id, &data); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan %s: %w", what, err)
+		}
+
+		var v interface{}
+		if err := json.Unmarshal(data, &v); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to decode %s %s: %w", what, id, err)
+		}
+		if !redact(v) {
+			continue
+		}
+		if redacted[id], err = json.Marshal(v); err != nil {
+			rows.Close()
+			return 0, err
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to read %s: %w", what, err)
+	}
+
+	for id, data := range redacted {
+		if _, err := tx.Exec(ctx, update, id, string(data)); err != nil {
+			return 0, fmt.Errorf("failed to redact %s %s: %w", what, id, err)
+		}
+	}
+	return int64(len(redacted)), nil
+}
+
+// redact removes personal data from a decoded JSON value in place and reports
+// whether anything changed.
+func redact(v interface{}) bool {
+	changed := false
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, x := range t {
+			switch {
+			case erasedKeys[k]:
+				if s, ok := x.(string); ok && s != "" && s != Erased {
+					t[k] = Erased
+					changed = true
+				}
+			case droppedKeys[k]:
+				delete(t, k)
+				changed = true
+			case coordinateKeys[k]:
+				if f, ok := x.(float64); ok && coarsen(f) != f {
+					t[k] = coarsen(f)
+					changed = true
+				}
+			default:
+				changed = redact(x) || changed
+			}
+		}
+	case []interface{}:
+		for _, x := range t {
+			changed = redact(x) || changed
+		}
+	}
+	return changed
+}
+
+// coarsen rounds a coordinate to two decimals, about a kilometre.
+func coarsen(f float64) float64 {
+	return math.Round(f*100) / 100
+}
@@ -0,0 +1,156 @@
+package privacy
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// section is one file of the export. query takes the user id and returns a
+// single JSON value.
+type section struct {
+	file  string
+	query string
+}
+
+// rideFilter selects the rides the user took part in, as passenger or driver.
+const rideFilter = `(SELECT id FROM rides WHERE passenger_id = $1 OR driver_id = $1)`
+
+var sections = []section{
+	{"profile.json", `
+		SELECT to_jsonb(u) FROM (
+			SELECT id, email, phone, role, status, attrs, created_at, updated_at,
+				email_verified_at, phone_verified_at, pending_phone, erased_at
+			FROM users WHERE id = $1
+		) u`},
+	{"rides.json", `
+		SELECT coalesce(jsonb_agg(to_jsonb(r) ORDER BY r.requested_at), '[]') FROM (
+			SELECT id, ride_number, passenger_id, driver_id, vehicle_type, status, priority,
+				requested_at, matched_at, arrived_at, started_at, completed_at, cancelled_at,
+				cancellation_reason, pickup_coordinate_id, destination_coordinate_id
+			FROM rides WHERE id IN ` + rideFilter + `
+		) r`},
+	{"coordinates.json", `
+		SELECT coalesce(jsonb_agg(to_jsonb(c) ORDER BY c.created_at), '[]') FROM (
+			SELECT id, entity_id, entity_type, address, latitude, longitude, fare_amount,
+				distance_km, duration_minutes, is_current, created_at, updated_at
+			FROM coordinates
+			WHERE entity_id = $1
+			   OR id IN (SELECT pickup_coordinate_id FROM rides WHERE passenger_id = $1)
+			   OR id IN (SELECT destination_coordinate_id FROM rides WHERE passenger_id = $1)
+		) c`},
+	{"location_history.json", `
+		SELECT coalesce(jsonb_agg(to_jsonb(l) ORDER BY l.recorded_at), '[]') FROM (
+			SELECT id, coordinate_id, ride_id, latitude, longitude, accuracy_meters,
+				speed_kmh, heading_degrees, recorded_at
+			FROM location_history WHERE driver_id = $1
+		) l`},
+	{"ride_events.json", `
+		SELECT coalesce(jsonb_agg(to_jsonb(e) ORDER BY e.created_at), '[]') FROM (
+			SELECT id, ride_id, event_type, event_data, created_at
+			FROM ride_events WHERE ride_id IN ` + rideFilter + `
+		) e`},
+	// ratings live on the driver record; riders are not rated
+	{"ratings.json", `
+		SELECT coalesce((
+			SELECT jsonb_build_object('driver_rating', rating, 'total_rides', total_rides)
+			FROM drivers WHERE id = $1
+		), 'null')`},
+	{"payments.json", `
+		SELECT jsonb_build_object(
+			'ride_fares', (
+				SELECT coalesce(jsonb_agg(jsonb_build_object(
+					'ride_id', id, 'ride_number', ride_number,
+					'role', CASE WHEN passenger_id = $1 THEN 'passenger' ELSE 'driver' END,
+					'status', status, 'estimated_fare', estimated_fare, 'final_fare', final_fare,
+					'completed_at', completed_at) ORDER BY requested_at), '[]')
+				FROM rides WHERE id IN ` + rideFilter + `
+			),
+			'driver_sessions', (
+				SELECT coalesce(jsonb_agg(jsonb_build_object(
+					'session_id', id, 'started_at', started_at, 'ended_at', ended_at,
+					'total_rides', total_rides, 'total_earnings', total_earnings) ORDER BY started_at), '[]')
+				FROM driver_sessions WHERE driver_id = $1
+			),
+			'driver_total_earnings', (SELECT total_earnings FROM drivers WHERE id = $1)
+		)`},
+	{"driver.json", `
+		SELECT coalesce((
+			SELECT to_jsonb(d) FROM (
+				SELECT id, license_number, vehicle_type, vehicle_attrs, status, is_verified, created_at, updated_at
+				FROM drivers WHERE id = $1
+			) d
+		), 'null')`},
+	{"sessions.json", `
+		SELECT coalesce(jsonb_agg(to_jsonb(t) ORDER BY t.created_at), '[]') FROM (
+			SELECT id, family_id, device, created_at, expires_at, used_at, revoked_at
+			FROM refresh_tokens WHERE user_id = $1
+		) t`},
+}
+
+// Manifest is the manifest.json of an export.
+type Manifest struct {
+	UserID      string    `json:"user_id"`
+	GeneratedAt time.Time `json:"generated_at"`
+	Files       []string  `json:"files"`
+}
+
+// Export writes a ZIP archive of everything stored about a user: one JSON file
+// per section and a manifest.json. Every section is read in one repeatable
+// read transaction, so the files agree with each other.
+func Export(ctx context.Context, db *pgxpool.Pool, userID string, w io.Writer) error {
+	tx, err := db.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	manifest := Manifest{UserID: userID, GeneratedAt: time.Now().UTC()}
+	zw := zip.NewWriter(w)
+	for _, s := range sections {
+		var data []byte
+		err := tx.QueryRow(ctx, s.query, userID).Scan(&data)
+		if errors.Is(err, pgx.ErrNoRows) && s.file == "profile.json" {
+			return ErrUserNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("failed to export %s: %w", s.file, err)
+		}
+		if err := writeJSON(zw, s.file, data); err != nil {
+			return err
+		}
+		manifest.Files = append(manifest.Files, s.file)
+	}
+
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	if err := writeJSON(zw, "manifest.json", data); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func writeJSON(zw *zip.Writer, name string, data []byte) error {
+	var b bytes.Buffer
+	if err := json.Indent(&b, data, "", "  "); err != nil {
+		return fmt.Errorf("failed to format %s: %w", name, err)
+	}
+	b.WriteByte('\n')
+
+	f, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(b.Bytes())
+	return err
+}
@@ -0,0 +1,43 @@
+// Package privacy answers data subject requests: Export bundles everything
+// stored about a user, and Erase anonymizes it. Fares, earnings and ratings
+// are financial records under legal retention and are kept by Erase; rows
+// stay in place so they still add up, with personal details removed.
+package privacy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrUserNotFound  = errors.New("user not found")
+	ErrAlreadyErased = errors.New("user has already been erased")
+	ErrActiveRide    = errors.New("user has a ride in progress")
+)
+
+// activeRideStatuses are the ride statuses Erase waits out.
+var activeRideStatuses = []string{"REQUESTED", "MATCHED", "EN_ROUTE", "ARRIVED", "IN_PROGRESS"}
+
+// ResolveUser returns the id of the user named by ref, a user id or an email
+// address.
+func ResolveUser(ctx context.Context, db *pgxpool.Pool, ref string) (string, error) {
+	query := `SELECT id FROM users WHERE email = $1`
+	if uuid.Validate(ref) == nil {
+		query = `SELECT id FROM users WHERE id = $1`
+	}
+
+	var id string
+	err := db.QueryRow(ctx, query, ref).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", ErrUserNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to query user: %w", err)
+	}
+	return id, nil
+}
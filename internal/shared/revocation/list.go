@@ -0,0 +1,181 @@
+package revocation
+
+import (
+	"context"
+	"fmt"
+	"ride-hail/internal/shared/auth"
+	"ride-hail/internal/shared/events"
+	"ride-hail/internal/shared/metrics"
+	"ride-hail/internal/shared/mq"
+	"ride-hail/internal/shared/util"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rabbitmq/amqp091-go"
+)
+
+const pruneInterval = time.Minute
+
+var (
+	revocationsReceived = metrics.NewCounterVec("token_revocations_received_total",
+		"Revocations received from auth_fanout, by reason.", "reason")
+	tokensRejected = metrics.NewCounterVec("revoked_tokens_rejected_total",
+		"Requests rejected because their token was revoked.")
+)
+
+type userEntry struct {
+	revokedAt time.Time
+	expiresAt time.Time
+}
+
+// List is the in-memory deny list of one service. It implements auth.DenyList.
+type List struct {
+	db     *pgxpool.Pool
+	logger *util.Logger
+
+	mu     sync.RWMutex
+	tokens map[string]time.Time
+	users  map[string]userEntry
+}
+
+var _ auth.DenyList = (*List)(nil)
+
+func NewList(db *pgxpool.Pool, logger *util.Logger) *List {
+	return &List{
+		db:     db,
+		logger: logger,
+		tokens: map[string]time.Time{},
+		users:  map[string]userEntry{},
+	}
+}
+
+// Revoked reports whether the token itself or every token of its user issued
+// up to its iat was revoked. iat has a precision of one millisecond, so only a
+// token issued in the same millisecond as a user revocation is rejected too.
+func (l *List) Revoked(claims *auth.Claims) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if _, ok := l.tokens[claims.ID]; ok && claims.ID != "" {
+		tokensRejected.Inc()
+		return true
+	}
+	if u, ok := l.users[claims.UserID]; ok && (claims.IssuedAt == nil || !claims.IssuedAt.After(u.revokedAt)) {
+		tokensRejected.Inc()
+		return true
+	}
+	return false
+}
+
+// Add puts a revocation on the list.
+func (l *List) Add(r events.TokenRevoked) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.add(r)
+}
+
+func (l *List) add(r events.TokenRevoked) {
+	if r.TokenID != "" {
+		l.tokens[r.TokenID] = r.ExpiresAt
+		return
+	}
+	if r.UserID == "" {
+		return
+	}
+	u := l.users[r.UserID]
+	if r.RevokedAt.After(u.revokedAt) {
+		u.revokedAt = r.RevokedAt
+	}
+	if r.ExpiresAt.After(u.expiresAt) {
+		u.expiresAt = r.ExpiresAt
+	}
+	l.users[r.UserID] = u
+}
+
+// Load replaces the list with the revocations in Postgres that have not
+// expired yet.
+func (l *List) Load(ctx context.Context) error {
+	rows, err := l.db.Query(ctx, `
+		SELECT coalesce(token_id, ''), coalesce(user_id::text, ''), reason, revoked_at, expires_at
+		FROM revoked_tokens
+		WHERE expires_at > NOW()
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to load revoked tokens: %w", err)
+	}
+	defer rows.Close()
+
+	var loaded []events.TokenRevoked
+	for rows.Next() {
+		var r events.TokenRevoked
+		if err := rows.Scan(&r.TokenID, &r.UserID, &r.Reason, &r.RevokedAt, &r.ExpiresAt); err != nil {
+			return fmt.Errorf("failed to scan revoked token: %w", err)
+		}
+		loaded = append(loaded, r)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to load revoked tokens: %w", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.tokens = map[string]time.Time{}
+	l.users = map[string]userEntry{}
+	for _, r := range loaded {
+		l.add(r)
+	}
+	return nil
+}
+
+// Run follows auth_fanout until ctx is done and drops expired entries. The
+// list is reloaded from Postgres whenever the subscription is re-established,
+// to pick up revocations published while it was down.
+func (l *List) Run(ctx context.Context, conn *mq.Connection) {
+	resync := func(ctx context.Context) {
+		if err := l.Load(ctx); err != nil {
+			l.logger.Error("RevocationList", err)
+		}
+	}
+	sub := conn.Subscribe(ctx, Exchange, resync, l.handle)
+
+	ticker := time.NewTicker(pruneInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			stopCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			_ = sub.Stop(stopCtx)
+			return
+		case <-ticker.C:
+			l.prune(time.Now())
+		}
+	}
+}
+
+func (l *List) handle(ctx context.Context, msg amqp091.Delivery) {
+	var r events.TokenRevoked
+	if _, err := events.Decode(msg.Body, events.TypeTokenRevoked, &r); err != nil {
+		l.logger.WithContext(ctx).Error("RevocationList", fmt.Errorf("dropping malformed revocation: %w", err))
+		return
+	}
+	revocationsReceived.Inc(r.Reason)
+	l.Add(r)
+}
+
+func (l *List) prune(now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for id, exp := range l.tokens {
+		if now.After(exp) {
+			delete(l.tokens, id)
+		}
+	}
+	for id, u := range l.users {
+		if now.After(u.expiresAt) {
+			delete(l.users, id)
+		}
+	}
+}
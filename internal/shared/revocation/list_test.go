@@ -0,0 +1,68 @@
+package revocation
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"ride-hail/internal/shared/auth"
+	"ride-hail/internal/shared/models"
+	"ride-hail/internal/shared/util"
+)
+
+func newIssuer(t *testing.T) *auth.Issuer {
+	t.Helper()
+
+	key, err := auth.GenerateKey(auth.AlgEdDSA)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	pem, err := auth.EncodePrivateKey(key)
+	if err != nil {
+		t.Fatalf("EncodePrivateKey: %v", err)
+	}
+	file := filepath.Join(t.TempDir(), "test.pem")
+	if err := os.WriteFile(file, pem, 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	issuer, err := auth.NewIssuer(models.JWTConfig{
+		Issuer:         "auth-service",
+		Audience:       "ride-hail",
+		AccessTokenTTL: 5 * time.Minute,
+		SigningKeyID:   "test",
+		Keys:           []models.JWTKey{{ID: "test", Algorithm: auth.AlgEdDSA, PrivateKeyFile: file}},
+	})
+	if err != nil {
+		t.Fatalf("NewIssuer: %v", err)
+	}
+	return issuer
+}
+
+func TestUserRevocationWithinOneSecond(t *testing.T) {
+	issuer := newIssuer(t)
+	verifier := issuer.Verifier()
+	list := NewList(nil, util.New())
+	verifier.UseDenyList(list)
+
+	before, _, err := issuer.Issue("user-1", "user@example.com", "PASSENGER")
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	list.Add(User("user-1", 5*time.Minute, ReasonRoleChanged))
+	time.Sleep(5 * time.Millisecond)
+	after, _, err := issuer.Issue("user-1", "user@example.com", "DRIVER")
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+
+	if _, err := verifier.Parse(before); !errors.Is(err, auth.ErrRevoked) {
+		t.Errorf("token issued before the revocation: err = %v, want %v", err, auth.ErrRevoked)
+	}
+	if _, err := verifier.Parse(after); err != nil {
+		t.Errorf("token issued after the revocation: err = %v, want it accepted", err)
+	}
+}
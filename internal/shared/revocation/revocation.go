@@ -0,0 +1,73 @@
+// Package revocation spreads revoked access tokens to every service. Auth
+// service records a revocation in Postgres and, through the outbox, publishes
+// it on auth_fanout; each service keeps the revocations that still matter in
+// a List and rejects the tokens they cover without a database round trip.
+package revocation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"ride-hail/internal/shared/events"
+	"ride-hail/internal/shared/models"
+	"ride-hail/internal/shared/mq"
+	"ride-hail/internal/shared/util"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Exchange is the fanout exchange revocations are published on.
+const Exchange = "auth_fanout"
+
+const (
+	ReasonLogout          = "logout"
+	ReasonLogoutAll       = "logout_all"
+	ReasonTokenReuse      = "refresh_token_reuse"
+	ReasonBanned          = "banned"
+	ReasonDeactivated     = "deactivated"
+	ReasonPasswordChanged = "password_changed"
+	ReasonRoleChanged     = "role_changed"
+	ReasonErased          = "erased"
+)
+
+// Token revokes the access token with the given jti until it expires.
+func Token(tokenID string, expiresAt time.Time, reason string) events.TokenRevoked {
+	return events.TokenRevoked{TokenID: tokenID, Reason: reason, RevokedAt: time.Now().UTC(), ExpiresAt: expiresAt.UTC()}
+}
+
+// User revokes every access token issued to userID so far. Tokens live at most
+// ttl, so the entry is not needed after that.
+func User(userID string, ttl time.Duration, reason string) events.TokenRevoked {
+	now := time.Now().UTC()
+	return events.TokenRevoked{UserID: userID, Reason: reason, RevokedAt: now, ExpiresAt: now.Add(ttl)}
+}
+
+// Record stores the revocation and its outbox message in the caller's
+// transaction, so it is published exactly when it is committed.
+func Record(ctx context.Context, tx pgx.Tx, r events.TokenRevoked) error {
+	_, err := tx.Exec(ctx, `
+		INSERT INTO revoked_tokens (token_id, user_id, reason, revoked_at, expires_at)
+		VALUES (NULLIF($1, ''), NULLIF($2, '')::uuid, $3, $4, $5)
+	`, r.TokenID, r.UserID, r.Reason, r.RevokedAt, r.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to record revocation: %w", err)
+	}
+
+	correlationID := util.RequestID(ctx)
+	env, err := events.New(events.TypeTokenRevoked, "auth-service", correlationID, r)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(env)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s event: %w", events.TypeTokenRevoked, err)
+	}
+	return mq.InsertOutbox(ctx, tx, models.OutboxMessage{
+		EventID:       env.EventID,
+		CorrelationID: correlationID,
+		Exchange:      Exchange,
+		RoutingKey:    "",
+		Payload:       body,
+	})
+}
@@ -0,0 +1,132 @@
+package settings
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"ride-hail/internal/shared/util"
+	"strconv"
+)
+
+const (
+	defaultAuditLimit = 50
+	maxAuditLimit     = 500
+)
+
+type settingResponse struct {
+	Value
+	Definition Definition `json:"definition"`
+}
+
+// Handler serves the admin API under /admin/settings. actor names the operator
+// making a change, for the audit trail.
+//
+//	GET    /admin/settings              current values with their allowed ranges
+//	GET    /admin/settings/audit        latest changes of every setting
+//	GET    /admin/settings/{key}        one value
+//	PUT    /admin/settings/{key}        {"value": "90s"}
+//	DELETE /admin/settings/{key}        back to the value from config.yaml
+//	GET    /admin/settings/{key}/audit  latest changes of one setting
+func (s *Store) Handler(actor func(*http.Request) string) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /admin/settings", func(w http.ResponseWriter, r *http.Request) {
+		values := s.All()
+		resp := make([]settingResponse, 0, len(values))
+		for _, v := range values {
+			resp = append(resp, settingResponse{Value: v, Definition: MustLookup(v.Key)})
+		}
+		util.ResponseInJson(w, http.StatusOK, map[string]any{"settings": resp})
+	})
+
+	mux.HandleFunc("GET /admin/settings/audit", func(w http.ResponseWriter, r *http.Request) {
+		s.serveAudit(w, r, "")
+	})
+
+	mux.HandleFunc("GET /admin/settings/{key}", func(w http.ResponseWriter, r *http.Request) {
+		key := r.PathValue("key")
+		def, ok := Lookup(key)
+		if !ok {
+			util.WriteJSONError(w, "unknown setting: "+key, http.StatusNotFound)
+			return
+		}
+		util.ResponseInJson(w, http.StatusOK, settingResponse{Value: s.Get(key), Definition: def})
+	})
+
+	mux.HandleFunc("PUT /admin/settings/{key}", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Value json.RawMessage `json:"value"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Value) == 0 {
+			util.WriteJSONError(w, `invalid request body, expected {"value": ...}`, http.StatusBadRequest)
+			return
+		}
+
+		// accept both "90s" and 5
+		raw := string(req.Value)
+		var str string
+		if err := json.Unmarshal(req.Value, &str); err == nil {
+			raw = str
+		}
+
+		v, err := s.Set(r.Context(), r.PathValue("key"), raw, actor(r))
+		if err != nil {
+			s.writeError(w, r, err)
+			return
+		}
+		s.logger.WithContext(r.Context()).Warn("Settings", v.Key+" set to "+v.Value+" by "+v.UpdatedBy)
+		util.ResponseInJson(w, http.StatusOK, settingResponse{Value: v, Definition: MustLookup(v.Key)})
+	})
+
+	mux.HandleFunc("DELETE /admin/settings/{key}", func(w http.ResponseWriter, r *http.Request) {
+		v, err := s.Reset(r.Context(), r.PathValue("key"), actor(r))
+		if err != nil {
+			s.writeError(w, r, err)
+			return
+		}
+		s.logger.WithContext(r.Context()).Warn("Settings", v.Key+" reset to "+v.Value+" by "+actor(r))
+		util.ResponseInJson(w, http.StatusOK, settingResponse{Value: v, Definition: MustLookup(v.Key)})
+	})
+
+	mux.HandleFunc("GET /admin/settings/{key}/audit", func(w http.ResponseWriter, r *http.Request) {
+		key := r.PathValue("key")
+		if _, ok := Lookup(key); !ok {
+			util.WriteJSONError(w, "unknown setting: "+key, http.StatusNotFound)
+			return
+		}
+		s.serveAudit(w, r, key)
+	})
+
+	return mux
+}
+
+func (s *Store) serveAudit(w http.ResponseWriter, r *http.Request, key string) {
+	limit := defaultAuditLimit
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxAuditLimit {
+			util.WriteJSONError(w, "limit must be between 1 and "+strconv.Itoa(maxAuditLimit), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	entries, err := s.Audit(r.Context(), key, limit)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	util.ResponseInJson(w, http.StatusOK, map[string]any{"changes": entries})
+}
+
+func (s *Store) writeError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, ErrUnknownKey):
+		util.WriteJSONError(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, ErrInvalidValue):
+		util.WriteJSONError(w, err.Error(), http.StatusBadRequest)
+	default:
+		s.logger.WithContext(r.Context()).Error("Settings", err)
+		util.WriteJSONError(w, "failed to process settings request", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,100 @@
+// Package settings holds the operational settings that operators can change
+// while the services run. Values start from config.yaml, can be overridden in
+// the settings table, and reach every service through Postgres LISTEN/NOTIFY.
+package settings
+
+import (
+	"errors"
+	"fmt"
+	"ride-hail/internal/shared/models"
+	"time"
+)
+
+const (
+	MatchTimeout = "match_timeout"
+)
+
+var (
+	ErrUnknownKey   = errors.New("unknown setting")
+	ErrInvalidValue = errors.New("invalid setting value")
+)
+
+type Kind string
+
+const (
+	KindDuration Kind = "duration"
+)
+
+// Definition describes one setting and the range it may take, in seconds.
+type Definition struct {
+	Key         string  `json:"key"`
+	Description string  `json:"description"`
+	Kind        Kind    `json:"kind"`
+	Min         float64 `json:"min"`
+	Max         float64 `json:"max"`
+}
+
+var definitions = []Definition{
+	{
+		Key:         MatchTimeout,
+		Description: "How long a ride waits for a driver before it is cancelled. Also sent to drivers as timeout_seconds.",
+		Kind:        KindDuration,
+		Min:         10,
+		Max:         1800,
+	},
+}
+
+func Definitions() []Definition {
+	return append([]Definition(nil), definitions...)
+}
+
+func Lookup(key string) (Definition, bool) {
+	for _, d := range definitions {
+		if d.Key == key {
+			return d, true
+		}
+	}
+	return Definition{}, false
+}
+
+// MustLookup is for keys defined in this package.
+func MustLookup(key string) Definition {
+	d, ok := Lookup(key)
+	if !ok {
+		panic("settings: unknown key " + key)
+	}
+	return d
+}
+
+// MinDuration and MaxDuration are the range of a duration setting.
+func (d Definition) MinDuration() time.Duration { return seconds(d.Min) }
+func (d Definition) MaxDuration() time.Duration { return seconds(d.Max) }
+
+// Normalize checks raw against the definition and returns it in canonical form,
+// e.g. "90s" becomes "1m30s".
+func (d Definition) Normalize(raw string) (string, error) {
+	switch d.Kind {
+	case KindDuration:
+		v, err := time.ParseDuration(raw)
+		if err != nil {
+			return "", fmt.Errorf("%w: %s must be a duration like 30s or 2m", ErrInvalidValue, d.Key)
+		}
+		if v < d.MinDuration() || v > d.MaxDuration() {
+			return "", fmt.Errorf("%w: %s must be between %s and %s, got %s", ErrInvalidValue, d.Key, d.MinDuration(), d.MaxDuration(), v)
+		}
+		return v.String(), nil
+	}
+	return "", fmt.Errorf("settings: %s has unsupported kind %q", d.Key, d.Kind)
+}
+
+// Defaults returns the values from config.yaml, used for every key that has no
+// row in the settings table.
+func Defaults(cfg *models.Config) map[string]string {
+	return map[string]string{
+		MatchTimeout: cfg.Services.RideService.MatchTimeout.String(),
+	}
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
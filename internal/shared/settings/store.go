@@ -0,0 +1,326 @@
+package settings
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"ride-hail/internal/shared/util"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const channel = "settings_changed"
+
+const (
+	listenRetryMin = time.Second
+	listenRetryMax = 30 * time.Second
+)
+
+// Value is the current value of a setting.
+type Value struct {
+	Key        string     `json:"key"`
+	Value      string     `json:"value"`
+	Default    string     `json:"default"`
+	Overridden bool       `json:"overridden"`
+	UpdatedAt  *time.Time `json:"updated_at,omitempty"`
+	UpdatedBy  string     `json:"updated_by,omitempty"`
+}
+
+type AuditEntry struct {
+	ID        int64     `json:"id"`
+	Key       string    `json:"key"`
+	OldValue  *string   `json:"old_value"`
+	NewValue  *string   `json:"new_value"`
+	ChangedBy string    `json:"changed_by"`
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+// Store caches the settings of one service. Reads never touch the database;
+// the cache is refreshed when Postgres notifies a change, so callers read the
+// value each time they use it and pick changes up without subscribing.
+type Store struct {
+	pool     *pgxpool.Pool
+	defaults map[string]string
+	logger   *util.Logger
+
+	mu     sync.RWMutex
+	values map[string]Value
+}
+
+func NewStore(pool *pgxpool.Pool, defaults map[string]string, logger *util.Logger) *Store {
+	s := &Store{
+		pool:     pool,
+		defaults: defaults,
+		logger:   logger,
+		values:   make(map[string]Value, len(definitions)),
+	}
+	for _, d := range definitions {
+		s.values[d.Key] = s.defaultValue(d.Key)
+	}
+	return s
+}
+
+func (s *Store) Get(key string) Value {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.values[key]
+}
+
+func (s *Store) All() []Value {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	values := make([]Value, 0, len(s.values))
+	for _, v := range s.values {
+		values = append(values, v)
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i].Key < values[j].Key })
+	return values
+}
+
+// Duration returns a duration setting. Values are validated before they are
+// cached, so it only fails for keys of another kind.
+func (s *Store) Duration(key string) time.Duration {
+	d, _ := time.ParseDuration(s.Get(key).Value)
+	return d
+}
+
+// Load reads every override from the database.
+func (s *Store) Load(ctx context.Context) error {
+	rows, err := s.pool.Query(ctx, `SELECT key, value, updated_at, updated_by FROM settings`)
+	if err != nil {
+		return fmt.Errorf("failed to load settings: %w", err)
+	}
+	defer rows.Close()
+
+	overrides := map[string]Value{}
+	for rows.Next() {
+		var v Value
+		var updatedAt time.Time
+		if err := rows.Scan(&v.Key, &v.Value, &updatedAt, &v.UpdatedBy); err != nil {
+			return fmt.Errorf("failed to scan setting: %w", err)
+		}
+		v.UpdatedAt = &updatedAt
+		overrides[v.Key] = v
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to load settings: %w", err)
+	}
+
+	for _, d := range definitions {
+		if v, ok := overrides[d.Key]; ok {
+			s.applyOverride(v)
+		} else {
+			s.apply(s.defaultValue(d.Key))
+		}
+	}
+	return nil
+}
+
+func (s *Store) reload(ctx context.Context, key string) error {
+	if _, ok := Lookup(key); !ok {
+		return nil
+	}
+
+	v := Value{Key: key}
+	var updatedAt time.Time
+	err := s.pool.QueryRow(ctx,
+		`SELECT value, updated_at, updated_by FROM settings WHERE key = $1`, key,
+	).Scan(&v.Value, &updatedAt, &v.UpdatedBy)
+	if errors.Is(err, pgx.ErrNoRows) {
+		s.apply(s.defaultValue(key))
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to reload setting %s: %w", key, err)
+	}
+	v.UpdatedAt = &updatedAt
+	s.applyOverride(v)
+	return nil
+}
+
+// applyOverride caches a value from the settings table. Rows written around the
+// API are validated too; an invalid one is ignored and the default is used.
+func (s *Store) applyOverride(v Value) {
+	normalized, err := MustLookup(v.Key).Normalize(v.Value)
+	if err != nil {
+		s.logger.Error("Settings", fmt.Errorf("ignoring stored value %q: %w", v.Value, err))
+		s.apply(s.defaultValue(v.Key))
+		return
+	}
+	v.Value = normalized
+	v.Default = s.defaults[v.Key]
+	v.Overridden = true
+	s.apply(v)
+}
+
+func (s *Store) apply(v Value) {
+	s.mu.Lock()
+	old := s.values[v.Key]
+	s.values[v.Key] = v
+	s.mu.Unlock()
+
+	if old.Value != v.Value {
+		s.logger.Info("Settings", fmt.Sprintf("%s changed from %s to %s", v.Key, old.Value, v.Value))
+	}
+}
+
+func (s *Store) defaultValue(key string) Value {
+	return Value{Key: key, Value: s.defaults[key], Default: s.defaults[key]}
+}
+
+// Run listens for changes until ctx is cancelled. After losing the connection
+// it reloads everything, since notifications sent in between are lost.
+func (s *Store) Run(ctx context.Context) {
+	retry := listenRetryMin
+	for {
+		err := s.listen(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		s.logger.Warn("Settings", fmt.Sprintf("listener stopped, retrying in %s: %v", retry, err))
+
+		select {
+		case <-time.After(retry):
+		case <-ctx.Done():
+			return
+		}
+		retry = min(retry*2, listenRetryMax)
+		if err := s.Load(ctx); err != nil {
+			s.logger.Error("Settings", err)
+			continue
+		}
+		retry = listenRetryMin
+	}
+}
+
+func (s *Store) listen(ctx context.Context) error {
+	pooled, err := s.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	// a connection that was listening must not go back to the pool
+	conn := pooled.Hijack()
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+channel); err != nil {
+		return err
+	}
+
+	for {
+		n, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		if err := s.reload(ctx, n.Payload); err != nil {
+			s.logger.Error("Settings", err)
+		}
+	}
+}
+
+// Set validates and stores a value, and records the change in the audit trail.
+func (s *Store) Set(ctx context.Context, key, raw, changedBy string) (Value, error) {
+	def, ok := Lookup(key)
+	if !ok {
+		return Value{}, fmt.Errorf("%w: %s", ErrUnknownKey, key)
+	}
+	value, err := def.Normalize(raw)
+	if err != nil {
+		return Value{}, err
+	}
+
+	err = s.change(ctx, key, changedBy, func(tx pgx.Tx) (*string, error) {
+		_, err := tx.Exec(ctx, `
+			INSERT INTO settings (key, value, updated_by)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (key)
+			DO UPDATE SET value = EXCLUDED.value, updated_at = NOW(), updated_by = EXCLUDED.updated_by
+		`, key, value, changedBy)
+		return &value, err
+	})
+	if err != nil {
+		return Value{}, err
+	}
+
+	now := time.Now().UTC()
+	s.apply(Value{Key: key, Value: value, Default: s.defaults[key], Overridden: true, UpdatedAt: &now, UpdatedBy: changedBy})
+	return s.Get(key), nil
+}
+
+// Reset removes the override, so the value from config.yaml applies again.
+func (s *Store) Reset(ctx context.Context, key, changedBy string) (Value, error) {
+	if _, ok := Lookup(key); !ok {
+		return Value{}, fmt.Errorf("%w: %s", ErrUnknownKey, key)
+	}
+
+	err := s.change(ctx, key, changedBy, func(tx pgx.Tx) (*string, error) {
+		_, err := tx.Exec(ctx, `DELETE FROM settings WHERE key = $1`, key)
+		return nil, err
+	})
+	if err != nil {
+		return Value{}, err
+	}
+
+	s.apply(s.defaultValue(key))
+	return s.Get(key), nil
+}
+
+// change runs write and the audit insert in one transaction. The trigger on
+// the settings table notifies the other instances when it commits.
+func (s *Store) change(ctx context.Context, key, changedBy string, write func(pgx.Tx) (*string, error)) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var old *string
+	err = tx.QueryRow(ctx, `SELECT value FROM settings WHERE key = $1 FOR UPDATE`, key).Scan(&old)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("failed to read setting %s: %w", key, err)
+	}
+
+	newValue, err := write(tx)
+	if err != nil {
+		return fmt.Errorf("failed to write setting %s: %w", key, err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO settings_audit (key, old_value, new_value, changed_by)
+		VALUES ($1, $2, $3, $4)
+	`, key, old, newValue, changedBy)
+	if err != nil {
+		return fmt.Errorf("failed to audit setting %s: %w", key, err)
+	}
+
+	return tx.Commit(ctx)
+}
+
+// Audit returns the latest changes, newest first. An empty key returns the
+// changes of every setting.
+func (s *Store) Audit(ctx context.Context, key string, limit int) ([]AuditEntry, error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT id, key, old_value, new_value, changed_by, changed_at
+		FROM settings_audit
+		WHERE $1 = '' OR key = $1
+		ORDER BY id DESC
+		LIMIT $2
+	`, key, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read settings audit: %w", err)
+	}
+
+	entries, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (AuditEntry, error) {
+		var e AuditEntry
+		err := row.Scan(&e.ID, &e.Key, &e.OldValue, &e.NewValue, &e.ChangedBy, &e.ChangedAt)
+		return e, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read settings audit: %w", err)
+	}
+	return entries, nil
+}
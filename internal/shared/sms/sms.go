@@ -0,0 +1,65 @@
+// Package sms sends text messages through an SMSSender chosen by config. Only
+// a fake that logs messages exists so far; a provider is added here as
+// another driver.
+package sms
+
+import (
+	"context"
+	"fmt"
+	"ride-hail/internal/shared/models"
+	"ride-hail/internal/shared/util"
+	"sync"
+)
+
+type SMSSender interface {
+	// Send delivers text to a phone number in E.164 form.
+	Send(ctx context.Context, to, text string) error
+}
+
+// New returns the sender selected by cfg.Driver.
+func New(cfg models.SMSConfig, logger *util.Logger) (SMSSender, error) {
+	switch cfg.Driver {
+	case "fake":
+		return NewFakeSender(logger), nil
+	default:
+		return nil, fmt.Errorf("unknown sms driver %q", cfg.Driver)
+	}
+}
+
+// Message is a text handed to FakeSender.
+type Message struct {
+	To   string
+	Text string
+}
+
+// FakeSender logs messages instead of sending them and keeps the latest one
+// per phone, so local tools can read login codes back.
+type FakeSender struct {
+	logger *util.Logger
+
+	mu   sync.Mutex
+	last map[string]Message
+}
+
+func NewFakeSender(logger *util.Logger) *FakeSender {
+	return &FakeSender{logger: logger, last: map[string]Message{}}
+}
+
+func (s *FakeSender) Send(ctx context.Context, to, text string) error {
+	s.mu.Lock()
+	s.last[to] = Message{To: to, Text: text}
+	s.mu.Unlock()
+
+	s.logger.WithContext(ctx).Info("SMS", fmt.Sprintf("not sent, fake sms driver [to=%s]: %s", to, text))
+	return nil
+}
+
+// Last returns the latest message sent to a phone.
+func (s *FakeSender) Last(to string) (Message, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	msg, ok := s.last[to]
+	return msg, ok
+}
+
+var _ SMSSender = (*FakeSender)(nil)
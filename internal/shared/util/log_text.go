@@ -0,0 +1,156 @@
+package util
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"sync"
+)
+
+// --- COLORS ---
+var (
+	Reset   = "\033[0m"
+	Red     = "\033[31m"
+	Green   = "\033[32m"
+	Yellow  = "\033[33m"
+	Blue    = "\033[34m"
+	Magenta = "\033[35m"
+	Cyan    = "\033[36m"
+	White   = "\033[37m"
+)
+
+// colorHandler is the slog handler behind LOG_FORMAT=text. It keeps the
+// column layout the services always printed during local development and
+// appends the remaining fields as key=value pairs.
+type colorHandler struct {
+	mu    *sync.Mutex
+	w     io.Writer
+	opts  *slog.HandlerOptions
+	attrs []slog.Attr
+}
+
+func newColorHandler(w io.Writer, opts *slog.HandlerOptions) *colorHandler {
+	return &colorHandler{mu: &sync.Mutex{}, w: w, opts: opts}
+}
+
+func (h *colorHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.opts.Level.Level()
+}
+
+func (h *colorHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	next := *h
+	next.attrs = append(append([]slog.Attr{}, h.attrs...), attrs...)
+	return &next
+}
+
+// WithGroup is not needed by the services; groups are flattened.
+func (h *colorHandler) WithGroup(string) slog.Handler {
+	return h
+}
+
+func (h *colorHandler) Handle(_ context.Context, r slog.Record) error {
+	fields := make(map[string]slog.Value)
+	var order []string
+	collect := func(a slog.Attr) bool {
+		if _, seen := fields[a.Key]; !seen {
+			order = append(order, a.Key)
+		}
+		fields[a.Key] = a.Value
+		return true
+	}
+	for _, a := range h.attrs {
+		collect(a)
+	}
+	r.Attrs(collect)
+
+	var buf bytes.Buffer
+	timestamp := r.Time.Format("2006-01-02 15:04:05.000")
+
+	if valueString(fields[FieldAction]) == "http_request" {
+		status, _ := strconv.Atoi(valueString(fields["status"]))
+		fmt.Fprintf(&buf, "%s|%s| %8sms | %-20s | %s %s",
+			timestamp, paintStatus(status), valueString(fields["duration_ms"]),
+			valueString(fields["remote_addr"]), paintMethod(valueString(fields["method"])), valueString(fields["path"]))
+		for _, key := range []string{FieldAction, "status", "duration_ms", "remote_addr", "method", "path"} {
+			delete(fields, key)
+		}
+	} else {
+		fmt.Fprintf(&buf, "%s|%s| %-15s | %s",
+			timestamp, paintLevel(r.Level, fields["ok"].Any() == true), valueString(fields[FieldAction]), r.Message)
+		delete(fields, FieldAction)
+		delete(fields, "ok")
+	}
+
+	for _, key := range order {
+		value, ok := fields[key]
+		if !ok || key == FieldService || key == FieldHostname {
+			continue
+		}
+		fmt.Fprintf(&buf, " %s%s=%s%s", Cyan, key, Reset, value.String())
+	}
+	buf.WriteByte('\n')
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := h.w.Write(buf.Bytes())
+	return err
+}
+
+func valueString(v slog.Value) string {
+	if v.Kind() == slog.KindAny && v.Any() == nil {
+		return ""
+	}
+	return v.String()
+}
+
+// --- COLOR HELPERS ---
+
+func paintLevel(level slog.Level, ok bool) string {
+	switch {
+	case ok:
+		return Green + fmt.Sprintf(" %-5s", "OK") + Reset
+	case level >= slog.LevelError:
+		return Red + fmt.Sprintf(" %-5s", level) + Reset
+	case level >= slog.LevelWarn:
+		return Yellow + fmt.Sprintf(" %-5s", level) + Reset
+	case level >= slog.LevelInfo:
+		return Green + fmt.Sprintf(" %-5s", level) + Reset
+	default:
+		return White + fmt.Sprintf(" %-5s", level) + Reset
+	}
+}
+
+func paintMethod(method string) string {
+	switch method {
+	case "GET":
+		return Blue + fmt.Sprintf("%-6s", method) + Reset
+	case "POST":
+		return Green + fmt.Sprintf("%-6s", method) + Reset
+	case "PUT":
+		return Magenta + fmt.Sprintf("%-6s", method) + Reset
+	case "DELETE":
+		return Red + fmt.Sprintf("%-6s", method) + Reset
+	case "OPTIONS":
+		return Yellow + fmt.Sprintf("%-6s", method) + Reset
+	default:
+		return White + fmt.Sprintf("%-6s", method) + Reset
+	}
+}
+
+func paintStatus(code int) string {
+	switch {
+	case code >= 200 && code < 300:
+		return Green + fmt.Sprintf("%d", code) + Reset
+	case code >= 300 && code < 400:
+		return Cyan + fmt.Sprintf("%d", code) + Reset
+	case code >= 400 && code < 500:
+		return Yellow + fmt.Sprintf("%d", code) + Reset
+	case code >= 500:
+		return Red + fmt.Sprintf("%d", code) + Reset
+	default:
+		return White + fmt.Sprintf("%d", code) + Reset
+	}
+}
@@ -1,103 +1,198 @@
 package util
 
 import (
-	"fmt"
-	"log"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
 	"os"
+	"strings"
 	"time"
 )
 
-// --- COLORS ---
-var (
-	Reset   = "\033[0m"
-	Red     = "\033[31m"
-	Green   = "\033[32m"
-	Yellow  = "\033[33m"
-	Blue    = "\033[34m"
-	Magenta = "\033[35m"
-	Cyan    = "\033[36m"
-	White   = "\033[37m"
+// Standard field names shared by every service so log lines can be joined
+// across ride-service, driver-service and auth-service.
+const (
+	FieldService   = "service"
+	FieldHostname  = "hostname"
+	FieldAction    = "action"
+	FieldRequestID = "request_id"
+	FieldRideID    = "ride_id"
+	FieldDriverID  = "driver_id"
 )
 
+// logLevel is shared by every logger in the process, so changing it through
+// SetLogLevel takes effect immediately everywhere.
+var logLevel = new(slog.LevelVar)
+
 // --- LOGGER STRUCT ---
 type Logger struct {
-	std *log.Logger
+	l   *slog.Logger
+	ctx context.Context
 }
 
-func New() *Logger {
-	return &Logger{
-		std: log.New(os.Stdout, "", 0), // we’ll print our own timestamp
+// InitLogger installs the process-wide slog logger for service. Output is JSON
+// unless LOG_FORMAT=text, which switches to the colored format for local
+// development. LOG_LEVEL sets the initial level (debug, info, warn, error).
+func InitLogger(service string) *Logger {
+	if lvl := os.Getenv("LOG_LEVEL"); lvl != "" {
+		if err := SetLogLevel(lvl); err != nil {
+			logLevel.Set(slog.LevelInfo)
+		}
+	}
+
+	opts := &slog.HandlerOptions{Level: logLevel, ReplaceAttr: replaceAttr}
+
+	var handler slog.Handler
+	if strings.EqualFold(os.Getenv("LOG_FORMAT"), "text") {
+		handler = newColorHandler(os.Stdout, opts)
+	} else {
+		handler = slog.NewJSONHandler(os.Stdout, opts)
 	}
+
+	hostname, _ := os.Hostname()
+	slog.SetDefault(slog.New(ContextHandler{handler}).With(
+		FieldService, service,
+		FieldHostname, hostname,
+	))
+
+	return New()
+}
+
+// New returns a logger writing through the default slog logger.
+func New() *Logger {
+	return &Logger{l: slog.Default(), ctx: context.Background()}
+}
+
+// WithContext returns a logger that adds the request id found in ctx to every line.
+func (l *Logger) WithContext(ctx context.Context) *Logger {
+	return &Logger{l: l.l, ctx: ctx}
+}
+
+// With returns a logger that adds the given key/value pairs to every line,
+// e.g. logger.With(util.FieldRideID, rideID).
+func (l *Logger) With(args ...any) *Logger {
+	return &Logger{l: l.l.With(args...), ctx: l.ctx}
 }
 
 // --- LOG HELPERS ---
 
-func (l *Logger) Info(instance, message string) {
-	l.printf(Green, "INFO", instance, message)
+func (l *Logger) Debug(action, message string) {
+	l.log(slog.LevelDebug, action, message)
+}
+
+func (l *Logger) Info(action, message string) {
+	l.log(slog.LevelInfo, action, message)
 }
 
-func (l *Logger) Warn(instance, message string) {
-	l.printf(Yellow, "WARN", instance, message)
+func (l *Logger) Warn(action, message string) {
+	l.log(slog.LevelWarn, action, message)
 }
 
-func (l *Logger) Error(instance string, err error) {
-	l.printf(Red, "ERROR", instance, err.Error())
+func (l *Logger) Error(action string, err error) {
+	l.log(slog.LevelError, action, errMessage(err))
 }
 
-func (l *Logger) Fatal(instance string, err error) {
-	l.printf(Red, "FATAL", instance, err.Error())
+func (l *Logger) Fatal(action string, err error) {
+	l.log(slog.LevelError, action, errMessage(err), "fatal", true)
 	os.Exit(1)
 }
 
-func (l *Logger) OK(instance, message string) {
-	l.printf(Green, "OK", instance, message)
+// OK logs a successful step at info level.
+func (l *Logger) OK(action, message string) {
+	l.log(slog.LevelInfo, action, message, "ok", true)
 }
 
-func (l *Logger) printf(color, level, instance, message string) {
-	timestamp := time.Now().Format("2006-01-02 15:04:05.000")
-	l.std.Printf("%s|%s|%s %s%-5s%s | %-15s | %s\n",
-		Reset, timestamp, color, level, Reset, "", instance, message)
+func (l *Logger) log(level slog.Level, action, message string, args ...any) {
+	l.l.Log(l.ctx, level, message, append([]any{FieldAction, action}, args...)...)
+}
+
+func errMessage(err error) string {
+	if err == nil {
+		return "unknown error"
+	}
+	return err.Error()
 }
 
 // --- HTTP LOGGING ---
 
 func (l *Logger) HTTP(status int, elapsed time.Duration, host, method, path string) {
-	coloredStatus := paintStatus(status)
-	coloredMethod := paintMethod(method)
-	l.std.Printf("|%s| %7s | %-20s | %s %s\n",
-		coloredStatus, elapsed, host, coloredMethod, path)
-}
-
-// --- COLOR HELPERS ---
-
-func paintMethod(method string) string {
-	switch method {
-	case "GET":
-		return Blue + fmt.Sprintf("%-6s", method) + Reset
-	case "POST":
-		return Green + fmt.Sprintf("%-6s", method) + Reset
-	case "PUT":
-		return Magenta + fmt.Sprintf("%-6s", method) + Reset
-	case "DELETE":
-		return Red + fmt.Sprintf("%-6s", method) + Reset
-	case "OPTIONS":
-		return Yellow + fmt.Sprintf("%-6s", method) + Reset
-	default:
-		return White + fmt.Sprintf("%-6s", method) + Reset
+	level := slog.LevelInfo
+	switch {
+	case status >= 500:
+		level = slog.LevelError
+	case status >= 400:
+		level = slog.LevelWarn
 	}
+
+	l.l.Log(l.ctx, level, method+" "+path,
+		FieldAction, "http_request",
+		"status", status,
+		"duration_ms", float64(elapsed.Microseconds())/1000,
+		"remote_addr", host,
+		"method", method,
+		"path", path,
+	)
 }
 
-func paintStatus(code int) string {
-	switch {
-	case code >= 200 && code < 300:
-		return Green + fmt.Sprintf("%d", code) + Reset
-	case code >= 300 && code < 400:
-		return Cyan + fmt.Sprintf("%d", code) + Reset
-	case code >= 400 && code < 500:
-		return Yellow + fmt.Sprintf("%d", code) + Reset
-	case code >= 500:
-		return Red + fmt.Sprintf("%d", code) + Reset
-	default:
-		return White + fmt.Sprintf("%d", code) + Reset
+// --- LEVELS ---
+
+// LogLevel returns the current level of the process-wide logger.
+func LogLevel() slog.Level {
+	return logLevel.Level()
+}
+
+// SetLogLevel changes the level of the process-wide logger at runtime.
+func SetLogLevel(level string) error {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return errors.New("unknown log level: " + level)
+	}
+	logLevel.Set(lvl)
+	return nil
+}
+
+// replaceAttr renames the built-in slog keys to the field names used by the
+// log pipeline.
+func replaceAttr(groups []string, a slog.Attr) slog.Attr {
+	if len(groups) > 0 {
+		return a
 	}
+	switch a.Key {
+	case slog.TimeKey:
+		a.Key = "timestamp"
+		a.Value = slog.StringValue(a.Value.Time().UTC().Format(time.RFC3339Nano))
+	case slog.MessageKey:
+		a.Key = "message"
+	}
+	return a
+}
+
+// LogLevelHandler serves the admin endpoint for the log level: GET returns the
+// current level, PUT with {"level":"debug"} changes it for the whole process.
+func LogLevelHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut:
+			var req struct {
+				Level string `json:"level"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				WriteJSONError(w, "invalid request body", http.StatusBadRequest)
+				return
+			}
+			if err := SetLogLevel(req.Level); err != nil {
+				WriteJSONError(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			New().WithContext(r.Context()).Warn("LogLevel", "log level changed to "+LogLevel().String())
+		default:
+			WriteJSONError(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		ResponseInJson(w, http.StatusOK, map[string]string{"level": LogLevel().String()})
+	})
 }
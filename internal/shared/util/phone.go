@@ -0,0 +1,42 @@
+package util
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrInvalidPhone is returned for numbers that are not in international
+// format.
+var ErrInvalidPhone = errors.New("phone must be in international format, e.g. +77001234567")
+
+// NormalizePhone returns phone in E.164 form: a plus sign followed by 8 to 15
+// digits, the first of which is not 0. Spaces, dashes, dots and parentheses
+// are dropped and a leading 00 is read as +. Numbers without a country code
+// are rejected rather than guessed.
+func NormalizePhone(phone string) (string, error) {
+	phone = strings.TrimSpace(phone)
+	if strings.HasPrefix(phone, "00") {
+		phone = "+" + phone[2:]
+	}
+	if !strings.HasPrefix(phone, "+") {
+		return "", ErrInvalidPhone
+	}
+
+	var b strings.Builder
+	b.WriteByte('+')
+	for _, c := range phone[1:] {
+		switch {
+		case c >= '0' && c <= '9':
+			b.WriteRune(c)
+		case strings.ContainsRune(" -.()", c):
+		default:
+			return "", ErrInvalidPhone
+		}
+	}
+
+	digits := b.Len() - 1
+	if digits < 8 || digits > 15 || b.String()[1] == '0' {
+		return "", ErrInvalidPhone
+	}
+	return b.String(), nil
+}
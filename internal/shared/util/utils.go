@@ -2,7 +2,6 @@ package util
 
 import (
 	"encoding/json"
-	"fmt"
 	"math"
 	"net/http"
 
@@ -31,10 +30,7 @@ func Haversine(lat1, lon1, lat2, lon2 float64) float64 {
 			math.Sin(deltaLambda/2)*math.Sin(deltaLambda/2)
 	c := 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
 
-	distance := R * c
-	fmt.Println(distance)
-
-	return distance
+	return R * c
 }
 
 func WriteJSONError(w http.ResponseWriter, message string, status int) {
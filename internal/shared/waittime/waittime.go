@@ -0,0 +1,77 @@
+package waittime
+
+import (
+	"math"
+	"ride-hail/internal/shared/models"
+	"time"
+)
+
+// Tariffs are the wait tariffs from config.yaml, keyed by ride type.
+type Tariffs map[string]models.WaitTariff
+
+func NewTariffs(cfg []models.WaitTariff) Tariffs {
+	tariffs := make(Tariffs, len(cfg))
+	for _, t := range cfg {
+		tariffs[t.RideType] = t
+	}
+	return tariffs
+}
+
+// TickInterval is how often countdown updates are pushed to connected clients.
+const TickInterval = 5 * time.Second
+
+// State is a snapshot of the wait at the pickup point, derived from rides.arrived_at.
+type State struct {
+	RideID            string    `json:"ride_id"`
+	ArrivedAt         time.Time `json:"arrived_at"`
+	WaitedSeconds     int       `json:"waited_seconds"`
+	FreeSecondsLeft   int       `json:"free_seconds_left"`
+	BillableMinutes   int       `json:"billable_minutes"`
+	WaitingFee        float64   `json:"waiting_fee"`
+	NoShowInSeconds   int       `json:"no_show_in_seconds"`
+	NoShowAllowed     bool      `json:"no_show_allowed"`
+	NoShowFee         float64   `json:"no_show_fee"`
+	PerMinuteWaitRate float64   `json:"per_minute_rate"`
+}
+
+// For returns the tariff of rideType, falling back to ECONOMY.
+func (t Tariffs) For(rideType string) models.WaitTariff {
+	if tariff, ok := t[rideType]; ok {
+		return tariff
+	}
+	return t["ECONOMY"]
+}
+
+// Calculate works out the wait state at the given moment. Every started minute
+// after the free period is billed.
+func (t Tariffs) Calculate(rideID, rideType string, arrivedAt, now time.Time) State {
+	tariff := t.For(rideType)
+
+	waited := now.Sub(arrivedAt)
+	if waited < 0 {
+		waited = 0
+	}
+
+	state := State{
+		RideID:            rideID,
+		ArrivedAt:         arrivedAt,
+		WaitedSeconds:     int(waited.Seconds()),
+		NoShowFee:         tariff.NoShowFee,
+		PerMinuteWaitRate: tariff.PerMinute,
+	}
+
+	if waited < tariff.FreePeriod {
+		state.FreeSecondsLeft = int((tariff.FreePeriod - waited).Seconds())
+	} else {
+		state.BillableMinutes = int(math.Ceil((waited - tariff.FreePeriod).Minutes()))
+		state.WaitingFee = float64(state.BillableMinutes) * tariff.PerMinute
+	}
+
+	if waited < tariff.NoShowAfter {
+		state.NoShowInSeconds = int((tariff.NoShowAfter - waited).Seconds())
+	} else {
+		state.NoShowAllowed = true
+	}
+
+	return state
+}
@@ -0,0 +1,212 @@
+// Package ws holds what the passenger and driver WebSockets share: the
+// registry of authenticated connections, the auth handshake, keepalive pings
+// and the shutdown sequence.
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"ride-hail/internal/shared/util"
+	"ride-hail/internal/shared/waittime"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// AuthTimeout is how long a new connection has to send its auth message.
+	AuthTimeout = 5 * time.Second
+
+	pingInterval = 30 * time.Second
+	// pongWait is how long a connection may stay silent, pongs included,
+	// before it is considered dead.
+	pongWait = 2 * pingInterval
+
+	// reconnectAfter is the delay clients are asked to wait before reconnecting
+	// when the service shuts down.
+	reconnectAfter = 5 * time.Second
+)
+
+var (
+	ErrAuthTimeout = errors.New("auth timeout")
+	ErrClosed      = errors.New("connection closed")
+)
+
+type AuthMessage struct {
+	Type  string `json:"type"`
+	Token string `json:"token"`
+}
+
+type Message struct {
+	Type    string      `json:"type"`
+	Message string      `json:"message"`
+	Payload interface{} `json:"payload,omitempty"`
+}
+
+// Session reads a connection for as long as it is open: gorilla only handles
+// pongs and close frames while something reads, and a failed read means the
+// client is gone. Messages after the auth message are ignored.
+type Session struct {
+	conn *websocket.Conn
+	auth chan string
+	done chan struct{}
+}
+
+func NewSession(conn *websocket.Conn) *Session {
+	s := &Session{conn: conn, auth: make(chan string, 1), done: make(chan struct{})}
+
+	_ = conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+	go s.read()
+
+	return s
+}
+
+func (s *Session) read() {
+	defer close(s.done)
+	authSent := false
+	for {
+		_, msg, err := s.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		if authSent {
+			continue
+		}
+
+		var authMsg AuthMessage
+		if err := json.Unmarshal(msg, &authMsg); err != nil {
+			continue
+		}
+
+		if authMsg.Type == "auth" {
+			s.auth <- authMsg.Token
+			authSent = true
+		}
+	}
+}
+
+// Token waits for the auth message and returns its token.
+func (s *Session) Token() (string, error) {
+	select {
+	case token := <-s.auth:
+		return token, nil
+	case <-time.After(AuthTimeout):
+		return "", ErrAuthTimeout
+	case <-s.done:
+		return "", ErrClosed
+	}
+}
+
+// KeepAlive pings the client until the connection is closed or a ping fails.
+func (s *Session) KeepAlive() error {
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return nil
+		case <-ticker.C:
+			if err := s.conn.WriteControl(websocket.PingMessage, []byte{}, time.Now().Add(10*time.Second)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Hub keeps the authenticated connection of every user, by user id.
+type Hub struct {
+	mu    sync.Mutex
+	conns map[string]*websocket.Conn
+}
+
+func NewHub() *Hub {
+	return &Hub{conns: make(map[string]*websocket.Conn)}
+}
+
+func (h *Hub) Add(id string, conn *websocket.Conn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.conns[id] = conn
+}
+
+// Remove forgets conn unless the user has reconnected in the meantime.
+func (h *Hub) Remove(id string, conn *websocket.Conn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.conns[id] == conn {
+		delete(h.conns, id)
+	}
+}
+
+// Send writes msg to the user's connection; users without one are skipped.
+func (h *Hub) Send(id string, msg Message) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	conn, ok := h.conns[id]
+	if !ok {
+		return nil
+	}
+	return conn.WriteJSON(msg)
+}
+
+// Close tells every connected client to reconnect and closes the socket with
+// a close frame. It is a step of the graceful shutdown.
+func (h *Hub) Close(ctx context.Context) error {
+	deadline := time.Now().Add(time.Second)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for id, conn := range h.conns {
+		_ = conn.SetWriteDeadline(deadline)
+		_ = conn.WriteJSON(Message{
+			Type:    "reconnect",
+			Message: "server is restarting, please reconnect",
+			Payload: map[string]int64{"retry_after_ms": reconnectAfter.Milliseconds()},
+		})
+		_ = conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseServiceRestart, "server restarting, reconnect"), deadline)
+		_ = conn.Close()
+		delete(h.conns, id)
+	}
+	return nil
+}
+
+// BroadcastWaitTimes pushes the pickup countdown every waittime.TickInterval
+// until ctx is cancelled. states returns the current waits keyed by the user
+// to notify; it is recomputed from the database on each tick, so the
+// countdown survives restarts.
+func (h *Hub) BroadcastWaitTimes(ctx context.Context, states func(context.Context) (map[string]waittime.State, error), message string) {
+	ticker := time.NewTicker(waittime.TickInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			waits, err := states(ctx)
+			if err != nil {
+				util.New().Error("WaitTimeBroadcaster", err)
+				continue
+			}
+
+			for id, state := range waits {
+				if err := h.Send(id, Message{Type: "wait_time_update", Message: message, Payload: state}); err != nil {
+					util.New().With("user_id", id).Warn("WaitTimeBroadcaster", "failed to send wait time update: "+err.Error())
+				}
+			}
+		}
+	}
+}
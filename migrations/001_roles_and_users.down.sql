@@ -1,3 +1,4 @@
+drop table if exists active_tokens cascade;
 drop table if exists users cascade;
 drop table if exists user_status cascade;
-drop table if exists roles cascade;
\ No newline at end of file
+drop table if exists roles cascade;
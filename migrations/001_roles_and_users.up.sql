@@ -1,5 +1,3 @@
-begin;
-
 -- User roles enumeration
 create table roles("value" text not null primary key);
 insert into "roles" ("value") values ('PASSENGER'), ('DRIVER'), ('ADMIN');
@@ -25,5 +23,3 @@ CREATE TABLE active_tokens (
     token TEXT NOT NULL,
     created_at TIMESTAMP DEFAULT NOW()
 );
-
-commit;
\ No newline at end of file
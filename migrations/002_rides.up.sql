@@ -1,5 +1,3 @@
-begin;
-
 -- Ride status enumeration
 create table ride_status("value" text not null primary key);
 insert into "ride_status" ("value") 
@@ -70,5 +68,3 @@ create table ride_events (
     event_type text references "ride_event_type"(value),
     event_data jsonb not null
 );
-
-commit;
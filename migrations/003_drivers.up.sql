@@ -1,5 +1,3 @@
-begin;
-
 -- Driver status enumeration
 create table driver_status("value" text not null primary key);
 insert into "driver_status" ("value") values ('OFFLINE'), ('AVAILABLE'), ('BUSY'), ('EN_ROUTE');
@@ -44,14 +42,3 @@ create table location_history (
     recorded_at timestamptz not null default now(),
     ride_id uuid references rides(id)
 );
-
-INSERT INTO users (id, email, role, status, password_hash)
-VALUES (
-    '550e8400-e29b-41d4-a716-446655440001',
-    'passenger@example.com',
-    'DRIVER',
-    'ACTIVE',
-    'test_hash_123'
-);
-
-commit;
\ No newline at end of file
@@ -0,0 +1 @@
+-- Nothing to undo, see 004_seed_data.up.sql.
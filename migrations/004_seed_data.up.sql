@@ -1,12 +1,2 @@
--- begin;
--- -- Create a test passenger
--- INSERT INTO users (id, email, role, status, password_hash)
--- VALUES (
---     '550e8400-e29b-41d4-a716-446655440001',
---     'passenger@example.com',
---     'PASSENGER',
---     'ACTIVE',
---     'test_hash_123'
--- );
-
--- commit;
\ No newline at end of file
+-- Seed data used to live here. It is now kept in migrations/seeds and loaded
+-- with `ridehail migrate seed`, so schema migrations never insert test data.
@@ -0,0 +1,6 @@
+drop index if exists idx_coordinates_location;
+
+alter table location_history drop column if exists location;
+alter table coordinates drop column if exists location;
+
+-- postgis is left installed, other databases on the server may use it
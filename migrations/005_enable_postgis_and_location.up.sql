@@ -1,5 +1,3 @@
-begin;
-
 -- Make sure PostGIS is available
 CREATE EXTENSION IF NOT EXISTS postgis;
 
@@ -20,5 +18,3 @@ WHERE location IS NULL;
 
 -- Add spatial index
 CREATE INDEX idx_coordinates_location ON coordinates USING GIST (location);
-
-commit;
\ No newline at end of file
@@ -0,0 +1,7 @@
+delete from ride_events where event_type = 'PASSENGER_NO_SHOW';
+delete from "ride_event_type" where "value" = 'PASSENGER_NO_SHOW';
+
+drop index if exists idx_rides_arrived;
+
+alter table rides drop column if exists no_show_fee;
+alter table rides drop column if exists waiting_fee;
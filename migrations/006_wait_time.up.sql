@@ -0,0 +1,7 @@
+-- Waiting at the pickup point is billed per minute after a free period
+alter table rides add column waiting_fee decimal(10,2) not null default 0 check (waiting_fee >= 0);
+alter table rides add column no_show_fee decimal(10,2) check (no_show_fee >= 0);
+
+create index idx_rides_arrived on rides(arrived_at) where status = 'ARRIVED';
+
+insert into "ride_event_type" ("value") values ('PASSENGER_NO_SHOW');
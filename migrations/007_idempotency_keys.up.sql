@@ -0,0 +1,12 @@
+-- Responses of retried requests carrying an Idempotency-Key header
+create table idempotency_keys (
+    user_id uuid not null references users(id) on delete cascade,
+    idempotency_key varchar(255) not null,
+    created_at timestamptz not null default now(),
+    request_fingerprint text not null,
+    response_status integer,
+    response_body bytea,
+    primary key (user_id, idempotency_key)
+);
+
+create index idx_idempotency_keys_created on idempotency_keys(created_at);
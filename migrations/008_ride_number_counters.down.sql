@@ -0,0 +1 @@
+drop table if exists ride_number_counters cascade;
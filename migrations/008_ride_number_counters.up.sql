@@ -0,0 +1,6 @@
+-- One row per UTC day; incremented in the same transaction as the ride insert,
+-- so numbers are sequential with no gaps or collisions across replicas
+create table ride_number_counters (
+    day date primary key,
+    last_value integer not null check (last_value > 0)
+);
@@ -0,0 +1,17 @@
+-- Transactional outbox: rows are written in the same transaction as the ride
+-- changes and published to RabbitMQ by the relay in id order
+create table outbox (
+    id bigserial primary key,
+    event_id uuid unique not null,
+    created_at timestamptz not null default now(),
+    exchange text not null,
+    routing_key text not null,
+    payload jsonb not null,
+    attempts integer not null default 0,
+    last_error text,
+    published_at timestamptz
+);
+
+create index idx_outbox_unpublished on outbox(id) where published_at is null;
+
+insert into "ride_event_type" ("value") values ('RIDE_REQUESTED') on conflict do nothing;
@@ -0,0 +1 @@
+alter table outbox drop column if exists correlation_id;
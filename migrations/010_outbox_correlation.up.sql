@@ -0,0 +1,2 @@
+-- Request id of the HTTP request or message that produced the event
+alter table outbox add column correlation_id text not null default '';
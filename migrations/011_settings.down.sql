@@ -0,0 +1,4 @@
+drop trigger if exists settings_changed on settings;
+drop function if exists notify_settings_changed();
+drop table if exists settings_audit;
+drop table if exists settings;
@@ -0,0 +1,32 @@
+-- Operational settings that can be changed while the services run. A row
+-- overrides the value from config.yaml; deleting it restores that value.
+create table settings (
+    key text primary key,
+    value text not null,
+    updated_at timestamptz not null default now(),
+    updated_by text not null
+);
+
+-- Every change, including resets, is kept
+create table settings_audit (
+    id bigserial primary key,
+    key text not null,
+    old_value text,
+    new_value text,
+    changed_by text not null,
+    changed_at timestamptz not null default now()
+);
+
+create index idx_settings_audit_key on settings_audit(key, changed_at desc);
+
+-- Services LISTEN on settings_changed and reload the key in the payload
+create function notify_settings_changed() returns trigger as $$
+begin
+    perform pg_notify('settings_changed', coalesce(new.key, old.key));
+    return null;
+end;
+$$ language plpgsql;
+
+create trigger settings_changed
+    after insert or update or delete on settings
+    for each row execute function notify_settings_changed();
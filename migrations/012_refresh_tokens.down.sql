@@ -0,0 +1,7 @@
+create table if not exists active_tokens (
+    user_id uuid primary key references users(id) on delete cascade,
+    token text not null,
+    created_at timestamp default now()
+);
+
+drop table if exists refresh_tokens;
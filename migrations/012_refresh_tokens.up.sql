@@ -0,0 +1,23 @@
+-- Refresh tokens, one family per login. Every refresh replaces the token with
+-- a new one in the same family; presenting a replaced token again means it was
+-- stolen, and the whole family is revoked. Only the SHA-256 of a token is
+-- stored.
+create table refresh_tokens (
+    id uuid primary key,
+    user_id uuid not null references users(id) on delete cascade,
+    family_id uuid not null,
+    token_hash text not null unique,
+    device text not null default '',
+    created_at timestamptz not null default now(),
+    expires_at timestamptz not null,
+    used_at timestamptz,
+    replaced_by uuid references refresh_tokens(id) on delete set null,
+    revoked_at timestamptz
+);
+
+create index idx_refresh_tokens_family on refresh_tokens(family_id);
+create index idx_refresh_tokens_user_active on refresh_tokens(user_id) where revoked_at is null;
+create index idx_refresh_tokens_expires on refresh_tokens(expires_at);
+
+-- A user may now be logged in on several devices at once
+drop table active_tokens;
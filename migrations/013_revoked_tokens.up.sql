@@ -0,0 +1,14 @@
+-- Revoked access tokens. A row names one token by its jti, or with only
+-- user_id every token of that user issued up to revoked_at. Services load the
+-- rows that have not expired at startup and then follow auth_fanout.
+create table revoked_tokens (
+    id bigserial primary key,
+    token_id text,
+    user_id uuid,
+    reason text not null,
+    revoked_at timestamptz not null default now(),
+    expires_at timestamptz not null,
+    check (token_id is not null or user_id is not null)
+);
+
+create index idx_revoked_tokens_expires on revoked_tokens(expires_at);
@@ -0,0 +1,26 @@
+-- Failed logins per account (subject is the lowercased email, whether or not
+-- it is registered) and per client IP. blocked_until covers both the backoff
+-- after each failure and lockouts.
+create table login_failures (
+    kind text not null check (kind in ('account', 'ip')),
+    subject text not null,
+    failures integer not null default 0,
+    last_failed_at timestamptz not null default now(),
+    blocked_until timestamptz,
+    primary key (kind, subject)
+);
+
+-- Every lockout, kept after it expires or is cleared
+create table login_lockouts (
+    id bigserial primary key,
+    kind text not null,
+    subject text not null,
+    failures integer not null,
+    locked_at timestamptz not null default now(),
+    locked_until timestamptz not null,
+    cleared_at timestamptz,
+    cleared_by text
+);
+
+create index idx_login_lockouts_subject on login_lockouts(kind, subject, locked_at desc);
+create index idx_login_lockouts_locked_at on login_lockouts(locked_at desc);
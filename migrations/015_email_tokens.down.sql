@@ -0,0 +1,6 @@
+drop table if exists email_tokens;
+
+alter table users drop column if exists email_verified_at;
+
+update users set status = 'INACTIVE' where status = 'PENDING';
+delete from "user_status" where "value" = 'PENDING';
@@ -0,0 +1,17 @@
+-- New accounts stay PENDING until their email address is verified
+insert into "user_status" ("value") values ('PENDING') on conflict do nothing;
+
+alter table users add column email_verified_at timestamptz;
+
+-- Single-use tokens sent by email. Only the SHA-256 of a token is stored.
+create table email_tokens (
+    id uuid primary key,
+    user_id uuid not null references users(id) on delete cascade,
+    purpose text not null check (purpose in ('verify_email', 'reset_password')),
+    token_hash text not null unique,
+    created_at timestamptz not null default now(),
+    expires_at timestamptz not null,
+    used_at timestamptz
+);
+
+create index idx_email_tokens_user on email_tokens(user_id, purpose, created_at desc);
@@ -0,0 +1,6 @@
+drop table if exists phone_otps;
+
+alter table users drop constraint if exists users_phone_e164;
+alter table users drop constraint if exists users_phone_key;
+alter table users drop column if exists phone_verified_at;
+alter table users drop column if exists phone;
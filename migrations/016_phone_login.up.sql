@@ -0,0 +1,32 @@
+-- Phone numbers in E.164 form, unique, usable for OTP login
+alter table users add column phone text;
+alter table users add column phone_verified_at timestamptz;
+
+-- Keep numbers that were stored in attrs and are already international and
+-- unambiguous; the rest stay in attrs until users register them again.
+with candidates as (
+    select id, regexp_replace(attrs->>'phone', '[\s().-]', '', 'g') as phone
+    from users
+    where attrs ? 'phone'
+)
+update users u set phone = c.phone
+from candidates c
+where u.id = c.id
+  and c.phone ~ '^\+[1-9][0-9]{7,14}$'
+  and (select count(*) from candidates d where d.phone = c.phone) = 1;
+
+alter table users add constraint users_phone_key unique (phone);
+alter table users add constraint users_phone_e164 check (phone ~ '^\+[1-9][0-9]{7,14}$');
+
+-- One-time login codes. The code is stored as SHA-256 of phone and code.
+create table phone_otps (
+    id uuid primary key,
+    phone text not null,
+    code_hash text not null,
+    created_at timestamptz not null default now(),
+    expires_at timestamptz not null,
+    attempts integer not null default 0,
+    consumed_at timestamptz
+);
+
+create index idx_phone_otps_phone on phone_otps(phone, created_at desc);
@@ -0,0 +1 @@
+alter table users drop column if exists erased_at;
@@ -0,0 +1,3 @@
+-- Set when a user's personal data was erased. The row stays, INACTIVE and
+-- anonymized, because rides and earnings still refer to it.
+alter table users add column erased_at timestamptz;
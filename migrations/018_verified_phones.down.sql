@@ -0,0 +1,17 @@
+drop index if exists idx_phone_otps_requested_ip;
+alter table phone_otps drop column if exists requested_ip;
+
+drop index if exists users_phone_key;
+
+-- Keep one holder per number, preferring the verified one.
+update users set phone = null, phone_verified_at = null
+where id in (
+    select id from (
+        select id, row_number() over (partition by phone order by phone_verified_at nulls last, created_at) as n
+        from users
+        where phone is not null
+    ) ranked
+    where n > 1
+);
+
+alter table users add constraint users_phone_key unique (phone);
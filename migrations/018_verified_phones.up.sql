@@ -0,0 +1,10 @@
+-- A number only belongs to an account once a code texted to it was entered.
+-- Unverified numbers may repeat, so registering someone else's number neither
+-- blocks its owner nor lets the registrant log in with it.
+alter table users drop constraint users_phone_key;
+create unique index users_phone_key on users(phone) where phone_verified_at is not null;
+
+-- Code requests are also limited per client address.
+alter table phone_otps add column requested_ip text;
+
+create index idx_phone_otps_requested_ip on phone_otps(requested_ip, created_at desc);
@@ -0,0 +1,2 @@
+alter table users drop constraint if exists users_pending_phone_e164;
+alter table users drop column if exists pending_phone;
@@ -0,0 +1,8 @@
+-- A number entered in the profile waits here until the code texted to it is
+-- entered; only then does it replace users.phone.
+alter table users add column pending_phone text;
+alter table users add constraint users_pending_phone_e164 check (pending_phone ~ '^\+[1-9][0-9]{7,14}$');
+
+-- users.phone is the only copy of the number; drop the ones registration
+-- also wrote into attrs.
+update users set attrs = attrs - 'phone' where attrs->>'phone' = phone;
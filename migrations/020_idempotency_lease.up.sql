@@ -0,0 +1,4 @@
+-- A reservation without a response is only held until locked_until; after
+-- that a retry may take the key over, so a crashed request cannot block it
+-- for the whole retention period.
+alter table idempotency_keys add column locked_until timestamptz not null default now();
@@ -0,0 +1,3 @@
+drop index if exists idx_outbox_unpublished;
+alter table outbox drop column if exists txid;
+create index idx_outbox_unpublished on outbox(id) where published_at is null;
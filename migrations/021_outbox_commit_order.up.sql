@@ -0,0 +1,8 @@
+-- Ids are taken when a row is inserted, not when it commits, so a lower id can
+-- become visible after a higher one. The relay orders by the writing
+-- transaction instead and only takes rows older than every transaction still
+-- running, so no earlier row can show up after it published a later one.
+alter table outbox add column txid xid8 not null default pg_current_xact_id();
+
+drop index if exists idx_outbox_unpublished;
+create index idx_outbox_unpublished on outbox(txid, id) where published_at is null;
@@ -0,0 +1,17 @@
+// Package migrations embeds the schema migrations and seeds, so every binary
+// can apply them without the files on disk.
+package migrations
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed *.sql
+var FS embed.FS
+
+//go:embed seeds/*.sql
+var seeds embed.FS
+
+// Seeds holds the development data loaded by `ridehail migrate seed`.
+var Seeds, _ = fs.Sub(seeds, "seeds")
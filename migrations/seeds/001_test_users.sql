@@ -0,0 +1,11 @@
+-- Test account for local development. Seeds are not versioned and may run
+-- more than once, so every insert must be idempotent.
+insert into users (id, email, role, status, password_hash)
+values (
+    '550e8400-e29b-41d4-a716-446655440001',
+    'passenger@example.com',
+    'PASSENGER',
+    'ACTIVE',
+    'test_hash_123'
+)
+on conflict do nothing;